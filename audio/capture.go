@@ -0,0 +1,216 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"layeh.com/gopus"
+)
+
+// Capture formats written for the STT service
+const (
+	CaptureWAV  = "wav"
+	CaptureFLAC = "flac"
+	CaptureOpus = "opus"
+)
+
+// CaptureConfig controls the format utterances are saved in for transcription.
+// Zero fields fall back to DefaultCaptureConfig.
+type CaptureConfig struct {
+	SampleRate        int    `json:"sample_rate"`         // Hz; Opus needs 8000, 12000, 16000, 24000 or 48000
+	Channels          int    `json:"channels"`            // 1 (downmixed) or 2
+	Format            string `json:"format"`              // wav, flac or opus
+	MaxSegmentSeconds int    `json:"max_segment_seconds"` // Long speech is split at a pause into segments at most this long; negative disables
+}
+
+// DefaultCaptureConfig returns what speech recognition needs: 16kHz mono WAV in segments of at most 30s
+func DefaultCaptureConfig() CaptureConfig {
+	return CaptureConfig{
+		SampleRate:        16000,
+		Channels:          1,
+		Format:            CaptureWAV,
+		MaxSegmentSeconds: 30,
+	}
+}
+
+// Merge returns c with every non-zero field of override applied on top
+func (c CaptureConfig) Merge(override CaptureConfig) CaptureConfig {
+	if override.SampleRate != 0 {
+		c.SampleRate = override.SampleRate
+	}
+	if override.Channels != 0 {
+		c.Channels = override.Channels
+	}
+	if override.Format != "" {
+		c.Format = override.Format
+	}
+	if override.MaxSegmentSeconds != 0 {
+		c.MaxSegmentSeconds = override.MaxSegmentSeconds
+	}
+	return c
+}
+
+// Validate reports settings the encoders cannot produce
+func (c CaptureConfig) Validate() error {
+	if c.Channels != 1 && c.Channels != 2 {
+		return fmt.Errorf("capture channels must be 1 or 2, got %d", c.Channels)
+	}
+	if c.SampleRate < 8000 || c.SampleRate > SampleRate {
+		return fmt.Errorf("capture sample rate must be between 8000 and %d, got %d", SampleRate, c.SampleRate)
+	}
+	switch c.Format {
+	case CaptureWAV, CaptureFLAC:
+	case CaptureOpus:
+		switch c.SampleRate {
+		case 8000, 12000, 16000, 24000, 48000:
+		default:
+			return fmt.Errorf("opus capture needs a sample rate of 8000, 12000, 16000, 24000 or 48000, got %d", c.SampleRate)
+		}
+	default:
+		return fmt.Errorf("unknown capture format %q", c.Format)
+	}
+	return nil
+}
+
+// maxSegmentSamples is the longest segment in recorder samples (48kHz stereo), or 0 for unbounded
+func (c CaptureConfig) maxSegmentSamples() int {
+	if c.MaxSegmentSeconds <= 0 {
+		return 0
+	}
+	return c.MaxSegmentSeconds * SampleRate * Channels
+}
+
+var (
+	captureMu     sync.RWMutex
+	captureConfig = DefaultCaptureConfig()
+)
+
+// ConfigureCapture sets the capture format (merged onto the defaults).
+// Invalid settings are rejected and the defaults kept.
+func ConfigureCapture(cfg CaptureConfig) error {
+	merged := DefaultCaptureConfig().Merge(cfg)
+	if err := merged.Validate(); err != nil {
+		return err
+	}
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	captureConfig = merged
+	return nil
+}
+
+// GetCaptureConfig returns the current capture settings
+func GetCaptureConfig() CaptureConfig {
+	captureMu.RLock()
+	defer captureMu.RUnlock()
+	return captureConfig
+}
+
+// ConvertCapture down-mixes and resamples 48kHz stereo PCM to the capture rate and channel count (interleaved)
+func ConvertCapture(pcm []int16, cfg CaptureConfig) []int16 {
+	if cfg.SampleRate == SampleRate && cfg.Channels == Channels {
+		return pcm
+	}
+
+	// Work in [-1, 1] like the VAD's downmix
+	var planes [][]float64
+	if cfg.Channels == 1 {
+		planes = [][]float64{downmix(pcm)}
+	} else {
+		left := make([]float64, len(pcm)/2)
+		right := make([]float64, len(pcm)/2)
+		for i := range left {
+			left[i] = float64(pcm[2*i]) / 32768
+			right[i] = float64(pcm[2*i+1]) / 32768
+		}
+		planes = [][]float64{left, right}
+	}
+	for i, plane := range planes {
+		planes[i] = Resample(plane, SampleRate, cfg.SampleRate)
+	}
+
+	frames := len(planes[0])
+	out := make([]int16, frames*cfg.Channels)
+	for i := 0; i < frames; i++ {
+		for ch, plane := range planes {
+			out[i*cfg.Channels+ch] = clampInt16(plane[i] * 32768)
+		}
+	}
+	return out
+}
+
+func clampInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// EncodeCapture converts 48kHz stereo PCM to the capture format and returns the encoded file and its extension
+func EncodeCapture(pcm []int16, cfg CaptureConfig) ([]byte, string, error) {
+	samples := ConvertCapture(pcm, cfg)
+
+	var buf bytes.Buffer
+	switch cfg.Format {
+	case CaptureFLAC:
+		if err := EncodeFLAC(&buf, samples, cfg.SampleRate, cfg.Channels); err != nil {
+			return nil, "", fmt.Errorf("failed to encode FLAC: %w", err)
+		}
+		return buf.Bytes(), ".flac", nil
+	case CaptureOpus:
+		if err := encodeOggOpus(&buf, samples, cfg.SampleRate, cfg.Channels); err != nil {
+			return nil, "", fmt.Errorf("failed to encode Opus: %w", err)
+		}
+		return buf.Bytes(), ".ogg", nil
+	default:
+		if err := writeWAVHeaderToBuffer(&buf, len(samples), cfg.SampleRate, cfg.Channels); err != nil {
+			return nil, "", fmt.Errorf("failed to write WAV header: %w", err)
+		}
+		if err := binary.Write(&buf, binary.LittleEndian, samples); err != nil {
+			return nil, "", fmt.Errorf("failed to write audio data: %w", err)
+		}
+		return buf.Bytes(), ".wav", nil
+	}
+}
+
+// encodeOggOpus encodes interleaved PCM as 20ms Opus packets in an Ogg container
+func encodeOggOpus(buf *bytes.Buffer, pcm []int16, rate, numChannels int) error {
+	encoder, err := gopus.NewEncoder(rate, numChannels, gopus.Voip)
+	if err != nil {
+		return err
+	}
+	writer, err := NewOggOpusWriter(buf, numChannels, uint32(len(pcm)))
+	if err != nil {
+		return err
+	}
+
+	frame := rate / 50 // 20ms
+	chunk := frame * numChannels
+	padded := make([]int16, chunk)
+	// One extra frame of silence flushes the encoder's lookahead, so the pre-skip is covered by real samples
+	for pos := 0; pos < len(pcm)+chunk; pos += chunk {
+		in := pcm[min(pos, len(pcm)):min(pos+chunk, len(pcm))]
+		if len(in) < chunk {
+			// Pad the last frame with silence
+			copy(padded, in)
+			clear(padded[len(in):])
+			in = padded
+		}
+		packet, err := encoder.Encode(in, frame, maxBytes)
+		if err != nil {
+			return err
+		}
+		// Ogg granule positions always count 48kHz samples; the final granule trims the padding
+		samples := max(0, min(len(pcm)-pos, chunk)) / numChannels * (SampleRate / rate)
+		if err := writer.WritePacket(packet, samples); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
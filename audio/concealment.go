@@ -0,0 +1,118 @@
+package audio
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxConcealedFrames lost in a row are rebuilt by the decoder: the last from the forward error
+// correction data in the next packet, the rest by packet loss concealment. Longer losses are
+// filled with silence.
+const maxConcealedFrames = 5
+
+// lateWindow is how far behind the newest packet one can arrive and still count as merely late;
+// further back (or more than half the sequence range ahead) the sender is taken to have restarted
+const lateWindow = 64
+
+// PacketLossStats count one user's voice packets and how gaps in them were filled
+type PacketLossStats struct {
+	Received  int64 `json:"received"`
+	Lost      int64 `json:"lost"`       // Missing sequence numbers
+	Concealed int64 `json:"concealed"`  // Lost frames rebuilt with FEC or PLC
+	Late      int64 `json:"late"`       // Duplicate or out-of-order packets, dropped
+	SilenceMs int64 `json:"silence_ms"` // Silence inserted into recordings for gaps in the stream
+}
+
+var (
+	lossMu     sync.Mutex
+	packetLoss = make(map[string]*PacketLossStats) // Keyed by user ID
+)
+
+// GetPacketLoss returns every user's packet counters since startup
+func GetPacketLoss() map[string]PacketLossStats {
+	lossMu.Lock()
+	defer lossMu.Unlock()
+	stats := make(map[string]PacketLossStats, len(packetLoss))
+	for userID, s := range packetLoss {
+		stats[userID] = *s
+	}
+	return stats
+}
+
+// countPacket adds a received packet and the gap before it to a user's counters
+func countPacket(userID string, gap packetGap, concealed, silence int) {
+	lossMu.Lock()
+	defer lossMu.Unlock()
+	s, ok := packetLoss[userID]
+	if !ok {
+		s = &PacketLossStats{}
+		packetLoss[userID] = s
+	}
+	s.Received++
+	if gap.late {
+		s.Late++
+		return
+	}
+	s.Lost += int64(gap.lost)
+	s.Concealed += int64(concealed)
+	s.SilenceMs += int64(silence * vadFrameMs)
+}
+
+// packetGap is what went missing between a speaker's previous packet and this one
+type packetGap struct {
+	late    bool // Already played or out of order
+	lost    int  // Packets missing by sequence number
+	silence int  // Further frames missing by timestamp, while the sender was not transmitting
+}
+
+// rtpTracker follows one speaker's RTP sequence numbers and timestamps
+type rtpTracker struct {
+	started   bool
+	sequence  uint16
+	timestamp uint32
+}
+
+// next returns the gap before a packet. Both fields wrap, so differences are taken modulo their size.
+func (t *rtpTracker) next(p *discordgo.Packet) packetGap {
+	if t.started {
+		if behind := t.sequence - p.Sequence; behind < lateWindow {
+			return packetGap{late: true}
+		}
+	}
+	seqDelta := p.Sequence - t.sequence
+	if !t.started || seqDelta >= 1<<15 {
+		t.started = true
+		t.sequence, t.timestamp = p.Sequence, p.Timestamp
+		return packetGap{}
+	}
+	tsDelta := p.Timestamp - t.timestamp
+	t.sequence, t.timestamp = p.Sequence, p.Timestamp
+
+	gap := packetGap{lost: int(seqDelta) - 1}
+	if tsDelta < 1<<31 {
+		// Timestamps count 48kHz samples, one frame's worth per packet
+		if missing := int(tsDelta/FrameSize) - 1; missing > gap.lost {
+			gap.silence = missing - gap.lost
+		}
+	}
+	return gap
+}
+
+// conceal decodes the frames standing in for a short loss before p: PLC for all but the last,
+// which FEC recovers from p when the sender included it. The caller holds s.mu.
+func (s *speakerState) conceal(p *discordgo.Packet, lost int) [][]int16 {
+	frames := make([][]int16, 0, lost)
+	for i := 0; i < lost-1; i++ {
+		pcm, err := s.decoder.Decode(nil, frameSize, false)
+		if err != nil {
+			return frames
+		}
+		frames = append(frames, pcm)
+	}
+	pcm, err := s.decoder.Decode(p.Opus, frameSize, true)
+	if err != nil {
+		return frames
+	}
+	return append(frames, pcm)
+}
@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func rtpPacket(seq uint16, ts uint32) *discordgo.Packet {
+	return &discordgo.Packet{Sequence: seq, Timestamp: ts}
+}
+
+func TestRTPTrackerGaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		seq       uint16
+		ts        uint32
+		wantGap   packetGap
+		afterNext uint16 // Sequence the tracker holds afterwards
+	}{
+		{"next packet", 101, 1000 + FrameSize, packetGap{}, 101},
+		{"two lost", 104, 1000 + 4*FrameSize, packetGap{lost: 2}, 104},
+		{"duplicate", 104, 1000 + 4*FrameSize, packetGap{late: true}, 104},
+		{"out of order", 103, 1000 + 3*FrameSize, packetGap{late: true}, 104},
+		{"sender paused", 105, 1000 + 54*FrameSize, packetGap{silence: 49}, 105},
+		{"sender restarted", 40000, 7, packetGap{}, 40000},
+	}
+
+	tracker := rtpTracker{}
+	tracker.next(rtpPacket(100, 1000))
+	for _, tt := range tests {
+		if got := tracker.next(rtpPacket(tt.seq, tt.ts)); got != tt.wantGap {
+			t.Errorf("%s: gap %+v, want %+v", tt.name, got, tt.wantGap)
+		}
+		if tracker.sequence != tt.afterNext {
+			t.Errorf("%s: tracker at %d, want %d", tt.name, tracker.sequence, tt.afterNext)
+		}
+	}
+
+	// Sequence numbers and timestamps wrap
+	tracker = rtpTracker{}
+	tracker.next(rtpPacket(65535, 1<<32-FrameSize))
+	if got := tracker.next(rtpPacket(1, FrameSize)); got != (packetGap{lost: 1}) {
+		t.Errorf("across the wrap: gap %+v, want one lost", got)
+	}
+}
+
+func TestRecorderFillsGapsInRecording(t *testing.T) {
+	vr, starts, _ := newTestRecorder(t, "loss-guild")
+	vr.SetCurrentChannel("voice-a")
+	vr.RegisterSSRC(111, "alice", "voice-a")
+
+	speech := encodeFrames(t, tone(40, 440, 8000))
+	send := func(seq, frame int) {
+		p := &discordgo.Packet{SSRC: 111, Sequence: uint16(seq), Timestamp: uint32(frame * FrameSize), Opus: speech[frame]}
+		if err := vr.ProcessVoicePacket(111, p); err != nil {
+			t.Fatalf("packet %d: %v", seq, err)
+		}
+	}
+
+	for seq := 0; seq < 20; seq++ {
+		send(seq, seq)
+	}
+	select {
+	case <-starts:
+	case <-time.After(time.Second):
+		t.Fatal("speech did not start a recording")
+	}
+
+	vr.mutex.RLock()
+	recording := vr.recordings["alice"]
+	vr.mutex.RUnlock()
+	recording.Mutex.Lock()
+	before := len(recording.Buffer)
+	recording.Mutex.Unlock()
+	statsBefore := GetPacketLoss()["alice"]
+
+	// Three packets lost (concealed), then a 200ms pause in sending (silence)
+	send(23, 23)
+	send(24, 34)
+
+	recording.Mutex.Lock()
+	grown := (len(recording.Buffer) - before) / (frameSize * channels)
+	recording.Mutex.Unlock()
+	if grown != 15 {
+		t.Errorf("recording grew by %d frames, want 15", grown)
+	}
+
+	stats := GetPacketLoss()["alice"]
+	lost, concealed := stats.Lost-statsBefore.Lost, stats.Concealed-statsBefore.Concealed
+	if silence := stats.SilenceMs - statsBefore.SilenceMs; lost != 3 || concealed != 3 || silence != 200 {
+		t.Errorf("counted %d lost, %d concealed and %dms of silence, want 3, 3 and 200ms", lost, concealed, silence)
+	}
+}
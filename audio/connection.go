@@ -0,0 +1,254 @@
+package audio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// VoiceConnection is the voice transport the audio pipeline sends Dexter's audio to and receives
+// users' packets from. WrapVoiceConnection adapts a Discord voice connection; LoopbackConnection
+// runs the pipeline without one.
+type VoiceConnection interface {
+	Ready() bool
+	ChannelID() string // Voice channel currently joined; it changes if Dexter is moved
+	Speaking(speaking bool) error
+	SendOpus(opus []byte) bool         // False if the frame was dropped
+	Packets() <-chan *discordgo.Packet // Closed when the connection goes away
+	Disconnect() error
+}
+
+// discordConnection sends to and receives from a Discord voice connection. discordgo paces the
+// actual UDP sends itself from a small buffer, which the mixer keeps topped up.
+type discordConnection struct {
+	vc *discordgo.VoiceConnection
+}
+
+// WrapVoiceConnection returns the VoiceConnection for a Discord voice connection
+func WrapVoiceConnection(vc *discordgo.VoiceConnection) VoiceConnection {
+	return discordConnection{vc: vc}
+}
+
+// DiscordVoiceConnection returns the Discord voice connection behind conn, or nil if conn is not one
+func DiscordVoiceConnection(conn VoiceConnection) *discordgo.VoiceConnection {
+	if d, ok := conn.(discordConnection); ok {
+		return d.vc
+	}
+	return nil
+}
+
+func (d discordConnection) Ready() bool {
+	d.vc.RLock()
+	defer d.vc.RUnlock()
+	return d.vc.Ready && d.vc.OpusSend != nil
+}
+
+func (d discordConnection) ChannelID() string {
+	d.vc.RLock()
+	defer d.vc.RUnlock()
+	return d.vc.ChannelID
+}
+
+func (d discordConnection) Speaking(speaking bool) error {
+	return d.vc.Speaking(speaking)
+}
+
+func (d discordConnection) SendOpus(opus []byte) bool {
+	// discordgo replaces the send channel when it reconnects
+	d.vc.RLock()
+	send := d.vc.OpusSend
+	d.vc.RUnlock()
+	if send == nil {
+		return false
+	}
+
+	select {
+	case send <- opus:
+		return true
+	case <-time.After(opusSendTimeout):
+		return false
+	}
+}
+
+func (d discordConnection) Packets() <-chan *discordgo.Packet {
+	d.vc.RLock()
+	defer d.vc.RUnlock()
+	return d.vc.OpusRecv
+}
+
+func (d discordConnection) Disconnect() error {
+	return d.vc.Disconnect()
+}
+
+// LoopbackConnection is an in-memory VoiceConnection. It records every frame sent to it and
+// delivers packets injected with Inject, numbering them per SSRC as Discord would.
+type LoopbackConnection struct {
+	mu       sync.Mutex
+	ready    bool
+	channel  string
+	speaking []bool   // Every Speaking call, in order
+	sent     [][]byte // Every frame accepted, in order
+	sentCond *sync.Cond
+	full     bool // Reject sends, as if the send buffer stayed full
+	recv     chan *discordgo.Packet
+	sequence map[uint32]uint16
+	closed   bool
+	done     chan struct{}  // Closed by Close, releasing blocked Inject calls
+	inFlight sync.WaitGroup // Inject calls sending on recv, waited for before it is closed
+}
+
+// NewLoopbackConnection returns a ready loopback connection in a channel called "loopback" that
+// buffers up to 256 injected packets
+func NewLoopbackConnection() *LoopbackConnection {
+	l := &LoopbackConnection{
+		ready:    true,
+		channel:  "loopback",
+		recv:     make(chan *discordgo.Packet, 256),
+		sequence: make(map[uint32]uint16),
+		done:     make(chan struct{}),
+	}
+	l.sentCond = sync.NewCond(&l.mu)
+	return l
+}
+
+// SetReady sets what Ready reports
+func (l *LoopbackConnection) SetReady(ready bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ready = ready
+}
+
+// SetFull makes SendOpus drop frames (true) or accept them again (false)
+func (l *LoopbackConnection) SetFull(full bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.full = full
+}
+
+// SetChannel sets what ChannelID reports, as if Dexter had been moved
+func (l *LoopbackConnection) SetChannel(channelID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.channel = channelID
+}
+
+func (l *LoopbackConnection) Ready() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ready
+}
+
+func (l *LoopbackConnection) ChannelID() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.channel
+}
+
+func (l *LoopbackConnection) Speaking(speaking bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.speaking = append(l.speaking, speaking)
+	return nil
+}
+
+func (l *LoopbackConnection) SendOpus(opus []byte) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.full {
+		return false
+	}
+	l.sent = append(l.sent, opus)
+	l.sentCond.Broadcast()
+	return true
+}
+
+func (l *LoopbackConnection) Packets() <-chan *discordgo.Packet {
+	return l.recv
+}
+
+// Sent returns a copy of every frame sent so far
+func (l *LoopbackConnection) Sent() [][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([][]byte(nil), l.sent...)
+}
+
+// SpeakingUpdates returns every Speaking call so far
+func (l *LoopbackConnection) SpeakingUpdates() []bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]bool(nil), l.speaking...)
+}
+
+// WaitSent blocks until at least n frames have been sent or timeout passes, and reports which
+func (l *LoopbackConnection) WaitSent(n int, timeout time.Duration) bool {
+	timer := time.AfterFunc(timeout, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.sentCond.Broadcast()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(l.sent) < n && time.Now().Before(deadline) {
+		l.sentCond.Wait()
+	}
+	return len(l.sent) >= n
+}
+
+// Inject delivers an Opus packet as if received from ssrc, with the next sequence number and a
+// timestamp 20ms after the last. It blocks while the buffer is full, without holding up the
+// connection's other methods, and returns without delivering once the connection is closed.
+func (l *LoopbackConnection) Inject(ssrc uint32, opus []byte) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	seq := l.sequence[ssrc]
+	l.sequence[ssrc] = seq + 1
+	l.inFlight.Add(1)
+	l.mu.Unlock()
+	defer l.inFlight.Done()
+
+	packet := &discordgo.Packet{
+		SSRC:      ssrc,
+		Sequence:  seq,
+		Timestamp: uint32(seq) * FrameSize,
+		Type:      []byte{0x80, 0x78},
+		Opus:      opus,
+	}
+	select {
+	case l.recv <- packet:
+	case <-l.done:
+	}
+}
+
+// Disconnect leaves the channel and closes the connection
+func (l *LoopbackConnection) Disconnect() error {
+	l.mu.Lock()
+	l.ready = false
+	l.channel = ""
+	l.mu.Unlock()
+	l.Close()
+	return nil
+}
+
+// Close closes the received packet channel, ending any Receive loop reading it.
+// Inject calls blocked on a full buffer return first.
+func (l *LoopbackConnection) Close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+
+	l.inFlight.Wait()
+	close(l.recv)
+}
@@ -0,0 +1,62 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoopbackInjectDoesNotBlockConnection(t *testing.T) {
+	conn := NewLoopbackConnection()
+	for i := 0; i < cap(conn.recv); i++ {
+		conn.Inject(111, []byte{0xf8})
+	}
+
+	// With the buffer full the next packet waits for room
+	injected := make(chan struct{})
+	go func() {
+		conn.Inject(111, []byte{0xf8})
+		close(injected)
+	}()
+	select {
+	case <-injected:
+		t.Fatal("Inject returned with the buffer full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// ...without holding up the rest of the connection
+	calls := make(chan struct{})
+	go func() {
+		conn.Ready()
+		conn.ChannelID()
+		conn.SendOpus([]byte{0xf8})
+		close(calls)
+	}()
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("connection methods blocked behind a pending Inject")
+	}
+
+	// Closing releases the pending Inject and then ends the packet stream
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+	for _, ch := range []chan struct{}{injected, closed} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("Close did not release the pending Inject")
+		}
+	}
+	n := 0
+	for range conn.Packets() {
+		n++
+	}
+	if n != cap(conn.recv) {
+		t.Fatalf("received %d packets, want the %d buffered before the close", n, cap(conn.recv))
+	}
+
+	conn.Inject(111, []byte{0xf8}) // Does nothing once closed
+}
@@ -0,0 +1,67 @@
+package audio
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// consentRetryDelay is how long a failed consent lookup is remembered before trying again
+const consentRetryDelay = 30 * time.Second
+
+var (
+	consentMu     sync.RWMutex
+	consentCache  = make(map[string]bool)      // userID -> opted out
+	consentFailed = make(map[string]time.Time) // userID -> last failed lookup
+	consentLookup func(userID string) (optedOut bool, err error)
+)
+
+// ConfigureConsent sets how a user's recording opt-out is looked up the first time they are heard
+func ConfigureConsent(lookup func(userID string) (optedOut bool, err error)) {
+	consentMu.Lock()
+	defer consentMu.Unlock()
+	consentLookup = lookup
+	consentCache = make(map[string]bool)
+	consentFailed = make(map[string]time.Time)
+}
+
+// IsOptedOut reports whether a user has opted out of voice recording and transcription
+func IsOptedOut(userID string) bool {
+	consentMu.RLock()
+	optedOut, cached := consentCache[userID]
+	failedAt, failed := consentFailed[userID]
+	lookup := consentLookup
+	consentMu.RUnlock()
+	if cached || lookup == nil {
+		return optedOut
+	}
+	// Fail closed: after a lookup error the user is not recorded until a retry succeeds
+	if failed && time.Since(failedAt) < consentRetryDelay {
+		return true
+	}
+
+	optedOut, err := lookup(userID)
+	consentMu.Lock()
+	defer consentMu.Unlock()
+	if err != nil {
+		log.Printf("Consent lookup failed for %s: %v", userID, err)
+		consentFailed[userID] = time.Now()
+		return true
+	}
+	delete(consentFailed, userID)
+	consentCache[userID] = optedOut
+	return optedOut
+}
+
+// SetOptedOut updates a user's opt-out. Opting out discards any utterance of theirs still being recorded.
+func SetOptedOut(userID string, optedOut bool) {
+	consentMu.Lock()
+	consentCache[userID] = optedOut
+	consentMu.Unlock()
+
+	if optedOut {
+		for _, session := range Sessions() {
+			session.Recorder().DiscardRecording(userID)
+		}
+	}
+}
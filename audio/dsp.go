@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// limiterThreshold is the level (fraction of full scale) above which the soft limiter starts compressing.
+	limiterThreshold = 0.8
+	// gainRampMs is how long a volume change takes to fade in, avoiding zipper noise.
+	gainRampMs = 20
+	// maxChannelGain caps per-channel gain at +6dB.
+	maxChannelGain = 2.0
+)
+
+// MixLevels holds the per-channel gains and ducking envelope used by the mixer
+type MixLevels struct {
+	Voice         float64 `json:"voice"`           // Linear gain, 0-2
+	Music         float64 `json:"music"`           // Linear gain, 0-2
+	Effects       float64 `json:"effects"`         // Linear gain, 0-2
+	Ducking       float64 `json:"ducking"`         // Music gain multiplier while voice is active, 0-1
+	DuckAttackMs  int     `json:"duck_attack_ms"`  // Time to fade music down when voice starts
+	DuckReleaseMs int     `json:"duck_release_ms"` // Time to fade music back up after voice stops
+}
+
+// DefaultMixLevels returns unity gain with gentle ducking
+func DefaultMixLevels() MixLevels {
+	return MixLevels{
+		Voice:         1.0,
+		Music:         1.0,
+		Effects:       1.0,
+		Ducking:       0.2,
+		DuckAttackMs:  60,
+		DuckReleaseMs: 500,
+	}
+}
+
+// Validate checks that all levels are within range
+func (l MixLevels) Validate() error {
+	for name, gain := range map[string]float64{"voice": l.Voice, "music": l.Music, "effects": l.Effects} {
+		if gain < 0 || gain > maxChannelGain || math.IsNaN(gain) {
+			return fmt.Errorf("%s gain must be between 0 and %.1f", name, maxChannelGain)
+		}
+	}
+	if l.Ducking < 0 || l.Ducking > 1 || math.IsNaN(l.Ducking) {
+		return fmt.Errorf("ducking must be between 0 and 1")
+	}
+	if l.DuckAttackMs < 0 || l.DuckReleaseMs < 0 {
+		return fmt.Errorf("ducking attack and release must not be negative")
+	}
+	return nil
+}
+
+// gainRamp moves a gain linearly toward a target, one sample frame at a time
+type gainRamp struct {
+	value float64
+}
+
+// next advances the ramp by one step toward target and returns the new gain
+func (r *gainRamp) next(target, step float64) float64 {
+	switch {
+	case step <= 0:
+		r.value = target
+	case r.value < target:
+		r.value = math.Min(r.value+step, target)
+	case r.value > target:
+		r.value = math.Max(r.value-step, target)
+	}
+	return r.value
+}
+
+// rampStep returns the per-sample-frame increment needed to travel span over ms milliseconds.
+func rampStep(span float64, ms int) float64 {
+	frames := ms * SampleRate / 1000
+	if frames <= 0 {
+		return 0
+	}
+	return math.Abs(span) / float64(frames)
+}
+
+// SoftLimit compresses a sample (as a fraction of full scale) smoothly toward ±1 instead of hard clipping.
+// Below limiterThreshold the signal is untouched; above it a tanh knee keeps the output strictly below full scale.
+func SoftLimit(x float64) float64 {
+	a := math.Abs(x)
+	if a <= limiterThreshold {
+		return x
+	}
+	knee := 1 - limiterThreshold
+	y := limiterThreshold + knee*math.Tanh((a-limiterThreshold)/knee)
+	return math.Copysign(y, x)
+}
+
+// mixState holds the envelopes that persist across frames
+type mixState struct {
+	voiceGain   gainRamp
+	musicGain   gainRamp
+	effectsGain gainRamp
+	duck        gainRamp
+}
+
+func newMixState(levels MixLevels) *mixState {
+	return &mixState{
+		voiceGain:   gainRamp{value: levels.Voice},
+		musicGain:   gainRamp{value: levels.Music},
+		effectsGain: gainRamp{value: levels.Effects},
+		duck:        gainRamp{value: 1.0},
+	}
+}
+
+// voiceAtUnity reports whether voice is currently played at exactly unity gain, so a voice-only
+// frame would come out of the mix unchanged (apart from the limiter).
+func (s *mixState) voiceAtUnity(levels MixLevels) bool {
+	return levels.Voice == 1 && s.voiceGain.value == 1
+}
+
+// mixFrame mixes one interleaved stereo frame from each source (nil if absent) into out.
+// Music is ducked with attack/release ramps while voice is present, and the sum is soft limited.
+func (s *mixState) mixFrame(out, voice, music, effects []int16, levels MixLevels) {
+	duckTarget := 1.0
+	duckStep := rampStep(1-levels.Ducking, levels.DuckReleaseMs)
+	if voice != nil {
+		duckTarget = levels.Ducking
+		duckStep = rampStep(1-levels.Ducking, levels.DuckAttackMs)
+	}
+	gainStep := rampStep(maxChannelGain, gainRampMs)
+
+	frames := len(out) / Channels
+	for f := 0; f < frames; f++ {
+		duck := s.duck.next(duckTarget, duckStep)
+		vGain := s.voiceGain.next(levels.Voice, gainStep)
+		mGain := s.musicGain.next(levels.Music, gainStep) * duck
+		eGain := s.effectsGain.next(levels.Effects, gainStep)
+
+		for c := 0; c < Channels; c++ {
+			i := f*Channels + c
+			var sum float64
+			if i < len(voice) {
+				sum += float64(voice[i]) * vGain
+			}
+			if i < len(music) {
+				sum += float64(music[i]) * mGain
+			}
+			if i < len(effects) {
+				sum += float64(effects[i]) * eGain
+			}
+			out[i] = int16(math.Round(SoftLimit(sum/32768) * 32767))
+		}
+	}
+}
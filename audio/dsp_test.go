@@ -0,0 +1,147 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSoftLimit(t *testing.T) {
+	for _, x := range []float64{0, 0.25, -0.5, limiterThreshold, -limiterThreshold} {
+		if got := SoftLimit(x); got != x {
+			t.Errorf("SoftLimit(%v) = %v, want it untouched below the threshold", x, got)
+		}
+	}
+
+	prev := SoftLimit(limiterThreshold)
+	for _, x := range []float64{0.85, 0.9, 1, 1.5, 2} {
+		got := SoftLimit(x)
+		if got <= prev || got >= 1 {
+			t.Errorf("SoftLimit(%v) = %v, want strictly increasing and below 1 (previous %v)", x, got, prev)
+		}
+		if neg := SoftLimit(-x); neg != -got {
+			t.Errorf("SoftLimit(%v) = %v, want %v", -x, neg, -got)
+		}
+		prev = got
+	}
+
+	// Far beyond full scale the knee saturates but never overshoots
+	for _, x := range []float64{10, 1000, math.Inf(1)} {
+		if got := SoftLimit(x); got < prev || got > 1 {
+			t.Errorf("SoftLimit(%v) = %v, want between %v and 1", x, got, prev)
+		}
+	}
+}
+
+func TestGainRamp(t *testing.T) {
+	r := gainRamp{value: 1}
+	if got := r.next(0, 0.25); got != 0.75 {
+		t.Fatalf("first step = %v, want 0.75", got)
+	}
+	for i := 0; i < 10; i++ {
+		r.next(0, 0.25)
+	}
+	if r.value != 0 {
+		t.Fatalf("ramp settled at %v, want exactly 0", r.value)
+	}
+	if got := r.next(2, 0.3); math.Abs(got-0.3) > 1e-12 {
+		t.Fatalf("upward step = %v, want 0.3", got)
+	}
+	if got := r.next(1.5, 0); got != 1.5 {
+		t.Fatalf("zero step = %v, want an immediate jump to 1.5", got)
+	}
+
+	// A full-span ramp covers its span in exactly gainRampMs
+	step := rampStep(1, gainRampMs)
+	frames := gainRampMs * SampleRate / 1000
+	if got := step * float64(frames); math.Abs(got-1) > 1e-9 {
+		t.Fatalf("rampStep covers %v over %dms, want 1", got, gainRampMs)
+	}
+	if got := rampStep(1, 0); got != 0 {
+		t.Fatalf("rampStep over 0ms = %v, want 0", got)
+	}
+}
+
+func TestMixFrameAppliesSteadyGain(t *testing.T) {
+	levels := DefaultMixLevels()
+	levels.Voice = 0.5
+	state := newMixState(levels)
+
+	out := make([]int16, FrameSize*Channels)
+	state.mixFrame(out, constantFrame(10000), nil, nil, levels)
+	for i, v := range out {
+		if math.Abs(float64(v)-5000) > 2 {
+			t.Fatalf("sample %d = %d, want about 5000", i, v)
+		}
+	}
+}
+
+func TestMixFrameRampsGainChanges(t *testing.T) {
+	levels := DefaultMixLevels()
+	state := newMixState(levels)
+	levels.Music = 0
+
+	out := make([]int16, FrameSize*Channels)
+	state.mixFrame(out, nil, constantFrame(10000), nil, levels)
+
+	if out[0] < 9900 {
+		t.Fatalf("first sample = %d, want the old gain to fade out rather than cut", out[0])
+	}
+	for f := 1; f < FrameSize; f++ {
+		if out[f*Channels] > out[(f-1)*Channels] {
+			t.Fatalf("sample frame %d rose from %d to %d while fading out", f, out[(f-1)*Channels], out[f*Channels])
+		}
+	}
+	// Music gain can travel its whole 0-2 range in gainRampMs, so 1 -> 0 is done in half that
+	done := gainRampMs * SampleRate / 1000 / 2
+	for f := done; f < FrameSize; f++ {
+		if out[f*Channels] != 0 {
+			t.Fatalf("sample frame %d = %d, want silence once the ramp is done", f, out[f*Channels])
+		}
+	}
+}
+
+func TestMixLevelsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*MixLevels)
+		ok     bool
+	}{
+		{"defaults", func(*MixLevels) {}, true},
+		{"max gain", func(l *MixLevels) { l.Music = maxChannelGain }, true},
+		{"muted", func(l *MixLevels) { l.Voice, l.Ducking = 0, 0 }, true},
+		{"gain too high", func(l *MixLevels) { l.Effects = maxChannelGain + 0.1 }, false},
+		{"negative gain", func(l *MixLevels) { l.Voice = -0.1 }, false},
+		{"NaN gain", func(l *MixLevels) { l.Music = math.NaN() }, false},
+		{"ducking above 1", func(l *MixLevels) { l.Ducking = 1.5 }, false},
+		{"negative release", func(l *MixLevels) { l.DuckReleaseMs = -1 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := DefaultMixLevels()
+			tt.modify(&levels)
+			if err := levels.Validate(); (err == nil) != tt.ok {
+				t.Fatalf("Validate() = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGuildMixLevelsSurviveRejoin(t *testing.T) {
+	const guildID = "levels-guild"
+	t.Cleanup(func() {
+		guildLevelsMu.Lock()
+		delete(guildLevels, guildID)
+		guildLevelsMu.Unlock()
+	})
+
+	if got := GuildMixLevels(guildID); got != DefaultMixLevels() {
+		t.Fatalf("unsaved guild levels = %+v, want the defaults", got)
+	}
+
+	levels := DefaultMixLevels()
+	levels.Music = 0.3
+	SaveGuildMixLevels(guildID, levels)
+	if got := GuildMixLevels(guildID); got != levels {
+		t.Fatalf("saved guild levels = %+v, want %+v", got, levels)
+	}
+}
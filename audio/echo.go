@@ -0,0 +1,455 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+const (
+	// The canceller runs on 16kHz mono, which covers speech and keeps the filter cheap
+	echoRate       = 16000
+	echoDecimation = SampleRate / echoRate
+	echoFrame      = FrameSize / echoDecimation // 320 samples per 20ms
+
+	// echoReferenceMs is how much mixer output is kept for alignment with late mic packets
+	echoReferenceMs = 2000
+
+	// echoLowpassTaps is the anti-aliasing filter length used before decimating to 16kHz
+	echoLowpassTaps = 48
+)
+
+// EchoConfig tunes the acoustic echo canceller. Zero fields fall back to DefaultEchoConfig.
+type EchoConfig struct {
+	Disabled      bool    `json:"disabled"`       // Fall back to the barge-in RMS gate while Dexter is talking
+	FilterMs      int     `json:"filter_ms"`      // Echo tail covered by the adaptive filter
+	DelayMs       int     `json:"delay_ms"`       // Bulk delay between sending audio and hearing it back
+	StepSize      float64 `json:"step_size"`      // NLMS adaptation rate, 0-1
+	DoubleTalkMul float64 `json:"double_talk"`    // Freeze adaptation when the mic exceeds this times the reference peak
+	MinRefLevelDB float64 `json:"min_ref_level"`  // Below this reference level (dBFS) the mic is passed through untouched
+	Regularizer   float64 `json:"regularization"` // Added to the reference power to keep the step bounded in quiet passages
+}
+
+// DefaultEchoConfig returns settings suited to a user's speakers feeding back into their mic over Discord
+func DefaultEchoConfig() EchoConfig {
+	return EchoConfig{
+		FilterMs:      200,
+		DelayMs:       60,
+		StepSize:      0.3,
+		DoubleTalkMul: 0.8,
+		MinRefLevelDB: -60,
+		Regularizer:   1e-3,
+	}
+}
+
+// Merge returns c with every non-zero field of override applied on top
+func (c EchoConfig) Merge(override EchoConfig) EchoConfig {
+	c.Disabled = override.Disabled
+	if override.FilterMs != 0 {
+		c.FilterMs = override.FilterMs
+	}
+	if override.DelayMs != 0 {
+		c.DelayMs = override.DelayMs
+	}
+	if override.StepSize != 0 {
+		c.StepSize = override.StepSize
+	}
+	if override.DoubleTalkMul != 0 {
+		c.DoubleTalkMul = override.DoubleTalkMul
+	}
+	if override.MinRefLevelDB != 0 {
+		c.MinRefLevelDB = override.MinRefLevelDB
+	}
+	if override.Regularizer != 0 {
+		c.Regularizer = override.Regularizer
+	}
+	return c
+}
+
+var (
+	echoMu     sync.RWMutex
+	echoConfig = DefaultEchoConfig()
+)
+
+// ConfigureEcho sets the echo canceller settings (merged onto the defaults)
+func ConfigureEcho(cfg EchoConfig) {
+	echoMu.Lock()
+	defer echoMu.Unlock()
+	echoConfig = DefaultEchoConfig().Merge(cfg)
+}
+
+// GetEchoConfig returns the current echo canceller settings
+func GetEchoConfig() EchoConfig {
+	echoMu.RLock()
+	defer echoMu.RUnlock()
+	return echoConfig
+}
+
+// decimator low-pass filters 48kHz mono and keeps every third sample
+type decimator struct {
+	history []float64
+}
+
+var echoLowpass = buildEchoLowpass()
+
+// buildEchoLowpass designs a Hann-windowed sinc with its cutoff just below the 8kHz Nyquist of the output
+func buildEchoLowpass() []float64 {
+	cutoff := 0.9 / echoDecimation
+	taps := make([]float64, echoLowpassTaps)
+	mid := float64(echoLowpassTaps-1) / 2
+	var sum float64
+	for i := range taps {
+		x := float64(i) - mid
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*cutoff*x) / (math.Pi * cutoff * x)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(echoLowpassTaps-1))
+		taps[i] = sinc * window
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+	return taps
+}
+
+func (d *decimator) process(in []float64) []float64 {
+	buf := append(d.history, in...)
+	out := make([]float64, 0, len(in)/echoDecimation)
+	start := len(d.history)
+	for i := start; i < len(buf); i += echoDecimation {
+		var acc float64
+		for k, tap := range echoLowpass {
+			if j := i - k; j >= 0 {
+				acc += buf[j] * tap
+			}
+		}
+		out = append(out, acc)
+	}
+	keep := echoLowpassTaps
+	if len(buf) < keep {
+		keep = len(buf)
+	}
+	d.history = append([]float64(nil), buf[len(buf)-keep:]...)
+	return out
+}
+
+// EchoReference holds recent mixer output at 16kHz, timestamped, as the far-end signal for echo cancellation
+type EchoReference struct {
+	mu      sync.Mutex
+	samples []float64 // Ring of the last echoReferenceMs
+	pos     int       // Next write index
+	end     time.Time // Time the last written sample finished playing
+	dec     decimator
+}
+
+// NewEchoReference creates an empty reference buffer
+func NewEchoReference() *EchoReference {
+	return &EchoReference{samples: make([]float64, echoReferenceMs*echoRate/1000)}
+}
+
+// Push records a 20ms stereo frame that finished being sent at time at. Gaps since the previous
+// frame (the mixer idles when nothing plays) are filled with silence.
+func (r *EchoReference) Push(frame []int16, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.end.IsZero() {
+		gap := int(at.Sub(r.end).Seconds()*echoRate) - echoFrame
+		if gap > len(r.samples) {
+			gap = len(r.samples)
+		}
+		for i := 0; i < gap; i++ {
+			r.write(0)
+		}
+	}
+
+	for _, s := range r.dec.process(downmix(frame)) {
+		r.write(s)
+	}
+	r.end = at
+}
+
+func (r *EchoReference) write(s float64) {
+	r.samples[r.pos] = s
+	r.pos = (r.pos + 1) % len(r.samples)
+}
+
+// Read returns n samples ending at time end; anything outside the buffered window is silence
+func (r *EchoReference) Read(end time.Time, n int) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]float64, n)
+	if r.end.IsZero() {
+		return out
+	}
+
+	// Samples between end and the newest written sample
+	lag := int(r.end.Sub(end).Seconds() * echoRate)
+	for i := 0; i < n; i++ {
+		back := lag + (n - 1 - i) // How far behind the newest sample this output sample is
+		if back < 0 || back >= len(r.samples) {
+			continue
+		}
+		idx := (r.pos - 1 - back + 2*len(r.samples)) % len(r.samples)
+		out[i] = r.samples[idx]
+	}
+	return out
+}
+
+// EchoCanceller removes Dexter's own output, as picked up by one user's microphone, with an
+// adaptive filter driven by the mixer's output. The filter is split into echoBlock-sample
+// partitions adapted in the frequency domain (partitioned-block NLMS), which covers a 200ms tail
+// for a fraction of the cost of a sample-by-sample update. Adaptation is frozen during double
+// talk (Geigel detector) so the filter does not learn the user's voice.
+type EchoCanceller struct {
+	cfg     EchoConfig
+	weights [][]complex128 // Frequency response of each partition, newest first
+	spectra [][]complex128 // Reference spectra of the last len(weights) blocks; spectra[head] is the newest
+	energy  []float64      // Reference energy of each block in spectra
+	peaks   []float64      // Peak reference level of each block in spectra, for the double-talk detector
+	head    int
+	power   []float64 // Per-bin reference power summed over spectra
+	xPower  float64   // Reference energy over the filter span
+	prevFar []float64 // Previous reference block, the first half of each overlap-save window
+	next    int       // Partition whose impulse response is trimmed to echoBlock taps next
+	cursor  time.Time // End time of the last reference frame consumed
+	dec     decimator
+	lastOut float64 // Last 16kHz output sample, where interpolation of the next frame starts
+
+	// Smoothed mic and output energy while only Dexter is heard, for the echo return loss enhancement
+	nearPower     float64
+	residualPower float64
+}
+
+const (
+	// echoBlock is the partition length and adaptation interval (4ms at 16kHz); it divides echoFrame
+	echoBlock   = 64
+	echoFFTSize = 2 * echoBlock // Overlap-save window
+	echoBins    = echoFFTSize/2 + 1
+
+	// echoConvergedERLEDB is how much the canceller must be reducing echo before its output is
+	// trusted without the barge-in gate
+	echoConvergedERLEDB = 10
+)
+
+// NewEchoCanceller creates a canceller with the given settings
+func NewEchoCanceller(cfg EchoConfig) *EchoCanceller {
+	cfg = DefaultEchoConfig().Merge(cfg)
+	partitions := (cfg.FilterMs*echoRate/1000 + echoBlock - 1) / echoBlock
+	if partitions < 1 {
+		partitions = 1
+	}
+	ec := &EchoCanceller{
+		cfg:     cfg,
+		weights: make([][]complex128, partitions),
+		spectra: make([][]complex128, partitions),
+		energy:  make([]float64, partitions),
+		peaks:   make([]float64, partitions),
+		power:   make([]float64, echoBins),
+		prevFar: make([]float64, echoBlock),
+	}
+	for p := range ec.weights {
+		ec.weights[p] = make([]complex128, echoBins)
+		ec.spectra[p] = make([]complex128, echoBins)
+	}
+	return ec
+}
+
+// Converged reports whether the canceller has been removing at least echoConvergedERLEDB of echo
+// while only Dexter was heard. Until then residual echo can still be loud enough to pass as speech.
+func (ec *EchoCanceller) Converged() bool {
+	return ec.nearPower > 0 && ec.nearPower >= ec.residualPower*dbToPower(echoConvergedERLEDB)
+}
+
+// Process removes echo from one 20ms stereo mic frame that arrived at the given time, using
+// ref as the far-end signal. While the reference is silent, or the frame is not a whole 20ms
+// (such as an empty frame), it is returned unchanged.
+func (ec *EchoCanceller) Process(pcm []int16, ref *EchoReference, arrival time.Time) []int16 {
+	if len(pcm) != FrameSize*Channels {
+		return pcm
+	}
+	mic := ec.dec.process(downmix(pcm))
+
+	// Follow the mic stream 20ms at a time, resyncing to the wall clock if packets were lost or bunched
+	want := arrival.Add(-time.Duration(ec.cfg.DelayMs) * time.Millisecond)
+	next := ec.cursor.Add(vadFrameMs * time.Millisecond)
+	if ec.cursor.IsZero() || absDuration(next.Sub(want)) > 3*vadFrameMs*time.Millisecond {
+		next = want
+	}
+	ec.cursor = next
+	far := ref.Read(next, len(mic))
+
+	out := make([]float64, len(mic))
+	minPower := dbToPower(ec.cfg.MinRefLevelDB) * float64(len(ec.weights)*echoBlock)
+	cancelled := false
+
+	for b := 0; b+echoBlock <= len(mic); b += echoBlock {
+		d, e := mic[b:b+echoBlock], out[b:b+echoBlock]
+		ec.pushReference(far[b : b+echoBlock])
+		if ec.xPower < minPower {
+			copy(e, d)
+			continue
+		}
+		cancelled = true
+		ec.cancel(d, e)
+
+		// Geigel double-talk detector: near-end speech louder than any recent far-end sample
+		var nearPeak, farPeak, near, residual float64
+		for i := range d {
+			nearPeak = math.Max(nearPeak, math.Abs(d[i]))
+			near += d[i] * d[i]
+			residual += e[i] * e[i]
+		}
+		for _, peak := range ec.peaks {
+			farPeak = math.Max(farPeak, peak)
+		}
+		if nearPeak > ec.cfg.DoubleTalkMul*farPeak {
+			continue
+		}
+
+		ec.nearPower = 0.99*ec.nearPower + 0.01*near
+		ec.residualPower = 0.99*ec.residualPower + 0.01*residual
+		ec.adapt(e)
+	}
+
+	prev := ec.lastOut
+	ec.lastOut = out[len(out)-1]
+	if !cancelled {
+		// Nothing to cancel; keep full bandwidth
+		return pcm
+	}
+	return upsample(out, prev)
+}
+
+// pushReference transforms the overlap-save window ending with block and makes it the newest partition's input
+func (ec *EchoCanceller) pushReference(block []float64) {
+	window := make([]complex128, echoFFTSize)
+	for i, v := range ec.prevFar {
+		window[i] = complex(v, 0)
+	}
+	var energy, peak float64
+	for i, v := range block {
+		window[echoBlock+i] = complex(v, 0)
+		energy += v * v
+		peak = math.Max(peak, math.Abs(v))
+	}
+	copy(ec.prevFar, block)
+	fft(window)
+
+	// Reuse the oldest slot for the new block
+	ec.head = (ec.head + len(ec.spectra) - 1) % len(ec.spectra)
+	spectrum := ec.spectra[ec.head]
+	for k := range spectrum {
+		ec.power[k] = math.Max(0, ec.power[k]+binPower(window[k])-binPower(spectrum[k]))
+		spectrum[k] = window[k]
+	}
+	ec.xPower = math.Max(0, ec.xPower+energy-ec.energy[ec.head])
+	ec.energy[ec.head] = energy
+	ec.peaks[ec.head] = peak
+}
+
+// cancel writes the mic block d minus the filter's echo estimate to e
+func (ec *EchoCanceller) cancel(d, e []float64) {
+	y := make([]complex128, echoFFTSize)
+	for p, w := range ec.weights {
+		x := ec.spectra[(ec.head+p)%len(ec.spectra)]
+		for k := range w {
+			y[k] += w[k] * x[k]
+		}
+	}
+	mirrorSpectrum(y)
+	ifft(y)
+
+	// The second half of an overlap-save window is the linear convolution
+	for i := range d {
+		e[i] = d[i] - real(y[echoBlock+i])
+	}
+}
+
+// adapt takes one normalised gradient step on every partition from the error block e
+func (ec *EchoCanceller) adapt(e []float64) {
+	g := make([]complex128, echoFFTSize)
+	for i, v := range e {
+		g[echoBlock+i] = complex(v, 0)
+	}
+	fft(g)
+
+	// Per-bin reference power is about twice the time-domain energy over the filter span
+	reg := 2 * ec.cfg.Regularizer
+	for k := 0; k < echoBins; k++ {
+		g[k] *= complex(ec.cfg.StepSize/(ec.power[k]+reg), 0)
+	}
+	for p, w := range ec.weights {
+		x := ec.spectra[(ec.head+p)%len(ec.spectra)]
+		for k := range w {
+			w[k] += cmplx.Conj(x[k]) * g[k]
+		}
+	}
+
+	// Without this the partitions' responses wrap around their windows; trimming one per block
+	// keeps them in check at two transforms per block instead of two per partition
+	w := make([]complex128, echoFFTSize)
+	copy(w, ec.weights[ec.next])
+	mirrorSpectrum(w)
+	ifft(w)
+	for i := range w {
+		if i < echoBlock {
+			w[i] = complex(real(w[i]), 0)
+		} else {
+			w[i] = 0
+		}
+	}
+	fft(w)
+	copy(ec.weights[ec.next], w[:echoBins])
+	ec.next = (ec.next + 1) % len(ec.weights)
+}
+
+// mirrorSpectrum fills the upper half of a real signal's spectrum from its first echoBins bins
+func mirrorSpectrum(x []complex128) {
+	for k := 1; k < echoFFTSize/2; k++ {
+		x[echoFFTSize-k] = cmplx.Conj(x[k])
+	}
+}
+
+// ifft is the inverse of fft, scaled so that ifft(fft(x)) == x
+func ifft(x []complex128) {
+	for i := range x {
+		x[i] = cmplx.Conj(x[i])
+	}
+	fft(x)
+	scale := complex(1/float64(len(x)), 0)
+	for i := range x {
+		x[i] = cmplx.Conj(x[i]) * scale
+	}
+}
+
+func binPower(c complex128) float64 {
+	return real(c)*real(c) + imag(c)*imag(c)
+}
+
+// upsample linearly interpolates 16kHz mono back to 48kHz stereo, starting from the previous frame's last sample
+func upsample(in []float64, prev float64) []int16 {
+	out := make([]int16, len(in)*echoDecimation*Channels)
+	for i, s := range in {
+		for j := 0; j < echoDecimation; j++ {
+			frac := float64(j+1) / echoDecimation
+			v := floatToInt16(prev + (s-prev)*frac)
+			idx := (i*echoDecimation + j) * Channels
+			out[idx] = v
+			out[idx+1] = v
+		}
+		prev = s
+	}
+	return out
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// noiseFrames returns frames of white noise with the given RMS (as a fraction of full scale)
+func noiseFrames(rng *rand.Rand, frames int, level float64) [][]int16 {
+	out := make([][]int16, frames)
+	for f := range out {
+		frame := make([]int16, FrameSize*Channels)
+		for i := 0; i < FrameSize; i++ {
+			v := clampInt16(rng.NormFloat64() * level * 32768)
+			frame[i*Channels] = v
+			frame[i*Channels+1] = v
+		}
+		out[f] = frame
+	}
+	return out
+}
+
+// runEcho plays far through a mixer's echo reference and feeds the canceller mic frames holding
+// far attenuated by gain and delayed by delay sample frames (on top of DelayMs), plus near (nil for none).
+// It returns the mic frames and what the canceller made of them.
+func runEcho(ec *EchoCanceller, far, near [][]int16, gain float64, delay int) (mic, out [][]int16) {
+	ref := NewEchoReference()
+	start := time.Unix(1700000000, 0)
+	history := make([]int16, delay*Channels)
+
+	for i, frame := range far {
+		sent := start.Add(time.Duration(i+1) * frameDuration)
+		ref.Push(frame, sent)
+
+		history = append(history, frame...)
+		in := make([]int16, FrameSize*Channels)
+		for j := range in {
+			v := float64(history[j]) * gain
+			if near != nil {
+				v += float64(near[i][j])
+			}
+			in[j] = clampInt16(v)
+		}
+		history = history[len(in):]
+
+		arrival := sent.Add(time.Duration(ec.cfg.DelayMs) * time.Millisecond)
+		mic = append(mic, in)
+		out = append(out, ec.Process(in, ref, arrival))
+	}
+	return mic, out
+}
+
+// powerDB returns the mean power of frames[from:to] in dBFS
+func powerDB(frames [][]int16, from, to int) float64 {
+	var sum float64
+	var n int
+	for _, frame := range frames[from:to] {
+		for _, v := range frame {
+			sum += float64(v) * float64(v)
+		}
+		n += len(frame)
+	}
+	return powerToDB(sum / float64(n) / (32768 * 32768))
+}
+
+func TestEchoCancellerRemovesEcho(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ec := NewEchoCanceller(EchoConfig{})
+	far := noiseFrames(rng, 200, 0.1)
+
+	// A quieter, 5ms later copy of what Dexter played
+	mic, out := runEcho(ec, far, nil, 0.6, 240)
+
+	// Over the last second
+	erle := powerDB(mic, 150, 200) - powerDB(out, 150, 200)
+	if erle < 20 {
+		t.Fatalf("echo reduced by %.1fdB, want at least 20dB", erle)
+	}
+	if !ec.Converged() {
+		t.Fatalf("canceller reducing echo by %.1fdB does not report convergence", erle)
+	}
+}
+
+func TestEchoCancellerKeepsNearEndSpeech(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	ec := NewEchoCanceller(EchoConfig{})
+	far := noiseFrames(rng, 250, 0.1)
+
+	// The first utterance in speech.wav runs from 0.5-2.0s; start it 3s in, once the filter has converged
+	speech := loadFixture(t, "speech.wav")
+	near := make([][]int16, len(far))
+	for i := range near {
+		near[i] = make([]int16, FrameSize*Channels)
+		if j := i - 150 + 25; i >= 150 && j < 100 {
+			for k, v := range speech[j*FrameSize*Channels : (j+1)*FrameSize*Channels] {
+				near[i][k] = clampInt16(float64(v) * 3)
+			}
+		}
+	}
+
+	mic, out := runEcho(ec, far, near, 0.6, 240)
+
+	// Double talk: the user's speech comes through at its own level, not cancelled and not buried in echo
+	nearDB := powerDB(near, 160, 210)
+	if got := powerDB(out, 160, 210); got < nearDB-1 || got > nearDB+1 {
+		t.Fatalf("output during double talk = %.1fdBFS, want about the near-end speech's %.1fdBFS (mic %.1fdBFS)",
+			got, nearDB, powerDB(mic, 160, 210))
+	}
+
+	// The filter did not learn the user's voice, so echo is still cancelled afterwards
+	if erle := powerDB(mic, 230, 250) - powerDB(out, 230, 250); erle < 15 {
+		t.Fatalf("echo reduced by %.1fdB after double talk, want at least 15dB", erle)
+	}
+}
+
+func TestEchoCancellerPassesThroughOtherFrames(t *testing.T) {
+	ec := NewEchoCanceller(EchoConfig{})
+	ref := NewEchoReference()
+	now := time.Unix(1700000000, 0)
+
+	for _, frame := range [][]int16{nil, {}, {1, 2}, make([]int16, FrameSize)} {
+		if got := ec.Process(frame, ref, now); len(got) != len(frame) {
+			t.Fatalf("Process of a %d sample frame returned %d samples", len(frame), len(got))
+		}
+	}
+
+	// Without a reference there is nothing to cancel and the frame keeps full bandwidth
+	frame := tone(1, 440, 8000)[0]
+	got := ec.Process(frame, ref, now)
+	if &got[0] != &frame[0] {
+		t.Fatal("Process altered a frame while Dexter was silent")
+	}
+	if math.IsNaN(ec.nearPower) || ec.Converged() {
+		t.Fatal("canceller adapted without a reference")
+	}
+}
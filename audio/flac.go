@@ -0,0 +1,245 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	flacBlockSize = 4096
+	flacMaxOrder  = 4  // Highest fixed predictor order
+	flacMaxRice   = 14 // 15 is the escape code in 4-bit Rice parameters
+)
+
+// EncodeFLAC writes interleaved 16-bit PCM as a FLAC stream. Each block uses whichever of the
+// fixed polynomial predictors (orders 0-4) leaves the smallest residual, Rice coded. That gets
+// most of the way to libFLAC's ratio on speech without LPC analysis.
+func EncodeFLAC(w io.Writer, pcm []int16, rate, numChannels int) error {
+	if numChannels < 1 || numChannels > 8 {
+		return fmt.Errorf("flac: unsupported channel count %d", numChannels)
+	}
+	if rate <= 0 || rate >= 1<<20 {
+		return fmt.Errorf("flac: unsupported sample rate %d", rate)
+	}
+	frames := len(pcm) / numChannels
+
+	// Stream marker and STREAMINFO (the last and only metadata block)
+	info := make([]byte, 4+4+34)
+	copy(info, "fLaC")
+	info[4] = 0x80 // Last metadata block, type 0
+	info[7] = 34
+	binary.BigEndian.PutUint16(info[8:10], flacBlockSize)
+	binary.BigEndian.PutUint16(info[10:12], flacBlockSize)
+	// Min/max frame size (bytes 12-17) and the MD5 (bytes 26-41) are left as unknown
+	packed := uint64(rate)<<44 | uint64(numChannels-1)<<41 | uint64(16-1)<<36 | uint64(frames)&(1<<36-1)
+	binary.BigEndian.PutUint64(info[18:26], packed)
+	if _, err := w.Write(info); err != nil {
+		return err
+	}
+
+	residual := make([]int64, flacBlockSize)
+	channel := make([]int64, flacBlockSize)
+	for start, frameNum := 0, uint64(0); start < frames; start, frameNum = start+flacBlockSize, frameNum+1 {
+		size := min(flacBlockSize, frames-start)
+		var bw flacBitWriter
+
+		// Frame header: fixed block size, block size as 16 bits at the end, rate from STREAMINFO
+		bw.write(0x3FFE, 14)
+		bw.write(0, 2)
+		bw.write(0x7, 4)
+		bw.write(0x0, 4)
+		bw.write(uint64(numChannels-1), 4) // Independent channels
+		bw.write(0x4, 3)                   // 16 bits per sample
+		bw.write(0, 1)
+		bw.writeUTF8(frameNum)
+		bw.write(uint64(size-1), 16)
+		bw.write(uint64(flacCRC8(bw.bytes())), 8)
+
+		for ch := 0; ch < numChannels; ch++ {
+			for i := 0; i < size; i++ {
+				channel[i] = int64(pcm[(start+i)*numChannels+ch])
+			}
+			writeFLACSubframe(&bw, channel[:size], residual[:size])
+		}
+
+		bw.align()
+		bw.write(uint64(flacCRC16(bw.bytes())), 16)
+		if _, err := w.Write(bw.bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFLACSubframe codes one channel of a block with the best fixed predictor
+func writeFLACSubframe(bw *flacBitWriter, samples, residual []int64) {
+	bestOrder, bestCost := 0, uint64(math.MaxUint64)
+	for order := 0; order <= flacMaxOrder && order < len(samples); order++ {
+		fixedResidual(samples, order, residual)
+		if cost := sumAbs(residual[order:]); cost < bestCost {
+			bestOrder, bestCost = order, cost
+		}
+	}
+	if len(samples) <= flacMaxOrder {
+		// Too short to predict; store verbatim
+		bw.write(0x01<<1, 8)
+		for _, s := range samples {
+			bw.writeSigned(s, 16)
+		}
+		return
+	}
+
+	order := bestOrder
+	fixedResidual(samples, order, residual)
+	bw.write(uint64(0x08|order)<<1, 8) // Subframe type FIXED, no wasted bits
+	for _, s := range samples[:order] {
+		bw.writeSigned(s, 16)
+	}
+
+	res := residual[order:len(samples)]
+	k := bestRiceParam(res)
+	bw.write(0, 2) // Rice coding, 4-bit parameters
+	bw.write(0, 4) // Partition order 0
+	bw.write(uint64(k), 4)
+	for _, r := range res {
+		u := uint64(r<<1) ^ uint64(r>>63) // Zigzag
+		bw.writeUnary(u >> k)
+		bw.write(u&(1<<k-1), k)
+	}
+}
+
+// fixedResidual fills residual[order:] with the error of the order-n polynomial predictor
+func fixedResidual(s []int64, order int, residual []int64) {
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 0:
+			residual[i] = s[i]
+		case 1:
+			residual[i] = s[i] - s[i-1]
+		case 2:
+			residual[i] = s[i] - 2*s[i-1] + s[i-2]
+		case 3:
+			residual[i] = s[i] - 3*s[i-1] + 3*s[i-2] - s[i-3]
+		case 4:
+			residual[i] = s[i] - 4*s[i-1] + 6*s[i-2] - 4*s[i-3] + s[i-4]
+		}
+	}
+}
+
+func sumAbs(x []int64) uint64 {
+	var sum uint64
+	for _, v := range x {
+		if v < 0 {
+			v = -v
+		}
+		sum += uint64(v)
+	}
+	return sum
+}
+
+// bestRiceParam returns the Rice parameter giving the fewest bits for the residual
+func bestRiceParam(res []int64) uint {
+	best, bestBits := uint(0), uint64(math.MaxUint64)
+	for k := uint(0); k <= flacMaxRice; k++ {
+		bits := uint64(len(res)) * uint64(k+1)
+		for _, r := range res {
+			bits += (uint64(r<<1) ^ uint64(r>>63)) >> k
+		}
+		if bits < bestBits {
+			best, bestBits = k, bits
+		}
+	}
+	return best
+}
+
+// flacBitWriter packs big-endian bit fields
+type flacBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (b *flacBitWriter) write(v uint64, n uint) {
+	for n > 0 {
+		take := min(n, 32)
+		n -= take
+		b.acc = b.acc<<take | (v>>n)&(1<<take-1)
+		b.nbits += take
+		for b.nbits >= 8 {
+			b.nbits -= 8
+			b.buf = append(b.buf, byte(b.acc>>b.nbits))
+		}
+	}
+}
+
+func (b *flacBitWriter) writeSigned(v int64, n uint) {
+	b.write(uint64(v)&(1<<n-1), n)
+}
+
+func (b *flacBitWriter) writeUnary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		b.write(0, 32)
+	}
+	b.write(1, uint(q)+1)
+}
+
+// writeUTF8 writes a frame number in FLAC's extended UTF-8 coding
+func (b *flacBitWriter) writeUTF8(v uint64) {
+	if v < 0x80 {
+		b.write(v, 8)
+		return
+	}
+	n := 2 // Total bytes
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	lead := uint64(0xFF00>>n) & 0xFF
+	b.write(lead|v>>(6*(n-1)), 8)
+	for i := n - 2; i >= 0; i-- {
+		b.write(0x80|(v>>(6*i))&0x3F, 8)
+	}
+}
+
+func (b *flacBitWriter) align() {
+	if b.nbits > 0 {
+		b.write(0, 8-b.nbits)
+	}
+}
+
+func (b *flacBitWriter) bytes() []byte {
+	return b.buf
+}
+
+// flacCRC8 is CRC-8 with polynomial 0x07, used for frame headers
+func flacCRC8(data []byte) byte {
+	var crc byte
+	for _, d := range data {
+		crc ^= d
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// flacCRC16 is CRC-16 with polynomial 0x8005, covering a whole frame
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, d := range data {
+		crc ^= uint16(d) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// flacBitReader reads big-endian bit fields
+type flacBitReader struct {
+	data []byte
+	bit  int
+}
+
+func (r *flacBitReader) read(n int) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		b := r.data[r.bit/8] >> (7 - r.bit%8) & 1
+		v = v<<1 | uint64(b)
+		r.bit++
+	}
+	return v
+}
+
+func (r *flacBitReader) readSigned(n int) int64 {
+	v := int64(r.read(n))
+	if v&(1<<(n-1)) != 0 {
+		v -= 1 << n
+	}
+	return v
+}
+
+func (r *flacBitReader) readUTF8() uint64 {
+	first := r.read(8)
+	n := 0
+	for first&(0x80>>n) != 0 {
+		n++
+	}
+	if n == 0 {
+		return first
+	}
+	v := first & (0xFF >> (n + 1))
+	for i := 1; i < n; i++ {
+		v = v<<6 | r.read(8)&0x3F
+	}
+	return v
+}
+
+// decodeFLAC decodes the subset of FLAC that EncodeFLAC writes: fixed block size,
+// independent channels, 16-bit samples, VERBATIM and FIXED subframes with one Rice partition.
+func decodeFLAC(t *testing.T, data []byte) (pcm []int16, rate, numChannels int) {
+	t.Helper()
+	if string(data[0:4]) != "fLaC" || data[4] != 0x80 {
+		t.Fatal("missing stream marker or STREAMINFO")
+	}
+	packed := binary.BigEndian.Uint64(data[18:26])
+	rate = int(packed >> 44)
+	numChannels = int(packed>>41&0x7) + 1
+	total := int(packed & (1<<36 - 1))
+
+	r := &flacBitReader{data: data, bit: 42 * 8}
+	for frameNum := uint64(0); len(pcm) < total*numChannels; frameNum++ {
+		frameStart := r.bit / 8
+		if sync := r.read(14); sync != 0x3FFE {
+			t.Fatalf("frame %d: bad sync %#x", frameNum, sync)
+		}
+		r.read(2 + 4 + 4)
+		if ch := int(r.read(4)) + 1; ch != numChannels {
+			t.Fatalf("frame %d: %d channels, want %d", frameNum, ch, numChannels)
+		}
+		r.read(3 + 1)
+		if n := r.readUTF8(); n != frameNum {
+			t.Fatalf("frame number = %d, want %d", n, frameNum)
+		}
+		size := int(r.read(16)) + 1
+		if crc := byte(r.read(8)); crc != flacCRC8(data[frameStart:r.bit/8-1]) {
+			t.Fatalf("frame %d: header CRC mismatch", frameNum)
+		}
+
+		channels := make([][]int64, numChannels)
+		for ch := range channels {
+			channels[ch] = decodeFLACSubframe(t, r, size)
+		}
+		r.bit = (r.bit + 7) / 8 * 8
+		if crc := uint16(r.read(16)); crc != flacCRC16(data[frameStart:r.bit/8-2]) {
+			t.Fatalf("frame %d: frame CRC mismatch", frameNum)
+		}
+
+		for i := 0; i < size; i++ {
+			for ch := range channels {
+				pcm = append(pcm, int16(channels[ch][i]))
+			}
+		}
+	}
+	if r.bit/8 != len(data) {
+		t.Fatalf("%d trailing bytes after the last frame", len(data)-r.bit/8)
+	}
+	return pcm, rate, numChannels
+}
+
+func decodeFLACSubframe(t *testing.T, r *flacBitReader, size int) []int64 {
+	t.Helper()
+	header := r.read(8)
+	samples := make([]int64, size)
+	switch kind := header >> 1; {
+	case kind == 0x01:
+		for i := range samples {
+			samples[i] = r.readSigned(16)
+		}
+		return samples
+	case kind&0x38 == 0x08:
+		order := int(kind & 0x7)
+		for i := 0; i < order; i++ {
+			samples[i] = r.readSigned(16)
+		}
+		if method, partitions := r.read(2), r.read(4); method != 0 || partitions != 0 {
+			t.Fatalf("unexpected residual coding %d with partition order %d", method, partitions)
+		}
+		k := int(r.read(4))
+		for i := order; i < size; i++ {
+			var q uint64
+			for r.read(1) == 0 {
+				q++
+			}
+			u := q<<k | r.read(k)
+			res := int64(u>>1) ^ -int64(u&1)
+
+			s := samples
+			switch order {
+			case 0:
+				s[i] = res
+			case 1:
+				s[i] = res + s[i-1]
+			case 2:
+				s[i] = res + 2*s[i-1] - s[i-2]
+			case 3:
+				s[i] = res + 3*s[i-1] - 3*s[i-2] + s[i-3]
+			case 4:
+				s[i] = res + 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+			}
+		}
+		return samples
+	default:
+		t.Fatalf("unexpected subframe header %#x", header)
+		return nil
+	}
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Speech-like tone plus noise and full-scale extremes, with a final block too short to predict
+	frames := 2*flacBlockSize + 3
+	tests := []struct {
+		name        string
+		rate        int
+		numChannels int
+	}{
+		{"16kHz mono", 16000, 1},
+		{"48kHz stereo", SampleRate, Channels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm := make([]int16, frames*tt.numChannels)
+			src := flatten(tone(frames/FrameSize+1, 300, 12000))
+			for i := range pcm {
+				pcm[i] = src[i] + int16(rng.Intn(512)-256)
+			}
+			pcm[10] = 32767
+			pcm[11] = -32768
+
+			var buf bytes.Buffer
+			if err := EncodeFLAC(&buf, pcm, tt.rate, tt.numChannels); err != nil {
+				t.Fatalf("EncodeFLAC: %v", err)
+			}
+			if buf.Len() >= len(pcm)*2 {
+				t.Errorf("encoded %d bytes for %d bytes of PCM, want some compression", buf.Len(), len(pcm)*2)
+			}
+
+			got, rate, numChannels := decodeFLAC(t, buf.Bytes())
+			if rate != tt.rate || numChannels != tt.numChannels {
+				t.Fatalf("STREAMINFO says %dHz %d channels, want %dHz %d", rate, numChannels, tt.rate, tt.numChannels)
+			}
+			if !slices.Equal(got, pcm) {
+				t.Fatal("FLAC did not round trip losslessly")
+			}
+		})
+	}
+}
+
+func TestEncodeFLACRejectsBadFormats(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeFLAC(&buf, nil, 16000, 0); err == nil {
+		t.Error("EncodeFLAC accepted 0 channels")
+	}
+	if err := EncodeFLAC(&buf, nil, 1<<20, 1); err == nil {
+		t.Error("EncodeFLAC accepted a sample rate beyond 20 bits")
+	}
+}
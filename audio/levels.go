@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	guildLevels   = make(map[string]MixLevels)
+	guildLevelsMu sync.Mutex
+	levelsRedis   *redis.Client
+)
+
+// ConfigureMixLevels sets the Redis client used to persist per-guild mixer levels (nil keeps them in memory only).
+func ConfigureMixLevels(rc *redis.Client) {
+	guildLevelsMu.Lock()
+	defer guildLevelsMu.Unlock()
+	levelsRedis = rc
+}
+
+func mixLevelsKey(guildID string) string {
+	return "discord:mixer:levels:" + guildID
+}
+
+// GuildMixLevels returns the levels last saved for a guild, or the defaults.
+func GuildMixLevels(guildID string) MixLevels {
+	guildLevelsMu.Lock()
+	levels, ok := guildLevels[guildID]
+	rc := levelsRedis
+	guildLevelsMu.Unlock()
+	if ok {
+		return levels
+	}
+
+	levels = DefaultMixLevels()
+	if rc == nil {
+		return levels
+	}
+	data, err := rc.Get(context.Background(), mixLevelsKey(guildID)).Bytes()
+	if err != nil {
+		return levels
+	}
+	var saved MixLevels
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Validate() != nil {
+		log.Printf("Mixer [%s]: Ignoring corrupt persisted levels", guildID)
+		return levels
+	}
+
+	guildLevelsMu.Lock()
+	guildLevels[guildID] = saved
+	guildLevelsMu.Unlock()
+	return saved
+}
+
+// SaveGuildMixLevels remembers a guild's levels so they survive leaving and rejoining voice (and restarts, with Redis).
+func SaveGuildMixLevels(guildID string, levels MixLevels) {
+	guildLevelsMu.Lock()
+	guildLevels[guildID] = levels
+	rc := levelsRedis
+	guildLevelsMu.Unlock()
+	if rc == nil {
+		return
+	}
+
+	data, err := json.Marshal(levels)
+	if err != nil {
+		return
+	}
+	if err := rc.Set(context.Background(), mixLevelsKey(guildID), data, 0).Err(); err != nil {
+		log.Printf("Mixer [%s]: Failed to persist levels: %v", guildID, err)
+	}
+}
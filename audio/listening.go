@@ -0,0 +1,235 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListeningMode decides which utterances are transcribed and which transcripts become events
+type ListeningMode string
+
+const (
+	// ListenAlways transcribes and emits everything anyone says
+	ListenAlways ListeningMode = "always"
+	// ListenWakeWord transcribes everything but only emits transcripts once a wake word is heard,
+	// then stays attentive for a while
+	ListenWakeWord ListeningMode = "wake_word"
+	// ListenPushToTalk only transcribes while listening has been turned on by command
+	ListenPushToTalk ListeningMode = "push_to_talk"
+)
+
+// ListeningConfig controls the listening mode. Zero fields fall back to DefaultListeningConfig.
+type ListeningConfig struct {
+	Mode              string   `json:"mode"`                 // always, wake_word or push_to_talk
+	WakeWords         []string `json:"wake_words"`           // Matched as whole words, case-insensitively
+	AttentiveSeconds  int      `json:"attentive_seconds"`    // How long a wake word keeps Dexter listening
+	PushToTalkSeconds int      `json:"push_to_talk_seconds"` // How long /listen keeps Dexter listening in push_to_talk
+}
+
+// DefaultListeningConfig returns always-on listening, with "Dexter" as the wake word for the other modes
+func DefaultListeningConfig() ListeningConfig {
+	return ListeningConfig{
+		Mode:              string(ListenAlways),
+		WakeWords:         []string{"dexter"},
+		AttentiveSeconds:  20,
+		PushToTalkSeconds: 30,
+	}
+}
+
+// Merge returns c with every non-zero field of override applied on top
+func (c ListeningConfig) Merge(override ListeningConfig) ListeningConfig {
+	if override.Mode != "" {
+		c.Mode = override.Mode
+	}
+	if len(override.WakeWords) > 0 {
+		c.WakeWords = override.WakeWords
+	}
+	if override.AttentiveSeconds != 0 {
+		c.AttentiveSeconds = override.AttentiveSeconds
+	}
+	if override.PushToTalkSeconds != 0 {
+		c.PushToTalkSeconds = override.PushToTalkSeconds
+	}
+	return c
+}
+
+// ParseListeningMode accepts a mode name, with "wake" and "ptt" as shorthands
+func ParseListeningMode(name string) (ListeningMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "always", "on":
+		return ListenAlways, nil
+	case "wake_word", "wake", "wakeword":
+		return ListenWakeWord, nil
+	case "push_to_talk", "ptt":
+		return ListenPushToTalk, nil
+	}
+	return "", fmt.Errorf("unknown listening mode %q", name)
+}
+
+var (
+	listenMu       sync.Mutex
+	listenConfig   = DefaultListeningConfig()
+	listenMode     = ListenAlways
+	wakeWordRegexp = compileWakeWords(listenConfig.WakeWords)
+	attentiveUntil = make(map[string]time.Time) // guildID -> end of the listening window
+	admittedSpeech = make(map[string]time.Time) // utterance ID -> when its first segment was let through
+	listenClock    = Clock(systemClock{})       // Time source for listening windows; tests inject a fake
+)
+
+// admittedUtteranceTTL forgets let-through utterances whose final segment never arrived
+const admittedUtteranceTTL = 10 * time.Minute
+
+func compileWakeWords(words []string) *regexp.Regexp {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// ConfigureListening sets the listening mode and wake words (merged onto the defaults).
+// An unknown mode is rejected and the defaults kept.
+func ConfigureListening(cfg ListeningConfig) error {
+	merged := DefaultListeningConfig().Merge(cfg)
+	mode, err := ParseListeningMode(merged.Mode)
+	if err != nil {
+		return err
+	}
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	listenConfig = merged
+	listenMode = mode
+	wakeWordRegexp = compileWakeWords(merged.WakeWords)
+	clear(attentiveUntil)
+	return nil
+}
+
+// GetListeningMode returns the active listening mode
+func GetListeningMode() ListeningMode {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	return listenMode
+}
+
+// SetListeningMode switches the listening mode at runtime, closing any open listening windows
+func SetListeningMode(mode ListeningMode) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if mode != listenMode {
+		log.Printf("Listening: Mode changed from %s to %s", listenMode, mode)
+	}
+	listenMode = mode
+	clear(attentiveUntil)
+}
+
+// Listen opens a guild's listening window: for push_to_talk_seconds in push-to-talk mode, otherwise
+// for attentive_seconds (as if the wake word had been said). It returns how long the window lasts.
+func Listen(guildID string) time.Duration {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	window := time.Duration(listenConfig.AttentiveSeconds) * time.Second
+	if listenMode == ListenPushToTalk {
+		window = time.Duration(listenConfig.PushToTalkSeconds) * time.Second
+	}
+	attentiveUntil[guildID] = listenClock.Now().Add(window)
+	return window
+}
+
+// StopListening closes a guild's listening window
+func StopListening(guildID string) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	delete(attentiveUntil, guildID)
+}
+
+// Attentive reports whether a guild's listening window is open
+func Attentive(guildID string) bool {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	return attentiveLocked(guildID)
+}
+
+func attentiveLocked(guildID string) bool {
+	until, ok := attentiveUntil[guildID]
+	if ok && listenClock.Now().After(until) {
+		delete(attentiveUntil, guildID)
+		return false
+	}
+	return ok
+}
+
+// ShouldTranscribe reports whether a segment is worth sending to STT. Only push-to-talk skips
+// anything: audio outside the listening window is dropped, unless an earlier segment of the same
+// utterance was let through. Audio let through here is emitted even if the window closes while
+// STT is still working on it.
+func ShouldTranscribe(guildID, utteranceID string) bool {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if listenMode != ListenPushToTalk {
+		return true
+	}
+	if _, admitted := admittedSpeech[utteranceID]; admitted {
+		return true
+	}
+	if !attentiveLocked(guildID) {
+		return false
+	}
+	admittedSpeech[utteranceID] = listenClock.Now()
+	return true
+}
+
+// AdmitTranscript reports whether a final transcript should be emitted. In wake-word mode a
+// transcript containing a wake word opens the listening window, and every transcript let through
+// keeps it open; the rest of an utterance that was let through is always let through too.
+func AdmitTranscript(guildID string, segment Segment, text string) bool {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if listenMode == ListenAlways {
+		return true
+	}
+
+	now := listenClock.Now()
+	for id, at := range admittedSpeech {
+		if now.Sub(at) > admittedUtteranceTTL {
+			delete(admittedSpeech, id)
+		}
+	}
+
+	_, admitted := admittedSpeech[segment.UtteranceID]
+	if !admitted && !attentiveLocked(guildID) {
+		if listenMode != ListenWakeWord || wakeWordRegexp == nil || !wakeWordRegexp.MatchString(text) {
+			return false
+		}
+		log.Printf("Listening [%s]: Wake word heard, attentive for %ds", guildID, listenConfig.AttentiveSeconds)
+	}
+
+	if listenMode == ListenWakeWord {
+		attentiveUntil[guildID] = now.Add(time.Duration(listenConfig.AttentiveSeconds) * time.Second)
+	}
+	if segment.Final {
+		delete(admittedSpeech, segment.UtteranceID)
+	} else if !admitted {
+		admittedSpeech[segment.UtteranceID] = now
+	}
+	return true
+}
+
+// AdmitPartial reports whether a streamed partial transcript should be emitted: while the listening
+// window is open, or in wake-word mode as soon as the wake word appears in it
+func AdmitPartial(guildID, text string) bool {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if listenMode == ListenAlways || attentiveLocked(guildID) {
+		return true
+	}
+	return listenMode == ListenWakeWord && wakeWordRegexp != nil && wakeWordRegexp.MatchString(text)
+}
@@ -0,0 +1,172 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+const listenGuild = "listen-guild"
+
+// useListening switches to mode with default windows and a fake clock, restoring the defaults afterwards
+func useListening(t *testing.T, mode ListeningMode) *fakeClock {
+	t.Helper()
+	if err := ConfigureListening(ListeningConfig{Mode: string(mode)}); err != nil {
+		t.Fatalf("ConfigureListening: %v", err)
+	}
+	clock := newFakeClock()
+	listenMu.Lock()
+	listenClock = clock
+	clear(admittedSpeech)
+	listenMu.Unlock()
+
+	t.Cleanup(func() {
+		_ = ConfigureListening(ListeningConfig{})
+		listenMu.Lock()
+		listenClock = systemClock{}
+		clear(admittedSpeech)
+		listenMu.Unlock()
+	})
+	return clock
+}
+
+func TestAttentive(t *testing.T) {
+	clock := useListening(t, ListenWakeWord)
+	if Attentive(listenGuild) {
+		t.Fatal("attentive before anything was said")
+	}
+
+	if window := Listen(listenGuild); window != 20*time.Second {
+		t.Fatalf("Listen() window = %v, want attentive_seconds", window)
+	}
+	clock.Advance(19 * time.Second)
+	if !Attentive(listenGuild) {
+		t.Fatal("window closed before attentive_seconds")
+	}
+	if Attentive("other-guild") {
+		t.Fatal("window opened in another guild")
+	}
+	clock.Advance(2 * time.Second)
+	if Attentive(listenGuild) {
+		t.Fatal("window still open after attentive_seconds")
+	}
+
+	Listen(listenGuild)
+	StopListening(listenGuild)
+	if Attentive(listenGuild) {
+		t.Fatal("window still open after StopListening")
+	}
+}
+
+func TestShouldTranscribe(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  ListeningMode
+		setup func(clock *fakeClock)
+		want  bool
+	}{
+		{"always", ListenAlways, nil, true},
+		{"wake word transcribes everything", ListenWakeWord, nil, true},
+		{"push to talk closed", ListenPushToTalk, nil, false},
+		{"push to talk open", ListenPushToTalk, func(*fakeClock) { Listen(listenGuild) }, true},
+		{"push to talk expired", ListenPushToTalk, func(c *fakeClock) {
+			Listen(listenGuild)
+			c.Advance(31 * time.Second)
+		}, false},
+		{"rest of a let through utterance", ListenPushToTalk, func(c *fakeClock) {
+			Listen(listenGuild)
+			ShouldTranscribe(listenGuild, "utt")
+			c.Advance(31 * time.Second)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useListening(t, tt.mode)
+			if tt.setup != nil {
+				tt.setup(clock)
+			}
+			if got := ShouldTranscribe(listenGuild, "utt"); got != tt.want {
+				t.Fatalf("ShouldTranscribe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmitTranscript(t *testing.T) {
+	final := Segment{UtteranceID: "utt", Index: 1, Final: true}
+	wake := func(*fakeClock) {
+		AdmitTranscript(listenGuild, Segment{UtteranceID: "earlier", Final: true}, "Dexter?")
+	}
+
+	tests := []struct {
+		name  string
+		mode  ListeningMode
+		setup func(clock *fakeClock)
+		text  string
+		want  bool
+	}{
+		{"always", ListenAlways, nil, "hello there", true},
+		{"no wake word", ListenWakeWord, nil, "hello there", false},
+		{"wake word", ListenWakeWord, nil, "hey Dexter, play something", true},
+		{"wake word inside another word", ListenWakeWord, nil, "such dexterity", false},
+		{"attentive after the wake word", ListenWakeWord, wake, "what time is it", true},
+		{"attentive window expired", ListenWakeWord, func(c *fakeClock) {
+			wake(c)
+			c.Advance(21 * time.Second)
+		}, "what time is it", false},
+		{"emitted transcripts keep the window open", ListenWakeWord, func(c *fakeClock) {
+			wake(c)
+			c.Advance(15 * time.Second)
+			AdmitTranscript(listenGuild, Segment{UtteranceID: "middle", Final: true}, "and then")
+			c.Advance(15 * time.Second)
+		}, "what time is it", true},
+		{"rest of a let through utterance", ListenWakeWord, func(c *fakeClock) {
+			AdmitTranscript(listenGuild, Segment{UtteranceID: "utt"}, "Dexter")
+			StopListening(listenGuild)
+		}, "what time is it", true},
+		{"push to talk closed", ListenPushToTalk, nil, "Dexter", false},
+		{"push to talk open", ListenPushToTalk, func(*fakeClock) { Listen(listenGuild) }, "hello there", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useListening(t, tt.mode)
+			if tt.setup != nil {
+				tt.setup(clock)
+			}
+			if got := AdmitTranscript(listenGuild, final, tt.text); got != tt.want {
+				t.Fatalf("AdmitTranscript(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmitPartial(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  ListeningMode
+		setup func(clock *fakeClock)
+		text  string
+		want  bool
+	}{
+		{"always", ListenAlways, nil, "hello", true},
+		{"no wake word", ListenWakeWord, nil, "hello", false},
+		{"wake word", ListenWakeWord, nil, "ok dexter", true},
+		{"attentive", ListenWakeWord, func(*fakeClock) { Listen(listenGuild) }, "hello", true},
+		{"attentive window expired", ListenWakeWord, func(c *fakeClock) {
+			Listen(listenGuild)
+			c.Advance(21 * time.Second)
+		}, "hello", false},
+		{"push to talk ignores the wake word", ListenPushToTalk, nil, "ok dexter", false},
+		{"push to talk open", ListenPushToTalk, func(*fakeClock) { Listen(listenGuild) }, "hello", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useListening(t, tt.mode)
+			if tt.setup != nil {
+				tt.setup(clock)
+			}
+			if got := AdmitPartial(listenGuild, tt.text); got != tt.want {
+				t.Fatalf("AdmitPartial(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMediaDir is where transient audio (utterances awaiting STT, TTS output) is written.
+// The STT and TTS services read and write the same paths, so it must stay on a shared filesystem.
+const DefaultMediaDir = "/tmp/dexter/audio"
+
+// MediaUsage describes the contents of the media store
+type MediaUsage struct {
+	Files      int   `json:"files"`
+	Bytes      int64 `json:"bytes"`
+	Referenced int   `json:"referenced"` // Files currently awaiting transcription or playback
+	Pruned     int   `json:"pruned"`     // Files deleted by the last prune
+}
+
+var (
+	mediaMu       sync.Mutex
+	mediaDir      = DefaultMediaDir
+	mediaMaxBytes int64
+	mediaMaxAge   time.Duration
+	mediaRefs     = make(map[string]int)
+	mediaDoomed   = make(map[string]bool) // Removed while referenced; deleted on the last release
+)
+
+// ConfigureMediaStore sets the media directory and its quotas. A zero quota disables that limit.
+func ConfigureMediaStore(dir string, maxBytes int64, maxAge time.Duration) {
+	mediaMu.Lock()
+	defer mediaMu.Unlock()
+
+	if dir == "" {
+		dir = DefaultMediaDir
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	mediaDir = dir
+	mediaMaxBytes = maxBytes
+	mediaMaxAge = maxAge
+}
+
+// MediaDir returns the media store's root directory
+func MediaDir() string {
+	mediaMu.Lock()
+	defer mediaMu.Unlock()
+	return mediaDir
+}
+
+// NewMediaFile returns a path for a new file in the media store, creating the directory if needed
+func NewMediaFile(name string) (string, error) {
+	dir := MediaDir()
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("failed to create media directory: %w", err)
+	}
+	return filepath.Join(dir, filepath.Base(name)), nil
+}
+
+// IsMediaFile reports whether path lives in the media store
+func IsMediaFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	return filepath.Dir(filepath.Clean(path)) == MediaDir()
+}
+
+// AcquireMedia marks a media file as in use so the janitor leaves it alone until ReleaseMedia.
+// Paths outside the store are ignored.
+func AcquireMedia(path string) {
+	if !IsMediaFile(path) {
+		return
+	}
+	mediaMu.Lock()
+	mediaRefs[filepath.Clean(path)]++
+	mediaMu.Unlock()
+}
+
+// ReleaseMedia drops a reference taken by AcquireMedia
+func ReleaseMedia(path string) {
+	if !IsMediaFile(path) {
+		return
+	}
+	path = filepath.Clean(path)
+
+	mediaMu.Lock()
+	if mediaRefs[path] > 1 {
+		mediaRefs[path]--
+		mediaMu.Unlock()
+		return
+	}
+	delete(mediaRefs, path)
+	doomed := mediaDoomed[path]
+	delete(mediaDoomed, path)
+	mediaMu.Unlock()
+
+	if doomed {
+		removeMediaFile(path)
+	}
+}
+
+// RemoveMedia deletes a media file, or defers the deletion until its last reference is released.
+// It returns false if path is not in the store.
+func RemoveMedia(path string) bool {
+	if !IsMediaFile(path) {
+		return false
+	}
+	path = filepath.Clean(path)
+
+	mediaMu.Lock()
+	if mediaRefs[path] > 0 {
+		mediaDoomed[path] = true
+		mediaMu.Unlock()
+		return true
+	}
+	mediaMu.Unlock()
+
+	removeMediaFile(path)
+	return true
+}
+
+func removeMediaFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Media: failed to remove %s: %v", path, err)
+	}
+}
+
+type mediaEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// PruneMedia deletes unreferenced files older than the age quota, then the oldest unreferenced
+// files until the store is under the size quota. It returns the usage after pruning.
+func PruneMedia() MediaUsage {
+	mediaMu.Lock()
+	dir, maxBytes, maxAge := mediaDir, mediaMaxBytes, mediaMaxAge
+	mediaMu.Unlock()
+
+	var usage MediaUsage
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Media: failed to read %s: %v", dir, err)
+		}
+		return usage
+	}
+
+	var entries []mediaEntry
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, mediaEntry{filepath.Join(dir, f.Name()), info.Size(), info.ModTime()})
+		usage.Bytes += info.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, e := range entries {
+		mediaMu.Lock()
+		referenced := mediaRefs[e.path] > 0
+		mediaMu.Unlock()
+
+		if referenced {
+			usage.Files++
+			usage.Referenced++
+			continue
+		}
+		expired := maxAge > 0 && e.modTime.Before(cutoff)
+		overQuota := maxBytes > 0 && usage.Bytes > maxBytes
+		if !expired && !overQuota {
+			usage.Files++
+			continue
+		}
+
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Media: failed to remove %s: %v", e.path, err)
+			usage.Files++
+			continue
+		}
+		usage.Bytes -= e.size
+		usage.Pruned++
+	}
+
+	if maxBytes > 0 && usage.Bytes > maxBytes {
+		log.Printf("Media: %d bytes in use exceeds the %d byte quota; %d file(s) still referenced", usage.Bytes, maxBytes, usage.Referenced)
+	}
+	return usage
+}
@@ -9,56 +9,58 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"layeh.com/gopus"
 )
 
 const (
-	FrameSize    = 960 // 20ms at 48kHz
-	Channels     = 2   // Stereo
-	SampleRate   = 48000
-	FrameBytes   = FrameSize * Channels * 2 // 16-bit
-	MusicDucking = 0.2                      // Volume multiplier for music when voice is active
+	FrameSize  = 960 // 20ms at 48kHz
+	Channels   = 2   // Stereo
+	SampleRate = 48000
+	FrameBytes = FrameSize * Channels * 2 // 16-bit
+
+	maxOpusFrameSize = 5760 // 120ms, the longest an Opus packet can be
+
+	maxActiveEffects = 8 // Clips layered at once; the oldest is cut off beyond this
 )
 
-// AudioMixer manages mixing of music and voice streams
+// voiceFrame is one 20ms voice frame. When opus is set it is the frame's original packet,
+// which is sent as-is if nothing else needs mixing in.
+type voiceFrame struct {
+	pcm  []int16
+	opus []byte
+}
+
+// AudioMixer manages mixing of music, voice and effects streams
 type AudioMixer struct {
-	vc          *discordgo.VoiceConnection
-	musicStream chan []int16
-	voiceStream chan []int16
-	stopChan    chan struct{}
-	running     bool
-	playing     atomic.Bool // Tracks if mixer is actively outputting audio
-	mu          sync.Mutex
-	encoder     *gopus.Encoder
+	conn          VoiceConnection
+	clock         Clock
+	musicStream   chan []int16
+	voiceStream   chan voiceFrame
+	effectsStream chan []int16
+	stopChan      chan struct{}
+	running       bool
+	playing       atomic.Bool // Tracks if mixer is actively outputting audio
+	speaking      atomic.Bool // Tracks if the last frame sent carried Dexter's voice
+	mu            sync.Mutex
+	encoder       *gopus.Encoder
+	levels        MixLevels
+	echoRef       *EchoReference // What was sent, for cancelling it out of users' mics
+	sessionRec    atomic.Pointer[SessionRecording]
+	effects       []*activeEffect // Soundboard clips playing on the effects bus
+	counters      mixerCounters
 
 	// Voice Interruption Control
 	voiceCtx    context.Context
 	voiceCancel context.CancelFunc
 }
 
-var globalMixer *AudioMixer
-var mixerMu sync.Mutex
-
-// GetGlobalMixer returns the singleton mixer instance
-func GetGlobalMixer() *AudioMixer {
-	mixerMu.Lock()
-	defer mixerMu.Unlock()
-	return globalMixer
-}
-
-// SetGlobalMixer sets the singleton mixer instance
-func SetGlobalMixer(m *AudioMixer) {
-	mixerMu.Lock()
-	defer mixerMu.Unlock()
-	if globalMixer != nil {
-		globalMixer.Stop()
-	}
-	globalMixer = m
+// NewAudioMixer creates a new mixer for the given voice connection
+func NewAudioMixer(conn VoiceConnection) (*AudioMixer, error) {
+	return newAudioMixer(conn, systemClock{})
 }
 
-// NewAudioMixer creates a new mixer for the given voice connection
-func NewAudioMixer(vc *discordgo.VoiceConnection) (*AudioMixer, error) {
+// newAudioMixer creates a mixer paced by clock
+func newAudioMixer(conn VoiceConnection, clock Clock) (*AudioMixer, error) {
 	encoder, err := gopus.NewEncoder(SampleRate, Channels, gopus.Voip)
 	if err != nil {
 		return nil, err
@@ -67,16 +69,44 @@ func NewAudioMixer(vc *discordgo.VoiceConnection) (*AudioMixer, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &AudioMixer{
-		vc:          vc,
-		musicStream: make(chan []int16, 100), // Buffer ~2 seconds
-		voiceStream: make(chan []int16, 100),
-		stopChan:    make(chan struct{}),
-		encoder:     encoder,
-		voiceCtx:    ctx,
-		voiceCancel: cancel,
+		conn:          conn,
+		clock:         clock,
+		musicStream:   make(chan []int16, 100), // Buffer ~2 seconds
+		voiceStream:   make(chan voiceFrame, 100),
+		effectsStream: make(chan []int16, 100),
+		stopChan:      make(chan struct{}),
+		encoder:       encoder,
+		levels:        DefaultMixLevels(),
+		echoRef:       NewEchoReference(),
+		voiceCtx:      ctx,
+		voiceCancel:   cancel,
 	}, nil
 }
 
+// Levels returns the current channel gains and ducking settings
+func (m *AudioMixer) Levels() MixLevels {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.levels
+}
+
+// SetLevels updates the channel gains and ducking settings; changes are ramped in by the mix loop
+func (m *AudioMixer) SetLevels(levels MixLevels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.levels = levels
+}
+
+// EchoReference returns the record of the mixer's recent output
+func (m *AudioMixer) EchoReference() *EchoReference {
+	return m.echoRef
+}
+
+// SetSessionRecording adds everything the mixer sends to a session recording's mixed track (nil to stop)
+func (m *AudioMixer) SetSessionRecording(rec *SessionRecording) {
+	m.sessionRec.Store(rec)
+}
+
 // InterruptVoice stops the current voice playback and clears the queue
 func (m *AudioMixer) InterruptVoice() {
 	m.mu.Lock()
@@ -134,29 +164,154 @@ func (m *AudioMixer) Stop() {
 	m.mu.Unlock()
 }
 
-// StreamMusic adds a PCM frame to the music queue
+// Stats returns the mixer's timing counters
+func (m *AudioMixer) Stats() MixerStats {
+	return m.counters.stats()
+}
+
+// overrun counts a frame dropped because its queue stayed full, logging the first and every 50th
+func (m *AudioMixer) overrun(source string) {
+	if n := m.counters.addOverrun(); n%50 == 1 {
+		log.Printf("AudioMixer: %s queue full, dropped a frame (%d overruns so far)", source, n)
+	}
+}
+
+// StreamMusic adds a PCM frame to the music queue, dropping it if the queue stays full for a second
 func (m *AudioMixer) StreamMusic(pcm []int16) {
 	if !m.IsRunning() {
 		return
 	}
 	select {
 	case m.musicStream <- pcm:
-	case <-time.After(1 * time.Second):
-		// Drop frame if buffer full (lag)
+	case <-m.clock.After(1 * time.Second):
+		m.overrun("music")
 	}
 }
 
 // StreamVoice adds a PCM frame to the voice queue
 func (m *AudioMixer) StreamVoice(pcm []int16) {
+	m.streamVoiceFrame(voiceFrame{pcm: pcm})
+}
+
+// StreamVoiceOpus adds a 20ms Opus packet and its decoded PCM to the voice queue.
+// The packet is passed straight to Discord when there is no music or effects to mix with it.
+func (m *AudioMixer) StreamVoiceOpus(pcm []int16, opus []byte) {
+	m.streamVoiceFrame(voiceFrame{pcm: pcm, opus: opus})
+}
+
+func (m *AudioMixer) streamVoiceFrame(frame voiceFrame) {
 	if !m.IsRunning() {
 		return
 	}
 	select {
-	case m.voiceStream <- pcm:
-	case <-time.After(1 * time.Second):
+	case m.voiceStream <- frame:
+	case <-m.clock.After(1 * time.Second):
+		m.overrun("voice")
 	}
 }
 
+// activeEffect is a clip playing on the effects bus
+type activeEffect struct {
+	pcm []int16
+	pos int
+}
+
+// PlayEffect layers a 48kHz stereo clip over everything else from the next frame on.
+// Any number of clips can overlap, up to maxActiveEffects.
+func (m *AudioMixer) PlayEffect(pcm []int16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.effects) >= maxActiveEffects {
+		m.effects = m.effects[1:]
+	}
+	m.effects = append(m.effects, &activeEffect{pcm: pcm})
+}
+
+// StopEffects cuts off every playing clip
+func (m *AudioMixer) StopEffects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.effects = nil
+}
+
+// nextEffectsFrame sums the next frame of every playing clip onto a queued effects frame (which may be nil).
+// It returns nil when there is nothing on the effects bus.
+func (m *AudioMixer) nextEffectsFrame(queued []int16) []int16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.effects) == 0 {
+		return queued
+	}
+
+	sum := make([]int32, FrameSize*Channels)
+	for i, v := range queued {
+		sum[i] = int32(v)
+	}
+	playing := m.effects[:0]
+	for _, effect := range m.effects {
+		n := min(len(sum), len(effect.pcm)-effect.pos)
+		for i := 0; i < n; i++ {
+			sum[i] += int32(effect.pcm[effect.pos+i])
+		}
+		effect.pos += n
+		if effect.pos < len(effect.pcm) {
+			playing = append(playing, effect)
+		}
+	}
+	clear(m.effects[len(playing):])
+	m.effects = playing
+
+	frame := make([]int16, len(sum))
+	for i, v := range sum {
+		frame[i] = int16(max(min(v, 32767), -32768))
+	}
+	return frame
+}
+
+// StreamEffects adds a PCM frame to the effects queue
+func (m *AudioMixer) StreamEffects(pcm []int16) {
+	if !m.IsRunning() {
+		return
+	}
+	select {
+	case m.effectsStream <- pcm:
+	case <-m.clock.After(1 * time.Second):
+		m.overrun("effects")
+	}
+}
+
+// ClearMusic drops any buffered music frames and returns how many were discarded
+func (m *AudioMixer) ClearMusic() int {
+	dropped := 0
+	for {
+		select {
+		case <-m.musicStream:
+			dropped++
+		default:
+			return dropped
+		}
+	}
+}
+
+// MusicBacklog returns the number of music frames buffered but not yet played
+func (m *AudioMixer) MusicBacklog() int {
+	return len(m.musicStream)
+}
+
+// WaitVoiceDrained blocks until every buffered voice frame has been played, or ctx is cancelled
+func (m *AudioMixer) WaitVoiceDrained(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for len(m.voiceStream) > 0 && m.IsRunning() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 func (m *AudioMixer) IsRunning() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -168,135 +323,140 @@ func (m *AudioMixer) IsPlaying() bool {
 	return m.playing.Load()
 }
 
-func (m *AudioMixer) runLoop() {
-	ticker := time.NewTicker(20 * time.Millisecond)
-	defer ticker.Stop()
+// IsSpeaking returns true while Dexter's voice (rather than only music or effects) is being played
+func (m *AudioMixer) IsSpeaking() bool {
+	return m.speaking.Load()
+}
+
+// mixLoop is the mix loop's state between frames
+type mixLoop struct {
+	music   *jitterBuffer[[]int16]
+	voice   *jitterBuffer[voiceFrame]
+	effects *jitterBuffer[[]int16]
+	state   *mixState
 
-	var isSpeaking bool
-	var silenceFrames int
+	isSpeaking    bool // Speaking(true) has been sent to the connection
+	silenceFrames int
+}
+
+// runLoop sends a frame every 20ms on a monotonic grid. After a stall it sends the missed frames at
+// once so sources do not fall behind, unless it stalled for more than maxCatchUpFrames.
+func (m *AudioMixer) runLoop() {
+	loop := &mixLoop{
+		music:   newJitterBuffer(m.musicStream, &m.counters),
+		voice:   newJitterBuffer(m.voiceStream, &m.counters),
+		effects: newJitterBuffer(m.effectsStream, &m.counters),
+		state:   newMixState(m.Levels()),
+	}
+	pace := newPacer(m.clock)
 
 	// Ensure we stop speaking on exit
 	defer func() {
-		if isSpeaking {
-			_ = m.vc.Speaking(false)
+		if loop.isSpeaking {
+			_ = m.conn.Speaking(false)
 			m.playing.Store(false)
 		}
 	}()
 
 	for {
-		select {
-		case <-m.stopChan:
+		due, resynced, ok := pace.wait(m.stopChan)
+		if !ok {
 			return
-		case <-ticker.C:
-			if !m.vc.Ready {
-				// Connection not ready, wait or exit?
-				// If we exit, we kill the mixer. Better to wait a bit.
-				// But if it stays unready, we should probably stop.
-				// For now, let's just skip this tick.
+		}
+		if resynced {
+			m.counters.addResync()
+			log.Printf("AudioMixer: Fell more than %dms behind, skipping ahead", maxCatchUpFrames*frameDuration.Milliseconds())
+		}
+		if due > 1 {
+			m.counters.addLate(due - 1)
+		}
+		for i := 0; i < due; i++ {
+			if !m.conn.Ready() {
+				// Connection not ready; skip the frame and keep the pace
 				continue
 			}
+			m.mixNext(loop)
+		}
+	}
+}
 
-			// Read from music
-			var musicFrame []int16
-			hasMusic := false
-			select {
-			case musicFrame = <-m.musicStream:
-				hasMusic = true
-			default:
-			}
+// mixNext mixes and sends one frame, or trailing silence once every source has run dry
+func (m *AudioMixer) mixNext(loop *mixLoop) {
+	now := m.clock.Now()
+	musicFrame, hasMusic := loop.music.next(now)
+	voice, hasVoice := loop.voice.next(now)
+	effectsFrame, hasEffects := loop.effects.next(now)
+	if effectsFrame = m.nextEffectsFrame(effectsFrame); effectsFrame != nil {
+		hasEffects = true
+	}
 
-			// Read from voice
-			var voiceFrame []int16
-			hasVoice := false
-			select {
-			case voiceFrame = <-m.voiceStream:
-				hasVoice = true
-			default:
-			}
+	hasAudio := hasMusic || hasVoice || hasEffects
+	m.speaking.Store(hasVoice)
 
-			hasAudio := hasMusic || hasVoice
-
-			if hasAudio {
-				if !isSpeaking {
-					log.Printf("AudioMixer: Starting playback (Music=%v, Voice=%v)", hasMusic, hasVoice)
-					if err := m.vc.Speaking(true); err != nil {
-						log.Printf("Mixer Speaking(true) error: %v", err)
-					}
-					isSpeaking = true
-					m.playing.Store(true)
-				}
-				silenceFrames = 0
-
-				// Mix
-				mixed := make([]int16, FrameSize*Channels)
-
-				for i := 0; i < len(mixed); i++ {
-					var mSample, vSample float64
-
-					if hasMusic && i < len(musicFrame) {
-						mSample = float64(musicFrame[i])
-						if hasVoice {
-							mSample *= MusicDucking // Duck music
-						}
-					}
-
-					if hasVoice && i < len(voiceFrame) {
-						vSample = float64(voiceFrame[i])
-					}
-
-					// Add
-					sum := mSample + vSample
-
-					// Clip
-					if sum > 32767 {
-						sum = 32767
-					} else if sum < -32768 {
-						sum = -32768
-					}
-
-					mixed[i] = int16(sum)
-				}
-
-				// Encode
-				opus, err := m.encoder.Encode(mixed, FrameSize, FrameBytes)
-				if err != nil {
-					log.Printf("Mixer encode error: %v", err)
-					continue
-				}
-
-				// Send
-				if m.vc.OpusSend != nil {
-					m.vc.OpusSend <- opus
-				}
-
-			} else {
-				// Silence Logic
-				if isSpeaking {
-					// Send silence frame to trailing off smoothly
-					silenceFrames++
-
-					// Send silence frame (zeros)
-					// We need to encode zeros? Or pre-encoded silence?
-					// Let's encode a zero buffer.
-					zeros := make([]int16, FrameSize*Channels)
-					opus, _ := m.encoder.Encode(zeros, FrameSize, FrameBytes)
-
-					if m.vc.OpusSend != nil {
-						m.vc.OpusSend <- opus
-					}
-
-					if silenceFrames > 5 { // 100ms of silence
-						log.Printf("AudioMixer: Playback complete.")
-						if err := m.vc.Speaking(false); err != nil {
-							log.Printf("Mixer Speaking(false) error: %v", err)
-						}
-						isSpeaking = false
-						m.playing.Store(false)
-					}
-				}
-				// If not speaking, do nothing (idle)
+	if hasAudio {
+		if !loop.isSpeaking {
+			log.Printf("AudioMixer: Starting playback (Music=%v, Voice=%v, Effects=%v)", hasMusic, hasVoice, hasEffects)
+			if err := m.conn.Speaking(true); err != nil {
+				log.Printf("Mixer Speaking(true) error: %v", err)
+			}
+			loop.isSpeaking = true
+			m.playing.Store(true)
+		}
+		loop.silenceFrames = 0
+
+		// Mix (per-channel gain, ducking envelope, soft limiter).
+		// Always run so the envelopes keep moving even when the mix is bypassed below.
+		levels := m.Levels()
+		mixed := make([]int16, FrameSize*Channels)
+		loop.state.mixFrame(mixed, voice.pcm, musicFrame, effectsFrame, levels)
+
+		var opus []byte
+		if voice.opus != nil && !hasMusic && !hasEffects && loop.state.voiceAtUnity(levels) {
+			// Nothing to mix: send the original packet and skip a lossy re-encode
+			opus = voice.opus
+		} else {
+			var err error
+			opus, err = m.encoder.Encode(mixed, FrameSize, FrameBytes)
+			if err != nil {
+				log.Printf("Mixer encode error: %v", err)
+				return
 			}
 		}
+
+		m.send(opus)
+		sent := m.clock.Now()
+		m.echoRef.Push(mixed, sent)
+		if rec := m.sessionRec.Load(); rec != nil {
+			rec.AddOutputFrame(mixed, sent)
+		}
+		return
+	}
+
+	if !loop.isSpeaking {
+		return // Idle
+	}
+
+	// Trail off with a few silence frames so the last real frame is not cut short
+	loop.silenceFrames++
+	zeros := make([]int16, FrameSize*Channels)
+	opus, _ := m.encoder.Encode(zeros, FrameSize, FrameBytes)
+	m.send(opus)
+	m.echoRef.Push(zeros, m.clock.Now())
+
+	if loop.silenceFrames > 5 { // 100ms of silence
+		log.Printf("AudioMixer: Playback complete.")
+		if err := m.conn.Speaking(false); err != nil {
+			log.Printf("Mixer Speaking(false) error: %v", err)
+		}
+		loop.isSpeaking = false
+		m.playing.Store(false)
+	}
+}
+
+// send passes a frame to the connection, counting it as an overrun if the connection's buffer stays full
+func (m *AudioMixer) send(opus []byte) {
+	if !m.conn.SendOpus(opus) {
+		m.overrun("send")
 	}
 }
 
@@ -328,3 +488,92 @@ func (m *AudioMixer) StreamFromReader(ctx context.Context, r io.Reader, isVoice
 	}
 	return nil
 }
+
+// StreamPCM streams already decoded 48kHz stereo samples to the specified channel, padding the last frame with silence
+func (m *AudioMixer) StreamPCM(ctx context.Context, pcm []int16, isVoice bool) error {
+	frameLen := FrameSize * Channels
+	for start := 0; start < len(pcm); start += frameLen {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		buf := make([]int16, frameLen)
+		copy(buf, pcm[start:])
+
+		if isVoice {
+			m.StreamVoice(buf)
+		} else {
+			m.StreamMusic(buf)
+		}
+	}
+	return nil
+}
+
+// StreamOggOpus streams an Ogg/Opus file to the voice channel. 20ms packets are queued as-is
+// (with their decoded PCM for when mixing is needed); other frame sizes are decoded and re-framed.
+func (m *AudioMixer) StreamOggOpus(ctx context.Context, r io.Reader) error {
+	ogg, err := NewOggOpusReader(r)
+	if err != nil {
+		return err
+	}
+
+	decoder, err := gopus.NewDecoder(SampleRate, Channels)
+	if err != nil {
+		return err
+	}
+
+	frameLen := FrameSize * Channels
+	skip := ogg.Head.PreSkip * Channels
+	var pending []int16
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		packet, err := ogg.NextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Every packet goes through the decoder so its state stays continuous
+		pcm, err := decoder.Decode(packet, maxOpusFrameSize, false)
+		if err != nil {
+			log.Printf("AudioMixer: Skipping undecodable Opus packet: %v", err)
+			continue
+		}
+
+		// Passthrough only while aligned to the mixer's frames; pre-skip (encoder priming,
+		// a few milliseconds) is not trimmed in this case since the packet is sent untouched.
+		if len(pending) == 0 && OpusPacketSamples(packet) == FrameSize && len(pcm) == frameLen {
+			m.StreamVoiceOpus(pcm, packet)
+			skip = 0
+			continue
+		}
+
+		if skip > 0 {
+			n := min(skip, len(pcm))
+			pcm = pcm[n:]
+			skip -= n
+		}
+		pending = append(pending, pcm...)
+		for len(pending) >= frameLen {
+			m.StreamVoice(pending[:frameLen:frameLen])
+			pending = pending[frameLen:]
+		}
+	}
+
+	if len(pending) > 0 {
+		buf := make([]int16, frameLen)
+		copy(buf, pending)
+		m.StreamVoice(buf)
+	}
+	return nil
+}
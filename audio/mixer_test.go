@@ -0,0 +1,465 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing every timer that has come due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+// waitForTimer waits until something is blocked on the clock, such as the mix loop between frames
+func waitForTimer(t *testing.T, c *fakeClock) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		c.mu.Lock()
+		n := len(c.waiters)
+		c.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("nothing waited on the clock")
+}
+
+// tone returns frames of a 48kHz stereo sine wave at the given frequency and amplitude
+func tone(frames int, hz, amplitude float64) [][]int16 {
+	out := make([][]int16, frames)
+	for f := range out {
+		frame := make([]int16, FrameSize*Channels)
+		for i := 0; i < FrameSize; i++ {
+			t := float64(f*FrameSize+i) / SampleRate
+			v := int16(amplitude * math.Sin(2*math.Pi*hz*t))
+			frame[i*Channels] = v
+			frame[i*Channels+1] = v
+		}
+		out[f] = frame
+	}
+	return out
+}
+
+func constantFrame(value int16) []int16 {
+	frame := make([]int16, FrameSize*Channels)
+	for i := range frame {
+		frame[i] = value
+	}
+	return frame
+}
+
+// newTestMixer returns a mixer on a loopback connection and fake clock, without its loop running
+func newTestMixer(t *testing.T) (*AudioMixer, *LoopbackConnection, *fakeClock) {
+	t.Helper()
+	conn := NewLoopbackConnection()
+	clock := newFakeClock()
+	m, err := newAudioMixer(conn, clock)
+	if err != nil {
+		t.Fatalf("newAudioMixer: %v", err)
+	}
+	return m, conn, clock
+}
+
+// newTestLoop returns the mix loop state runLoop would start with
+func newTestLoop(m *AudioMixer) *mixLoop {
+	return &mixLoop{
+		music:   newJitterBuffer(m.musicStream, &m.counters),
+		voice:   newJitterBuffer(m.voiceStream, &m.counters),
+		effects: newJitterBuffer(m.effectsStream, &m.counters),
+		state:   newMixState(m.Levels()),
+	}
+}
+
+// step mixes one frame at the next 20ms tick
+func step(m *AudioMixer, loop *mixLoop, clock *fakeClock) {
+	clock.Advance(frameDuration)
+	m.mixNext(loop)
+}
+
+func TestMixerPlaysVoiceThenTrailsOff(t *testing.T) {
+	m, conn, clock := newTestMixer(t)
+	m.Start()
+	defer m.Stop()
+
+	voice := tone(10, 440, 8000)
+	for _, frame := range voice {
+		m.StreamVoice(frame)
+	}
+
+	// Every voice frame plus six frames of trailing silence
+	want := len(voice) + 6
+	for i := 0; i < 200 && len(conn.Sent()) < want; i++ {
+		clock.Advance(frameDuration)
+		conn.WaitSent(len(conn.Sent())+1, 5*time.Millisecond)
+	}
+	if got := len(conn.Sent()); got != want {
+		t.Fatalf("sent %d frames, want %d", got, want)
+	}
+	for i := 0; i < 50 && len(conn.SpeakingUpdates()) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := conn.SpeakingUpdates(); len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("speaking updates %v, want [true false]", got)
+	}
+	if m.IsPlaying() {
+		t.Error("mixer still playing after trailing silence")
+	}
+}
+
+func TestMixerPassesVoiceOpusThroughUnlessMixing(t *testing.T) {
+	m, conn, clock := newTestMixer(t)
+	loop := newTestLoop(m)
+
+	packet := []byte{0xf8, 0xff, 0xfe}
+	pcm := constantFrame(1000)
+	for i := 0; i < jitterFrames; i++ {
+		m.voiceStream <- voiceFrame{pcm: pcm, opus: packet}
+	}
+	step(m, loop, clock)
+	sent := conn.Sent()
+	if len(sent) != 1 || !bytes.Equal(sent[0], packet) {
+		t.Fatalf("voice alone was not passed through: %v", sent)
+	}
+
+	// With music underneath the frame has to be mixed and re-encoded
+	for i := 0; i < jitterFrames; i++ {
+		m.musicStream <- constantFrame(1000)
+	}
+	step(m, loop, clock)
+	step(m, loop, clock)
+	sent = conn.Sent()
+	if len(sent) != 3 || bytes.Equal(sent[2], packet) {
+		t.Fatalf("voice over music was passed through unmixed")
+	}
+}
+
+func TestMixFrameSumsSources(t *testing.T) {
+	levels := DefaultMixLevels()
+	levels.Ducking = 1
+	state := newMixState(levels)
+
+	out := make([]int16, FrameSize*Channels)
+	state.mixFrame(out, constantFrame(1000), constantFrame(2000), constantFrame(3000), levels)
+	for i, v := range out {
+		if v < 5998 || v > 6002 {
+			t.Fatalf("sample %d = %d, want about 6000", i, v)
+		}
+	}
+
+	// Loud sources are limited rather than clipped
+	state.mixFrame(out, constantFrame(20000), constantFrame(20000), nil, levels)
+	for i, v := range out {
+		if v >= 32767 || float64(v) <= limiterThreshold*32767 {
+			t.Fatalf("sample %d = %d, want soft limited below full scale", i, v)
+		}
+	}
+}
+
+func TestMixFrameDucksMusicUnderVoice(t *testing.T) {
+	levels := DefaultMixLevels()
+	state := newMixState(levels)
+	out := make([]int16, FrameSize*Channels)
+	music := constantFrame(10000)
+
+	state.mixFrame(out, nil, music, nil, levels)
+	if out[len(out)-1] != 10000 {
+		t.Fatalf("music alone = %d, want 10000", out[len(out)-1])
+	}
+
+	// Voice at zero shows the music gain alone; the attack completes within DuckAttackMs
+	silentVoice := constantFrame(0)
+	frames := levels.DuckAttackMs / int(frameDuration.Milliseconds())
+	state.mixFrame(out, silentVoice, music, nil, levels)
+	if first := out[len(out)-1]; first <= 2000 || first >= 10000 {
+		t.Errorf("music after one attack frame = %d, want between ducked and full", first)
+	}
+	for i := 1; i < frames; i++ {
+		state.mixFrame(out, silentVoice, music, nil, levels)
+	}
+	if got := out[len(out)-1]; got != 2000 {
+		t.Errorf("ducked music = %d, want 2000", got)
+	}
+
+	// Released gradually over DuckReleaseMs once voice stops
+	state.mixFrame(out, nil, music, nil, levels)
+	if got := out[len(out)-1]; got <= 2000 || got >= 10000 {
+		t.Errorf("music one frame into release = %d, want between ducked and full", got)
+	}
+	for i := 1; i < levels.DuckReleaseMs/int(frameDuration.Milliseconds()); i++ {
+		state.mixFrame(out, nil, music, nil, levels)
+	}
+	if got := out[len(out)-1]; got != 10000 {
+		t.Errorf("released music = %d, want 10000", got)
+	}
+}
+
+func TestInterruptVoiceClearsQueueAndCancelsStream(t *testing.T) {
+	m, _, _ := newTestMixer(t)
+	// The loop waits on the fake clock, so nothing is played
+	m.Start()
+	defer m.Stop()
+
+	ctx := m.GetVoiceContext()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.StreamPCM(ctx, make([]int16, 200*FrameSize*Channels), true)
+	}()
+	for i := 0; i < 100 && len(m.voiceStream) < cap(m.voiceStream); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if len(m.voiceStream) == 0 {
+		t.Fatal("no voice was queued")
+	}
+
+	m.InterruptVoice()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("StreamPCM returned %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StreamPCM kept streaming after the interruption")
+	}
+	// The stream may have queued one more frame before seeing the cancellation
+	if n := len(m.voiceStream); n > 1 {
+		t.Errorf("%d voice frames left queued after interruption", n)
+	}
+	if err := m.GetVoiceContext().Err(); err != nil {
+		t.Errorf("new voice context already done: %v", err)
+	}
+}
+
+func TestMixerCountsDroppedSends(t *testing.T) {
+	m, conn, clock := newTestMixer(t)
+	loop := newTestLoop(m)
+	conn.SetFull(true)
+
+	for i := 0; i < jitterFrames; i++ {
+		m.effectsStream <- constantFrame(500)
+	}
+	step(m, loop, clock)
+	if got := m.Stats().Overruns; got != 1 {
+		t.Errorf("overruns = %d, want 1", got)
+	}
+}
+
+func TestMixerCatchesUpAfterStall(t *testing.T) {
+	m, conn, clock := newTestMixer(t)
+	for i := 0; i < 30; i++ {
+		m.voiceStream <- voiceFrame{pcm: constantFrame(1000)}
+	}
+	m.Start()
+	defer m.Stop()
+
+	// The first frame is due at once
+	if !conn.WaitSent(1, time.Second) {
+		t.Fatal("first frame was not sent")
+	}
+
+	// Waking three frames late sends the missed frames in a burst
+	waitForTimer(t, clock)
+	clock.Advance(4 * frameDuration)
+	if !conn.WaitSent(5, time.Second) {
+		t.Fatalf("sent %d frames after a short stall, want 5", len(conn.Sent()))
+	}
+	waitForTimer(t, clock)
+	if got := m.Stats(); got.LateFrames != 3 || got.Resyncs != 0 {
+		t.Fatalf("stats after a short stall = %+v, want 3 late frames and no resync", got)
+	}
+
+	// Falling further behind than maxCatchUpFrames skips ahead and sends a single frame
+	clock.Advance(20 * frameDuration)
+	if !conn.WaitSent(6, time.Second) {
+		t.Fatal("no frame sent after a long gap")
+	}
+	waitForTimer(t, clock)
+	if got := len(conn.Sent()); got != 6 {
+		t.Fatalf("sent %d frames after a long gap, want 6", got)
+	}
+	if got := m.Stats(); got.LateFrames != 3 || got.Resyncs != 1 {
+		t.Fatalf("stats after a long gap = %+v, want 3 late frames and 1 resync", got)
+	}
+
+	// The grid restarts from the resync: one frame per tick again
+	clock.Advance(frameDuration)
+	if !conn.WaitSent(7, time.Second) {
+		t.Fatal("no frame sent on the tick after the resync")
+	}
+	waitForTimer(t, clock)
+	if got := len(conn.Sent()); got != 7 {
+		t.Fatalf("sent %d frames on the tick after the resync, want 7", got)
+	}
+}
+
+func TestMixerCountsUnderrunsAcrossTicks(t *testing.T) {
+	m, _, clock := newTestMixer(t)
+	loop := newTestLoop(m)
+	queue := func() {
+		for i := 0; i < jitterFrames; i++ {
+			m.voiceStream <- voiceFrame{pcm: constantFrame(1000)}
+		}
+	}
+
+	queue()
+	for i := 0; i < jitterFrames; i++ {
+		step(m, loop, clock)
+	}
+	if got := m.Stats().Underruns; got != 0 {
+		t.Fatalf("underruns while the queue had frames = %d, want 0", got)
+	}
+
+	// Running dry for a tick mid-stream is an underrun once frames arrive again
+	step(m, loop, clock)
+	queue()
+	step(m, loop, clock)
+	if got := m.Stats().Underruns; got != 1 {
+		t.Fatalf("underruns after a one-tick gap = %d, want 1", got)
+	}
+
+	// A gap longer than underrunWindow is the end of one stream and the start of the next
+	for i := 1; i < jitterFrames; i++ {
+		step(m, loop, clock)
+	}
+	for i := 0; i <= int(underrunWindow/frameDuration); i++ {
+		step(m, loop, clock)
+	}
+	queue()
+	step(m, loop, clock)
+	if got := m.Stats().Underruns; got != 1 {
+		t.Fatalf("underruns after a new stream = %d, want still 1", got)
+	}
+}
+
+func TestMixerCountsOverrunsAcrossTicks(t *testing.T) {
+	m, conn, clock := newTestMixer(t)
+	loop := newTestLoop(m)
+	conn.SetFull(true)
+
+	for i := 0; i < 5; i++ {
+		m.effectsStream <- constantFrame(500)
+	}
+	for i := 0; i < 3; i++ {
+		step(m, loop, clock)
+	}
+	if got := m.Stats().Overruns; got != 3 {
+		t.Fatalf("overruns while the connection was full = %d, want 3", got)
+	}
+
+	conn.SetFull(false)
+	step(m, loop, clock)
+	if got := len(conn.Sent()); got != 1 {
+		t.Fatalf("sent %d frames once the connection had room, want 1", got)
+	}
+	if got := m.Stats().Overruns; got != 3 {
+		t.Fatalf("overruns after the connection had room = %d, want still 3", got)
+	}
+}
+
+func TestMixerDropsFramesWhenQueueStaysFull(t *testing.T) {
+	m, _, clock := newTestMixer(t)
+	// Mark the mixer running without its loop, so nothing drains the queues
+	m.mu.Lock()
+	m.running = true
+	m.mu.Unlock()
+
+	tests := []struct {
+		name   string
+		fill   func()
+		stream func()
+	}{
+		{"music", func() {
+			for len(m.musicStream) < cap(m.musicStream) {
+				m.musicStream <- constantFrame(0)
+			}
+		}, func() { m.StreamMusic(constantFrame(0)) }},
+		{"voice", func() {
+			for len(m.voiceStream) < cap(m.voiceStream) {
+				m.voiceStream <- voiceFrame{pcm: constantFrame(0)}
+			}
+		}, func() { m.StreamVoice(constantFrame(0)) }},
+		{"effects", func() {
+			for len(m.effectsStream) < cap(m.effectsStream) {
+				m.effectsStream <- constantFrame(0)
+			}
+		}, func() { m.StreamEffects(constantFrame(0)) }},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fill()
+			done := make(chan struct{})
+			go func() {
+				tt.stream()
+				close(done)
+			}()
+
+			// The frame waits a second on the mixer's clock before it is dropped
+			waitForTimer(t, clock)
+			clock.Advance(time.Second - time.Millisecond)
+			select {
+			case <-done:
+				t.Fatal("frame dropped before the queue had been full for a second")
+			case <-time.After(10 * time.Millisecond):
+			}
+			clock.Advance(time.Millisecond)
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("frame still waiting after the queue had been full for a second")
+			}
+			if got := m.Stats().Overruns; got != int64(i+1) {
+				t.Fatalf("overruns = %d, want %d", got, i+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoopMode controls what happens when a track finishes
+type LoopMode string
+
+const (
+	LoopOff   LoopMode = "off"   // Play the queue once
+	LoopTrack LoopMode = "track" // Repeat the current track
+	LoopQueue LoopMode = "queue" // Re-append finished tracks to the end of the queue
+)
+
+// Reasons reported to OnTrackEnd
+const (
+	TrackEndFinished = "finished"
+	TrackEndSkipped  = "skipped"
+	TrackEndStopped  = "stopped"
+	TrackEndError    = "error"
+)
+
+// Internal interruption reasons that keep the current track
+const (
+	trackInterruptPause = "paused"
+	trackInterruptSeek  = "seek"
+)
+
+const frameDuration = 20 * time.Millisecond
+
+// Track is a single entry in a music queue
+type Track struct {
+	ID          string  `json:"id"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	Duration    float64 `json:"duration"` // Seconds, 0 if unknown
+	RequestedBy string  `json:"requested_by,omitempty"`
+	AddedAt     int64   `json:"added_at"`
+}
+
+// MusicState is a snapshot of a guild's player, used for the queue API and for persistence
+type MusicState struct {
+	GuildID  string   `json:"guild_id"`
+	Current  *Track   `json:"current,omitempty"`
+	Position float64  `json:"position"` // Seconds into the current track
+	Paused   bool     `json:"paused"`
+	Loop     LoopMode `json:"loop"`
+	Queue    []*Track `json:"queue"`
+}
+
+// MusicPlayer plays a persistent queue of tracks on the mixer's music channel for one guild
+type MusicPlayer struct {
+	guildID string
+	mu      sync.Mutex
+	cond    *sync.Cond
+
+	queue    []*Track
+	current  *Track
+	offset   time.Duration // Position the current pipeline started at
+	frames   atomic.Int64  // Frames sent to the mixer since offset
+	paused   bool
+	loop     LoopMode
+	starting bool // True when the current track should emit a start event
+
+	cancel          context.CancelFunc
+	interruptReason string
+	seekTarget      time.Duration
+
+	persistData []byte        // Latest state snapshot waiting to be written to Redis
+	persistWake chan struct{} // Wakes persistLoop when persistData changes
+}
+
+var (
+	musicPlayers = make(map[string]*MusicPlayer)
+	musicMu      sync.Mutex
+	musicRedis   *redis.Client
+
+	// OnTrackStart is called when a track starts playing from the beginning
+	OnTrackStart func(guildID string, track Track)
+	// OnTrackEnd is called when a track stops playing for good (finished, skipped, stopped or failed)
+	OnTrackEnd func(guildID string, track Track, reason string)
+)
+
+// ConfigureMusic sets the Redis client used to persist queues and the track lifecycle callbacks.
+func ConfigureMusic(rc *redis.Client, onStart func(string, Track), onEnd func(string, Track, string)) {
+	musicMu.Lock()
+	defer musicMu.Unlock()
+	musicRedis = rc
+	OnTrackStart = onStart
+	OnTrackEnd = onEnd
+}
+
+// GetMusicPlayer returns the player for a guild, restoring its persisted queue on first use.
+func GetMusicPlayer(guildID string) *MusicPlayer {
+	musicMu.Lock()
+	defer musicMu.Unlock()
+
+	if p, ok := musicPlayers[guildID]; ok {
+		return p
+	}
+
+	p := &MusicPlayer{
+		guildID:     guildID,
+		loop:        LoopOff,
+		persistWake: make(chan struct{}, 1),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	p.restore()
+	musicPlayers[guildID] = p
+
+	go p.run()
+	go p.persistLoop()
+	return p
+}
+
+// LookupMusicPlayer returns the player for a guild, or nil if none has been created yet.
+func LookupMusicPlayer(guildID string) *MusicPlayer {
+	musicMu.Lock()
+	defer musicMu.Unlock()
+	return musicPlayers[guildID]
+}
+
+// Enqueue adds a URL to the end of the queue and returns the new track and its queue position (0 = playing now).
+func (p *MusicPlayer) Enqueue(url, requestedBy string) (*Track, int) {
+	track := &Track{
+		ID:          strconv.FormatInt(time.Now().UnixNano(), 36),
+		URL:         url,
+		Title:       url,
+		RequestedBy: requestedBy,
+		AddedAt:     time.Now().Unix(),
+	}
+
+	p.mu.Lock()
+	p.queue = append(p.queue, track)
+	position := len(p.queue)
+	if p.current == nil && !p.paused {
+		position = 0
+	}
+	p.persistLocked()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	go p.resolveMetadata(track)
+
+	return track, position
+}
+
+// Skip ends the current track and moves on to the next one.
+func (p *MusicPlayer) Skip() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == nil {
+		return false
+	}
+	if p.paused {
+		// Nothing is streaming, so finish the track here
+		p.paused = false
+		p.finishLocked(TrackEndSkipped)
+		return true
+	}
+	p.interruptLocked(TrackEndSkipped)
+	return true
+}
+
+// Pause stops playback, remembering the position so Resume can continue from it.
+func (p *MusicPlayer) Pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == nil || p.paused {
+		return false
+	}
+	p.interruptLocked(trackInterruptPause)
+	return true
+}
+
+// Resume continues a paused track.
+func (p *MusicPlayer) Resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return false
+	}
+	p.paused = false
+	p.persistLocked()
+	p.cond.Broadcast()
+	return true
+}
+
+// Stop ends playback and clears the queue.
+func (p *MusicPlayer) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = nil
+	if p.current == nil {
+		p.paused = false
+		p.persistLocked()
+		return
+	}
+	if p.paused {
+		p.paused = false
+		p.finishLocked(TrackEndStopped)
+		return
+	}
+	p.interruptLocked(TrackEndStopped)
+}
+
+// Seek restarts the current track at the given position.
+func (p *MusicPlayer) Seek(position time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == nil {
+		return fmt.Errorf("nothing is playing")
+	}
+	if position < 0 {
+		position = 0
+	}
+	if p.current.Duration > 0 && position.Seconds() >= p.current.Duration {
+		return fmt.Errorf("position %.0fs is beyond the end of the track", position.Seconds())
+	}
+	if p.paused {
+		p.offset = position
+		p.frames.Store(0)
+		p.persistLocked()
+		return nil
+	}
+	p.seekTarget = position
+	p.interruptLocked(trackInterruptSeek)
+	return nil
+}
+
+// SetLoop changes the loop mode.
+func (p *MusicPlayer) SetLoop(mode LoopMode) error {
+	switch mode {
+	case LoopOff, LoopTrack, LoopQueue:
+	default:
+		return fmt.Errorf("invalid loop mode %q", mode)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loop = mode
+	p.persistLocked()
+	return nil
+}
+
+// Shuffle randomizes the order of the upcoming tracks.
+func (p *MusicPlayer) Shuffle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rand.Shuffle(len(p.queue), func(i, j int) { p.queue[i], p.queue[j] = p.queue[j], p.queue[i] })
+	p.persistLocked()
+}
+
+// State returns a snapshot of the player.
+func (p *MusicPlayer) State() MusicState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := MusicState{
+		GuildID:  p.guildID,
+		Position: p.positionLocked().Seconds(),
+		Paused:   p.paused,
+		Loop:     p.loop,
+		Queue:    make([]*Track, 0, len(p.queue)),
+	}
+	if p.current != nil {
+		current := *p.current
+		state.Current = &current
+	}
+	for _, t := range p.queue {
+		track := *t
+		state.Queue = append(state.Queue, &track)
+	}
+	return state
+}
+
+// positionLocked estimates the playback position, accounting for frames still buffered in the mixer.
+func (p *MusicPlayer) positionLocked() time.Duration {
+	played := p.frames.Load()
+	if !p.paused && p.current != nil {
+		if mixer := GetMixer(p.guildID); mixer != nil {
+			played -= int64(mixer.MusicBacklog())
+		}
+	}
+	if played < 0 {
+		played = 0
+	}
+	return p.offset + time.Duration(played)*frameDuration
+}
+
+// interruptLocked cancels the running pipeline; the run loop applies the reason once it unwinds.
+func (p *MusicPlayer) interruptLocked(reason string) {
+	p.interruptReason = reason
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// finishLocked ends the current track for good and applies the loop mode.
+func (p *MusicPlayer) finishLocked(reason string) {
+	track := *p.current
+	if OnTrackEnd != nil {
+		go OnTrackEnd(p.guildID, track, reason)
+	}
+
+	switch {
+	case p.loop == LoopTrack && reason == TrackEndFinished:
+		// Replay the same track
+		p.offset = 0
+		p.frames.Store(0)
+		p.starting = true
+		p.persistLocked()
+		return
+	case p.loop == LoopQueue && (reason == TrackEndFinished || reason == TrackEndSkipped):
+		p.queue = append(p.queue, p.current)
+	}
+
+	p.current = nil
+	p.offset = 0
+	p.frames.Store(0)
+	p.persistLocked()
+	p.cond.Broadcast()
+}
+
+// run is the playback loop: it waits for a playable track, streams it, and applies the outcome.
+func (p *MusicPlayer) run() {
+	for {
+		p.mu.Lock()
+		for p.paused || (p.current == nil && len(p.queue) == 0) {
+			p.cond.Wait()
+		}
+		if p.current == nil {
+			p.current = p.queue[0]
+			p.queue = p.queue[1:]
+			p.offset = 0
+			p.frames.Store(0)
+			p.starting = true
+			p.persistLocked()
+		}
+		track := *p.current
+		offset := p.offset
+		if p.starting && OnTrackStart != nil {
+			go OnTrackStart(p.guildID, track)
+		}
+		p.starting = false
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		p.interruptReason = ""
+		p.mu.Unlock()
+
+		log.Printf("Music [%s]: Playing %s from %s", p.guildID, track.URL, offset)
+		err := p.stream(ctx, track.URL, offset)
+		cancel()
+		if err == nil && p.frames.Load() == 0 {
+			err = fmt.Errorf("no audio was decoded")
+		}
+
+		p.mu.Lock()
+		p.cancel = nil
+		reason := p.interruptReason
+		if reason != "" {
+			// Frames already buffered in the mixer belong to the interrupted pipeline
+			if mixer := GetMixer(p.guildID); mixer != nil {
+				dropped := mixer.ClearMusic()
+				p.frames.Add(-int64(dropped))
+			}
+		}
+
+		switch reason {
+		case trackInterruptPause:
+			p.offset = p.positionLocked()
+			p.frames.Store(0)
+			p.paused = true
+			p.persistLocked()
+			log.Printf("Music [%s]: Paused at %s", p.guildID, p.offset)
+		case trackInterruptSeek:
+			p.offset = p.seekTarget
+			p.frames.Store(0)
+			p.persistLocked()
+		case "":
+			if err != nil {
+				log.Printf("Music [%s]: Error playing %s: %v", p.guildID, track.URL, err)
+				p.finishLocked(TrackEndError)
+			} else {
+				p.finishLocked(TrackEndFinished)
+			}
+		default:
+			p.finishLocked(reason)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// stream runs the yt-dlp | ffmpeg pipeline for a URL starting at offset and feeds the mixer until it ends or ctx is cancelled.
+func (p *MusicPlayer) stream(ctx context.Context, url string, offset time.Duration) error {
+	// Cancelling before each Wait makes sure an early return never blocks on a child still writing to a pipe
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 1. Start yt-dlp to stream audio to stdout
+	ytDlp := exec.CommandContext(ctx, "yt-dlp", "-f", "bestaudio", "-o", "-", url)
+	ytOut, err := ytDlp.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create yt-dlp stdout pipe: %w", err)
+	}
+	if err := ytDlp.Start(); err != nil {
+		return fmt.Errorf("failed to start yt-dlp: %w", err)
+	}
+	defer func() {
+		cancel()
+		_ = ytDlp.Wait()
+	}()
+
+	// 2. Start ffmpeg to convert stdin (from yt-dlp) to PCM s16le 48kHz stereo, skipping to the offset
+	args := []string{"-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1"}
+	if offset > 0 {
+		args = append([]string{"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 2, 64)}, args...)
+	}
+	ffmpeg := exec.CommandContext(ctx, "ffmpeg", args...)
+	ffmpeg.Stdin = ytOut
+	ffmpegOut, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ffmpeg stdout pipe: %w", err)
+	}
+	startErr := ffmpeg.Start()
+	// ffmpeg holds its own copy of yt-dlp's stdout; ours would keep yt-dlp blocked on a full pipe if ffmpeg exits early
+	_ = ytOut.Close()
+	if startErr != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", startErr)
+	}
+	defer func() {
+		cancel()
+		_ = ffmpeg.Wait()
+	}()
+
+	// 3. Stream frames to the mixer, counting them for position tracking
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		buf := make([]int16, FrameSize*Channels)
+		err := binary.Read(ffmpegOut, binary.LittleEndian, &buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		mixer := GetMixer(p.guildID)
+		if mixer == nil {
+			return fmt.Errorf("no active audio mixer")
+		}
+		mixer.StreamMusic(buf)
+		p.frames.Add(1)
+	}
+}
+
+// resolveMetadata fills in the title and duration of a track using yt-dlp.
+func (p *MusicPlayer) resolveMetadata(track *Track) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "yt-dlp", "--skip-download", "--no-playlist", "--print", "%(title)s\n%(duration)s", track.URL).Output()
+	if err != nil {
+		log.Printf("Music [%s]: Could not resolve metadata for %s: %v", p.guildID, track.URL, err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(lines) > 0 && lines[0] != "" {
+		track.Title = lines[0]
+	}
+	if len(lines) > 1 {
+		if d, err := strconv.ParseFloat(lines[1], 64); err == nil {
+			track.Duration = d
+		}
+	}
+	p.persistLocked()
+}
+
+func musicStateKey(guildID string) string {
+	return "discord:music:state:" + guildID
+}
+
+// persistLocked snapshots the queue and hands it to persistLoop so it survives restarts.
+func (p *MusicPlayer) persistLocked() {
+	if musicRedis == nil {
+		return
+	}
+	state := MusicState{
+		GuildID:  p.guildID,
+		Current:  p.current,
+		Position: p.positionLocked().Seconds(),
+		Paused:   p.paused,
+		Loop:     p.loop,
+		Queue:    p.queue,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	p.persistData = data
+	select {
+	case p.persistWake <- struct{}{}:
+	default:
+	}
+}
+
+// persistLoop writes the latest state snapshot to Redis outside the player lock, skipping superseded ones.
+func (p *MusicPlayer) persistLoop() {
+	for range p.persistWake {
+		p.mu.Lock()
+		data := p.persistData
+		p.persistData = nil
+		p.mu.Unlock()
+		if data == nil {
+			continue
+		}
+
+		if err := musicRedis.Set(context.Background(), musicStateKey(p.guildID), data, 0).Err(); err != nil {
+			log.Printf("Music [%s]: Failed to persist queue: %v", p.guildID, err)
+		}
+	}
+}
+
+// restore loads a persisted queue. Restored playback stays paused (at the last position) until resumed.
+func (p *MusicPlayer) restore() {
+	if musicRedis == nil {
+		return
+	}
+	data, err := musicRedis.Get(context.Background(), musicStateKey(p.guildID)).Bytes()
+	if err != nil {
+		return
+	}
+	var state MusicState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Music [%s]: Ignoring corrupt persisted queue: %v", p.guildID, err)
+		return
+	}
+
+	p.queue = state.Queue
+	if state.Loop != "" {
+		p.loop = state.Loop
+	}
+	if state.Current != nil {
+		p.current = state.Current
+		p.offset = time.Duration(state.Position * float64(time.Second))
+	}
+	p.paused = p.current != nil || len(p.queue) > 0
+	log.Printf("Music [%s]: Restored queue with %d tracks", p.guildID, len(p.queue))
+}
@@ -0,0 +1,273 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// IsOggOpus reports whether data starts with an Ogg page carrying an Opus identification header
+func IsOggOpus(data []byte) bool {
+	if len(data) < 27 || string(data[0:4]) != "OggS" {
+		return false
+	}
+	// The first packet follows the lacing table and must start with "OpusHead"
+	body := 27 + int(data[26])
+	return len(data) >= body+8 && string(data[body:body+8]) == "OpusHead"
+}
+
+// OpusHead is the identification header of an Ogg/Opus stream
+type OpusHead struct {
+	Channels        int
+	PreSkip         int // Samples (at 48kHz) to discard from the start of the decoded output
+	InputSampleRate int // Informational only; Opus always decodes at 48kHz here
+}
+
+// OggOpusReader demuxes Opus packets from an Ogg stream
+type OggOpusReader struct {
+	r       *bufio.Reader
+	Head    OpusHead
+	packets [][]byte // Packets completed on the current page
+	partial []byte   // Packet continuing onto the next page
+}
+
+// NewOggOpusReader reads the Opus identification and comment headers and returns a reader
+// positioned at the first audio packet.
+func NewOggOpusReader(r io.Reader) (*OggOpusReader, error) {
+	o := &OggOpusReader{r: bufio.NewReader(r)}
+
+	head, err := o.NextPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading OpusHead: %v", ErrUnsupportedFormat, err)
+	}
+	if len(head) < 19 || string(head[0:8]) != "OpusHead" {
+		return nil, fmt.Errorf("%w: missing OpusHead", ErrUnsupportedFormat)
+	}
+	o.Head = OpusHead{
+		Channels:        int(head[9]),
+		PreSkip:         int(binary.LittleEndian.Uint16(head[10:12])),
+		InputSampleRate: int(binary.LittleEndian.Uint32(head[12:16])),
+	}
+	if o.Head.Channels < 1 || o.Head.Channels > 2 || head[18] != 0 {
+		// Mapping families other than 0 (mono/stereo) need a multistream decoder
+		return nil, fmt.Errorf("%w: %d channel Opus with mapping family %d", ErrUnsupportedFormat, o.Head.Channels, head[18])
+	}
+
+	tags, err := o.NextPacket()
+	if err != nil || len(tags) < 8 || string(tags[0:8]) != "OpusTags" {
+		return nil, fmt.Errorf("%w: missing OpusTags", ErrUnsupportedFormat)
+	}
+
+	return o, nil
+}
+
+// NextPacket returns the next complete Opus packet, or io.EOF at the end of the stream
+func (o *OggOpusReader) NextPacket() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	p := o.packets[0]
+	o.packets = o.packets[1:]
+	return p, nil
+}
+
+// readPage reads one Ogg page and splits its segments into packets
+func (o *OggOpusReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	if !bytes.Equal(header[0:4], []byte("OggS")) {
+		return fmt.Errorf("lost Ogg page sync")
+	}
+
+	lacing := make([]byte, int(header[26]))
+	if _, err := io.ReadFull(o.r, lacing); err != nil {
+		return io.EOF
+	}
+
+	total := 0
+	for _, l := range lacing {
+		total += int(l)
+	}
+	body := make([]byte, total)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return io.EOF
+	}
+
+	// A packet ends on the first segment shorter than 255 bytes
+	pos := 0
+	for _, l := range lacing {
+		o.partial = append(o.partial, body[pos:pos+int(l)]...)
+		pos += int(l)
+		if l < 255 {
+			o.packets = append(o.packets, o.partial)
+			o.partial = nil
+		}
+	}
+	return nil
+}
+
+// OpusPacketSamples returns the number of samples per channel (at 48kHz) in an Opus packet, from its TOC byte
+func OpusPacketSamples(packet []byte) int {
+	if len(packet) == 0 {
+		return 0
+	}
+	config := packet[0] >> 3
+
+	var frame int
+	switch {
+	case config < 12: // SILK: 10, 20, 40, 60ms
+		frame = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid: 10, 20ms
+		frame = []int{480, 960}[config%2]
+	default: // CELT: 2.5, 5, 10, 20ms
+		frame = []int{120, 240, 480, 960}[config%4]
+	}
+
+	switch packet[0] & 0x3 {
+	case 0:
+		return frame
+	case 1, 2:
+		return frame * 2
+	default:
+		if len(packet) < 2 {
+			return 0
+		}
+		return frame * int(packet[1]&0x3F)
+	}
+}
+
+// oggCRCTable is the CRC-32 used by Ogg pages (polynomial 0x04c11db7, unreflected)
+var oggCRCTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+const (
+	oggPacketsPerPage = 50  // One second of 20ms packets
+	opusPreSkip       = 312 // libopus encoder lookahead at 48kHz
+)
+
+// OggOpusWriter muxes Opus packets into an Ogg stream
+type OggOpusWriter struct {
+	w        io.Writer
+	serial   uint32
+	seq      uint32
+	granule  uint64
+	segments []byte // Lacing values of the pending page
+	body     []byte
+	packets  int
+}
+
+// NewOggOpusWriter writes the Opus identification and comment headers and returns a writer for audio packets
+func NewOggOpusWriter(w io.Writer, channels int, serial uint32) (*OggOpusWriter, error) {
+	// Granule positions count decoded samples, which include the encoder's pre-skip
+	o := &OggOpusWriter{w: w, serial: serial, granule: opusPreSkip}
+
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // Version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:12], opusPreSkip)
+	binary.LittleEndian.PutUint32(head[12:16], SampleRate)
+	if err := o.writePage([]byte{byte(len(head))}, head, 0x02); err != nil {
+		return nil, err
+	}
+
+	vendor := "dex-discord-service"
+	tags := make([]byte, 8+4+len(vendor)+4)
+	copy(tags, "OpusTags")
+	binary.LittleEndian.PutUint32(tags[8:12], uint32(len(vendor)))
+	copy(tags[12:], vendor)
+	if err := o.writePage([]byte{byte(len(tags))}, tags, 0); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// WritePacket appends one Opus packet covering samples samples (per channel, at 48kHz)
+func (o *OggOpusWriter) WritePacket(packet []byte, samples int) error {
+	n := len(packet)
+	if len(o.segments)+n/255+1 > 255 {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+	for ; n >= 255; n -= 255 {
+		o.segments = append(o.segments, 255)
+	}
+	o.segments = append(o.segments, byte(n))
+	o.body = append(o.body, packet...)
+	o.granule += uint64(samples)
+	o.packets++
+
+	if o.packets >= oggPacketsPerPage {
+		return o.flush(0)
+	}
+	return nil
+}
+
+// Close writes the pending packets on a final end-of-stream page
+func (o *OggOpusWriter) Close() error {
+	return o.flush(0x04)
+}
+
+func (o *OggOpusWriter) flush(flags byte) error {
+	if len(o.segments) == 0 && flags == 0 {
+		return nil
+	}
+	err := o.writePage(o.segments, o.body, flags)
+	o.segments = o.segments[:0]
+	o.body = o.body[:0]
+	o.packets = 0
+	return err
+}
+
+func (o *OggOpusWriter) writePage(segments, body []byte, flags byte) error {
+	page := make([]byte, 27+len(segments)+len(body))
+	copy(page, "OggS")
+	page[5] = flags
+	// Header pages carry granule position 0
+	if flags&0x02 == 0 && o.seq > 1 {
+		binary.LittleEndian.PutUint64(page[6:14], o.granule)
+	}
+	binary.LittleEndian.PutUint32(page[14:18], o.serial)
+	binary.LittleEndian.PutUint32(page[18:22], o.seq)
+	page[26] = byte(len(segments))
+	copy(page[27:], segments)
+	copy(page[27+len(segments):], body)
+	binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+
+	o.seq++
+	_, err := o.w.Write(page)
+	return err
+}
@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"layeh.com/gopus"
+)
+
+// oggGranules returns the granule position of every page in an Ogg stream
+func oggGranules(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var granules []uint64
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || string(data[pos:pos+4]) != "OggS" {
+			t.Fatalf("lost page sync at byte %d", pos)
+		}
+		granules = append(granules, binary.LittleEndian.Uint64(data[pos+6:pos+14]))
+		segments := int(data[pos+26])
+		size := 27 + segments
+		for _, l := range data[pos+27 : pos+27+segments] {
+			size += int(l)
+		}
+		pos += size
+	}
+	return granules
+}
+
+func TestOggOpusRoundTrip(t *testing.T) {
+	// 200ms of silence, then a tone for 1.3 seconds plus a partial frame, so the last page is short and padded
+	onset := 10 * FrameSize
+	pcm := make([]int16, onset*Channels)
+	pcm = append(pcm, flatten(tone(65, 440, 8000))...)
+	pcm = append(pcm, pcm[onset*Channels:onset*Channels+FrameSize]...)
+
+	data, ext, err := EncodeCapture(pcm, CaptureConfig{SampleRate: SampleRate, Channels: Channels, Format: CaptureOpus})
+	if err != nil {
+		t.Fatalf("EncodeCapture: %v", err)
+	}
+	if ext != ".ogg" || !IsOggOpus(data) {
+		t.Fatalf("encoded %q is not recognised as Ogg/Opus", ext)
+	}
+
+	// Granules count decoded samples from the start of the stream, pre-skip included
+	granules := oggGranules(t, data)
+	if granules[0] != 0 || granules[1] != 0 {
+		t.Fatalf("header page granules = %v, want 0", granules[:2])
+	}
+	if want := uint64(opusPreSkip + oggPacketsPerPage*FrameSize); granules[2] != want {
+		t.Fatalf("first audio page granule = %d, want %d", granules[2], want)
+	}
+	last := granules[len(granules)-1]
+	if want := uint64(opusPreSkip + len(pcm)/Channels); last != want {
+		t.Fatalf("final granule = %d, want pre-skip plus the input length (%d)", last, want)
+	}
+
+	reader, err := NewOggOpusReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewOggOpusReader: %v", err)
+	}
+	if reader.Head.PreSkip != opusPreSkip || reader.Head.Channels != Channels {
+		t.Fatalf("head = %+v, want pre-skip %d and %d channels", reader.Head, opusPreSkip, Channels)
+	}
+
+	decoder, err := gopus.NewDecoder(SampleRate, Channels)
+	if err != nil {
+		t.Fatalf("gopus.NewDecoder: %v", err)
+	}
+	var decoded []int16
+	for {
+		packet, err := reader.NextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPacket: %v", err)
+		}
+		frame, err := decoder.Decode(packet, maxOpusFrameSize, false)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		decoded = append(decoded, frame...)
+	}
+
+	// Trimming the pre-skip and everything past the final granule gives back the input's timeline
+	if len(decoded) < int(last)*Channels {
+		t.Fatalf("decoded %d samples, want at least the final granule's %d", len(decoded)/Channels, last)
+	}
+	got := decoded[opusPreSkip*Channels : int(last)*Channels]
+	if len(got) != len(pcm) {
+		t.Fatalf("trimmed output has %d samples, want %d", len(got), len(pcm))
+	}
+	// Opus shifts the phase of the tone a little, so check where it starts rather than the waveform
+	start := -1
+	for i := 0; i < len(got); i += Channels {
+		if got[i] > 2000 || got[i] < -2000 {
+			start = i / Channels
+			break
+		}
+	}
+	if start < onset-48 || start > onset+48 {
+		t.Fatalf("tone starts at sample %d, want about %d", start, onset)
+	}
+}
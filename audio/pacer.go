@@ -0,0 +1,173 @@
+package audio
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxCatchUpFrames is how far the pacer catches up after a stall; further behind, it skips ahead instead
+	maxCatchUpFrames = 5
+	// jitterFrames are buffered before a source starts (or restarts after an underrun), unless it is
+	// a clip shorter than that, which starts once it has waited as long
+	jitterFrames = 3
+	// underrunWindow separates an underrun (a source running dry mid-stream) from the end of a stream:
+	// only frames arriving again within it count as an underrun
+	underrunWindow = 250 * time.Millisecond
+	// opusSendTimeout is how long a frame waits for room in the voice connection's send buffer
+	opusSendTimeout = 2 * frameDuration
+)
+
+// Clock is the time source the mixer paces frames by. Times must carry a monotonic reading
+// (as time.Now does) so wall clock changes do not disturb the pace; tests inject a fake.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// pacer releases frames on a fixed 20ms grid measured from its start, rather than on ticker ticks,
+// so a late wake-up is made up for instead of shifting every later frame
+type pacer struct {
+	clock Clock
+	start time.Time
+	sent  int64 // Frames released so far
+}
+
+func newPacer(clock Clock) *pacer {
+	return &pacer{clock: clock, start: clock.Now()}
+}
+
+// wait blocks until the next frame is due and returns how many frames are due now: usually 1,
+// more after a stall (up to maxCatchUpFrames). resynced reports that the pacer fell further behind
+// than that and skipped ahead. ok is false if stop was closed.
+func (p *pacer) wait(stop <-chan struct{}) (due int, resynced, ok bool) {
+	next := p.start.Add(time.Duration(p.sent) * frameDuration)
+	if d := next.Sub(p.clock.Now()); d > 0 {
+		select {
+		case <-stop:
+			return 0, false, false
+		case <-p.clock.After(d):
+		}
+	} else {
+		select {
+		case <-stop:
+			return 0, false, false
+		default:
+		}
+	}
+
+	elapsed := p.clock.Now().Sub(p.start)
+	due = int(int64(elapsed/frameDuration) + 1 - p.sent)
+	if due < 1 {
+		// Woken early; the frame is sent now and the grid is kept
+		due = 1
+	}
+	if due > maxCatchUpFrames {
+		// Too far behind to burst; drop the missed slots and continue from now
+		p.start = p.start.Add(time.Duration(due-1) * frameDuration)
+		due, resynced = 1, true
+	}
+	p.sent += int64(due)
+	return due, resynced, true
+}
+
+// MixerStats count timing problems in the mix loop
+type MixerStats struct {
+	Underruns  int64 `json:"underruns"`   // A source ran dry mid-stream
+	Overruns   int64 `json:"overruns"`    // Frames dropped because a source queue or the connection was full
+	LateFrames int64 `json:"late_frames"` // Frames sent late to catch up after a stall
+	Resyncs    int64 `json:"resyncs"`     // Stalls too long to catch up on, where frames were skipped
+}
+
+// mixerCounters are a mixer's MixerStats, also added to the service-wide totals
+type mixerCounters struct {
+	underruns, overruns, lateFrames, resyncs atomic.Int64
+}
+
+// mixerTotals add up every mixer's counters since startup
+var mixerTotals mixerCounters
+
+func (c *mixerCounters) addUnderrun() {
+	c.underruns.Add(1)
+	mixerTotals.underruns.Add(1)
+}
+
+func (c *mixerCounters) addOverrun() int64 {
+	mixerTotals.overruns.Add(1)
+	return c.overruns.Add(1)
+}
+
+func (c *mixerCounters) addLate(n int) {
+	c.lateFrames.Add(int64(n))
+	mixerTotals.lateFrames.Add(int64(n))
+}
+
+func (c *mixerCounters) addResync() {
+	c.resyncs.Add(1)
+	mixerTotals.resyncs.Add(1)
+}
+
+func (c *mixerCounters) stats() MixerStats {
+	return MixerStats{
+		Underruns:  c.underruns.Load(),
+		Overruns:   c.overruns.Load(),
+		LateFrames: c.lateFrames.Load(),
+		Resyncs:    c.resyncs.Load(),
+	}
+}
+
+// GetMixerTotals returns the timing counters of every mixer since startup
+func GetMixerTotals() MixerStats {
+	return mixerTotals.stats()
+}
+
+// jitterBuffer holds back a source until a few frames are queued, so a producer that delivers
+// in bursts does not leave gaps. It is only used by the mix loop.
+type jitterBuffer[T any] struct {
+	queue    chan T
+	counters *mixerCounters
+	primed   bool
+	waiting  time.Time // When the first frame of a new stream was seen
+	starved  time.Time // When a primed source last ran dry
+}
+
+func newJitterBuffer[T any](queue chan T, counters *mixerCounters) *jitterBuffer[T] {
+	return &jitterBuffer[T]{queue: queue, counters: counters}
+}
+
+// next returns the source's next frame, if it has one to play at now
+func (b *jitterBuffer[T]) next(now time.Time) (frame T, ok bool) {
+	if !b.primed {
+		queued := len(b.queue)
+		if queued == 0 {
+			b.waiting = time.Time{}
+			return frame, false
+		}
+		if b.waiting.IsZero() {
+			b.waiting = now
+		}
+		if queued < jitterFrames && now.Sub(b.waiting) < jitterFrames*frameDuration {
+			return frame, false
+		}
+		if !b.starved.IsZero() && b.waiting.Sub(b.starved) < underrunWindow {
+			b.counters.addUnderrun()
+		}
+		b.primed = true
+		b.waiting = time.Time{}
+		b.starved = time.Time{}
+	}
+
+	select {
+	case frame = <-b.queue:
+		return frame, true
+	default:
+		b.primed = false
+		b.starved = now
+		return frame, false
+	}
+}
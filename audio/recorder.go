@@ -8,7 +8,8 @@ import (
 	"log"
 	"math"
 	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -23,10 +24,10 @@ const (
 	frameSize int = 960                 // 20ms frame at 48kHz
 	maxBytes  int = (frameSize * 2) * 2 // max size of opus data
 
-	// BargeInThreshold is the RMS energy level required to interrupt the bot.
-	// 16-bit audio ranges from -32768 to 32767.
-	// A value of 1000 is roughly -30dB, significantly louder than typical acoustic echo.
-	BargeInThreshold = 1000.0
+	// minRecordingSamples drops utterances shorter than 0.75s (48kHz * 2 channels * 0.75)
+	minRecordingSamples = 72000
+	// segmentPauseMs of unvoiced audio counts as a pause a long utterance can be split at
+	segmentPauseMs = 200
 )
 
 // UserRecording tracks an active recording session for a user
@@ -34,39 +35,177 @@ type UserRecording struct {
 	UserID         string
 	ChannelID      string
 	StartTime      int64
-	LastPacketTime int64 // UnixMilli
-	Buffer         []int16
+	LastPacketTime int64   // UnixMilli
+	LastSpeechTime int64   // UnixMilli, last frame the VAD classed as speech
+	Buffer         []int16 // Audio of the current segment (48kHz stereo)
 	Mutex          sync.Mutex
-	Decoder        *gopus.Decoder
+	UtteranceID    string // Shared by every segment of this utterance
+
+	speechEnd      int               // Buffer length after the last speech frame; trailing silence is trimmed on stop
+	silenceTimeout int64             // Milliseconds without speech before the recording stops
+	stream         *STTStream        // Live transcription of the current segment, when streaming STT is enabled
+	dialStream     func() *STTStream // Opens the stream for the next segment
+	segment        int               // Index of the current segment
+	segmentStart   int64             // Unix seconds the current segment began
+	maxSegment     int               // Buffer length at which the segment is cut; 0 for unbounded
+	unvoiced       int               // Consecutive frames without voice
+	lastPause      int               // Buffer length at the most recent pause
+}
+
+// Segment identifies one saved piece of an utterance. Speech longer than the capture limit
+// is split at pauses, and every piece carries the same utterance ID.
+type Segment struct {
+	UtteranceID string `json:"utterance_id"`
+	Index       int    `json:"index"`
+	Final       bool   `json:"final"`       // Last segment of the utterance
+	DurationMs  int64  `json:"duration_ms"` // Length of the segment's audio
+}
+
+// segmentAudio is a cut segment waiting to be saved or transcribed
+type segmentAudio struct {
+	Segment
+	userID    string
+	channelID string
+	startTime int64
+	stopTime  int64
+	pcm       []int16
+	stream    *STTStream
+}
+
+// name identifies the segment in file names and Redis keys
+func (seg *segmentAudio) name() string {
+	return fmt.Sprintf("%d-%d-%s-%s-%s.%d", seg.startTime, seg.stopTime, seg.userID, seg.channelID, seg.UtteranceID, seg.Index)
+}
+
+// takeSegment removes the first cut samples of the buffer as a segment and starts the next one.
+// The caller holds rec.Mutex.
+func (rec *UserRecording) takeSegment(cut int, final bool) *segmentAudio {
+	now := time.Now().Unix()
+	seg := &segmentAudio{
+		Segment:   Segment{UtteranceID: rec.UtteranceID, Index: rec.segment, Final: final, DurationMs: int64(cut / Channels * 1000 / SampleRate)},
+		userID:    rec.UserID,
+		channelID: rec.ChannelID,
+		startTime: rec.segmentStart,
+		stopTime:  now,
+		pcm:       rec.Buffer[:cut],
+		stream:    rec.stream,
+	}
+
+	rec.Buffer = append(make([]int16, 0, rec.maxSegment), rec.Buffer[cut:]...)
+	rec.speechEnd = max(rec.speechEnd-cut, 0)
+	rec.lastPause = 0
+	rec.segment++
+	rec.segmentStart = now
+	rec.stream = nil
+	if !final && seg.stream != nil && rec.dialStream != nil {
+		rec.stream = rec.dialStream()
+	}
+	return seg
+}
+
+// nextSegment cuts the buffer once it nears the segment limit: at the first pause after three
+// quarters of the limit, or at the limit itself (back at the last pause, if there was one).
+// The caller holds rec.Mutex.
+func (rec *UserRecording) nextSegment(voiced bool) *segmentAudio {
+	if voiced {
+		rec.unvoiced = 0
+	} else {
+		rec.unvoiced++
+	}
+	atPause := rec.unvoiced == segmentPauseMs/vadFrameMs
+	if atPause {
+		rec.lastPause = len(rec.Buffer)
+	}
+	if rec.maxSegment == 0 {
+		return nil
+	}
+
+	switch {
+	case atPause && len(rec.Buffer) >= rec.maxSegment*3/4:
+		return rec.takeSegment(len(rec.Buffer), false)
+	case len(rec.Buffer) >= rec.maxSegment:
+		cut := len(rec.Buffer)
+		// A live stream has already heard everything up to now, so it can only be cut here
+		if rec.stream == nil && rec.lastPause >= rec.maxSegment/4 {
+			cut = rec.lastPause
+		}
+		return rec.takeSegment(cut, false)
+	}
+	return nil
+}
+
+// speakerState is the per-user decoding and VAD state, kept between utterances
+type speakerState struct {
+	mu      sync.Mutex
+	decoder *gopus.Decoder
+	echo    *EchoCanceller
+	vad     *VAD
+	rtp     rtpTracker
 }
 
 // VoiceRecorder manages voice recordings for all users
 type VoiceRecorder struct {
 	recordings       map[string]*UserRecording    // key: userID
+	speakers         map[string]*speakerState     // key: userID
 	ssrcToUser       map[string]map[uint32]string // maps channelID -> SSRC -> userID
 	currentChannelID string                       // currently active channel
+	guildID          string                       // guild this recorder listens in; selects VAD settings and mixer
 	mutex            sync.RWMutex
 	redisClient      *redis.Client   // Redis client for storing audio
 	ctx              context.Context // Context for Redis operations
+	stop             chan struct{}
+	stopOnce         sync.Once
+	sessionRec       *SessionRecording // Channel-wide multi-track recording, when one is running
+	talk             *talkTracker      // Speaking events and talk-time statistics
+
+	// Streaming STT (optional): audio is forwarded while the user is still talking
+	sttStreamURL string
+	OnPartial    func(userID, channelID string, result STTResult)
+	OnTranscript func(userID, channelID string, segment Segment, result STTResult)
 
 	// Callbacks
 	OnStart func(userID, channelID string)
-	OnStop  func(userID, channelID, redisKey, filePath string)
+	OnStop  func(userID, channelID, redisKey, filePath string, segment Segment) // Once per segment; must ReleaseMedia(filePath) when done with the file
 }
 
-// NewVoiceRecorder creates a new voice recorder instance
-func NewVoiceRecorder(ctx context.Context, onStart func(string, string), onStop func(string, string, string, string)) (*VoiceRecorder, error) {
-	// Initialize Redis client
-	redisClient, err := GetRedisClient(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Redis client: %w", err)
-	}
+// sttFinalTimeout bounds how long to wait for a streamed utterance's final transcript before falling back to the file path
+const sttFinalTimeout = 10 * time.Second
 
+// EnableStreamingSTT forwards each utterance to a streaming STT WebSocket endpoint as it is spoken.
+// onPartial receives interim transcripts; onFinal receives the final one, in which case the audio is
+// not saved and OnStop reports no file. If the stream fails, the recording is saved as usual.
+// Each segment of a long utterance gets its own stream.
+func (vr *VoiceRecorder) EnableStreamingSTT(url string, onPartial func(userID, channelID string, result STTResult), onFinal func(userID, channelID string, segment Segment, result STTResult)) {
+	vr.mutex.Lock()
+	defer vr.mutex.Unlock()
+	vr.sttStreamURL = url
+	vr.OnPartial = onPartial
+	vr.OnTranscript = onFinal
+}
+
+// SetSpeakingHandler receives throttled speaking started/stopped updates (nil to stop)
+func (vr *VoiceRecorder) SetSpeakingHandler(fn func(SpeakingUpdate)) {
+	vr.talk.setHandler(fn)
+}
+
+// SetSessionRecording routes every speaker's audio into a session recording (nil to stop)
+func (vr *VoiceRecorder) SetSessionRecording(rec *SessionRecording) {
+	vr.mutex.Lock()
+	defer vr.mutex.Unlock()
+	vr.sessionRec = rec
+}
+
+// NewVoiceRecorder creates a voice recorder for one guild
+func NewVoiceRecorder(ctx context.Context, guildID string, redisClient *redis.Client, onStart func(string, string), onStop func(string, string, string, string, Segment)) *VoiceRecorder {
 	vr := &VoiceRecorder{
 		recordings:  make(map[string]*UserRecording),
+		speakers:    make(map[string]*speakerState),
 		ssrcToUser:  make(map[string]map[uint32]string),
+		guildID:     guildID,
 		redisClient: redisClient,
 		ctx:         ctx,
+		talk:        newTalkTracker(ctx, redisClient),
+		stop:        make(chan struct{}),
 		OnStart:     onStart,
 		OnStop:      onStop,
 	}
@@ -74,7 +213,13 @@ func NewVoiceRecorder(ctx context.Context, onStart func(string, string), onStop
 	// Start silence monitor
 	go vr.MonitorSilence()
 
-	return vr, nil
+	return vr
+}
+
+// Close stops all recordings and the silence monitor
+func (vr *VoiceRecorder) Close() {
+	vr.stopOnce.Do(func() { close(vr.stop) })
+	vr.StopAllRecordings()
 }
 
 // MonitorSilence checks for silent users and stops their recordings
@@ -82,21 +227,31 @@ func (vr *VoiceRecorder) MonitorSilence() {
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-vr.stop:
+			return
+		case <-ticker.C:
+		}
+
 		vr.mutex.Lock()
 		var usersToStop []string
 		now := time.Now().UnixMilli()
 
 		for userID, rec := range vr.recordings {
-			// Silence threshold: 1500ms (1.5s) to allow natural pauses/thinking time
-			if now-rec.LastPacketTime > 1500 {
+			// Discord stops sending packets in silence, but noise can keep them coming;
+			// either way only time since the VAD last heard speech counts.
+			rec.Mutex.Lock()
+			lastSpeech := rec.LastSpeechTime
+			rec.Mutex.Unlock()
+			if now-lastSpeech > rec.silenceTimeout {
 				usersToStop = append(usersToStop, userID)
 			}
 		}
 		vr.mutex.Unlock()
 
 		for _, userID := range usersToStop {
-			log.Printf("MonitorSilence: User %s has stopped speaking (timeout).", userID)
+			log.Printf("MonitorSilence: User %s has stopped speaking (no speech detected).", userID)
 			if _, err := vr.StopRecording(userID); err != nil {
 				log.Printf("Error stopping recording for user %s: %v", userID, err)
 			}
@@ -114,19 +269,31 @@ func (vr *VoiceRecorder) StartRecording(userID, channelID string) error {
 		return nil // Already recording
 	}
 
-	// Create opus decoder
-	decoder, err := gopus.NewDecoder(frameRate, channels)
-	if err != nil {
-		return fmt.Errorf("failed to create opus decoder: %w", err)
-	}
-
+	now := time.Now()
 	recording := &UserRecording{
 		UserID:         userID,
 		ChannelID:      channelID,
-		StartTime:      time.Now().Unix(),
-		LastPacketTime: time.Now().UnixMilli(),
+		StartTime:      now.Unix(),
+		LastPacketTime: now.UnixMilli(),
+		LastSpeechTime: now.UnixMilli(),
 		Buffer:         make([]int16, 0),
-		Decoder:        decoder,
+		UtteranceID:    strconv.FormatInt(now.UnixNano(), 36),
+		silenceTimeout: int64(GetVADConfig(vr.guildID).SilenceTimeoutMs),
+		segmentStart:   now.Unix(),
+		maxSegment:     GetCaptureConfig().maxSegmentSamples(),
+	}
+
+	// Push-to-talk outside the listening window: the audio is only kept in case listening turns on mid-sentence
+	if url := vr.sttStreamURL; url != "" && ShouldTranscribe(vr.guildID, recording.UtteranceID) {
+		onPartial := vr.OnPartial
+		recording.dialStream = func() *STTStream {
+			return DialSTTStream(url, func(result STTResult) {
+				if onPartial != nil {
+					onPartial(userID, channelID, result)
+				}
+			})
+		}
+		recording.stream = recording.dialStream()
 	}
 
 	vr.recordings[userID] = recording
@@ -153,21 +320,104 @@ func (vr *VoiceRecorder) StopRecording(userID string) (string, error) {
 	delete(vr.recordings, userID)
 	vr.mutex.Unlock()
 
-	stopTime := time.Now().Unix()
-
-	// Don't save if buffer is empty or recording was too short (< 0.75 second)
-	// 48kHz * 2 channels = 96000 samples per second, so 0.75s = 72000
-	if len(recording.Buffer) < 72000 {
-		log.Printf("VoiceRecorder: [SKIP] Recording for user %s was too short (%d samples)", userID, len(recording.Buffer))
+	// Drop the silence recorded after the hangover
+	recording.Mutex.Lock()
+	recording.Buffer = recording.Buffer[:recording.speechEnd]
+	seg := recording.takeSegment(len(recording.Buffer), true)
+	lastSpeech := recording.LastSpeechTime
+	recording.Mutex.Unlock()
+
+	vr.talk.stop(userID, time.UnixMilli(lastSpeech))
+
+	// Don't save if buffer is empty or the whole utterance was too short (< 0.75 second).
+	// The tail of an utterance already split into segments is kept however short it is.
+	if len(seg.pcm) == 0 || (seg.Index == 0 && len(seg.pcm) < minRecordingSamples) {
+		log.Printf("VoiceRecorder: [SKIP] Recording for user %s was too short (%d samples)", userID, len(seg.pcm))
+		if seg.stream != nil {
+			seg.stream.Cancel()
+		}
 		// Still trigger stop callback but with empty keys
 		if vr.OnStop != nil {
-			go vr.OnStop(userID, recording.ChannelID, "", "")
+			go vr.OnStop(userID, seg.channelID, "", "", seg.Segment)
 		}
 		return "", nil
 	}
 
+	if seg.stream != nil {
+		// The transcript is nearly done already; wait for it without holding up other stops
+		go vr.finishStream(seg)
+		return "", nil
+	}
+
+	return vr.saveRecording(seg)
+}
+
+// dispatchSegment saves or finishes transcribing a segment cut from a long utterance
+func (vr *VoiceRecorder) dispatchSegment(seg *segmentAudio) {
+	if seg.stream != nil {
+		vr.finishStream(seg)
+		return
+	}
+	if _, err := vr.saveRecording(seg); err != nil {
+		log.Printf("Error saving segment %d of utterance %s for user %s: %v", seg.Index, seg.UtteranceID, seg.userID, err)
+	}
+}
+
+// DiscardRecording drops a user's in-progress utterance without saving or transcribing it
+func (vr *VoiceRecorder) DiscardRecording(userID string) {
+	vr.mutex.Lock()
+	recording, exists := vr.recordings[userID]
+	delete(vr.recordings, userID)
+	vr.mutex.Unlock()
+	if !exists {
+		return
+	}
+
+	recording.Mutex.Lock()
+	recording.Buffer = nil
+	stream := recording.stream
+	recording.stream = nil
+	lastSpeech := recording.LastSpeechTime
+	recording.Mutex.Unlock()
+
+	vr.talk.stop(userID, time.UnixMilli(lastSpeech))
+
+	if stream != nil {
+		stream.Cancel()
+	}
+	log.Printf("VoiceRecorder: Discarded in-progress recording for user %s", userID)
+}
+
+// finishStream waits for a streamed segment's final transcript, falling back to saving the audio for the file/Redis path
+func (vr *VoiceRecorder) finishStream(seg *segmentAudio) {
+	result, err := seg.stream.Finish(sttFinalTimeout)
+	if err != nil {
+		log.Printf("VoiceRecorder: [FALLBACK] Streaming STT failed for user %s: %v. Saving audio instead.", seg.userID, err)
+		if _, err := vr.saveRecording(seg); err != nil {
+			log.Printf("Error saving recording for user %s: %v", seg.userID, err)
+		}
+		return
+	}
+
+	if vr.OnTranscript != nil {
+		vr.OnTranscript(seg.userID, seg.channelID, seg.Segment, result)
+	}
+	if vr.OnStop != nil {
+		vr.OnStop(seg.userID, seg.channelID, "", "", seg.Segment)
+	}
+}
+
+// saveRecording encodes a segment in the capture format, writes it to disk (or Redis as a fallback) and fires OnStop
+func (vr *VoiceRecorder) saveRecording(seg *segmentAudio) (string, error) {
+	userID := seg.userID
+
+	data, ext, err := EncodeCapture(seg.pcm, GetCaptureConfig())
+	if err != nil {
+		return "", err
+	}
+
 	// Priority 1: Save to shared disk (Optimal)
-	filePath, fileErr := vr.saveRecordingToDisk(recording, stopTime)
+	filePath, fileErr := vr.saveRecordingToDisk(seg.name()+ext, data)
 
 	// Priority 2: Save to Redis (Fallback)
 	var redisKey string
@@ -177,7 +427,7 @@ func (vr *VoiceRecorder) StopRecording(userID string) (string, error) {
 		log.Printf("VoiceRecorder: [SUCCESS] Saved audio to disk for user %s: %s", userID, filePath)
 	} else {
 		log.Printf("VoiceRecorder: [FALLBACK] Failed to save audio to disk: %v. Falling back to Redis.", fileErr)
-		redisKey, redisErr = vr.saveRecordingToRedis(recording, stopTime)
+		redisKey, redisErr = vr.saveRecordingToRedis(seg, data)
 		if redisErr != nil {
 			log.Printf("VoiceRecorder: [ERROR] Critical failure saving audio for user %s: %v", userID, redisErr)
 			return "", fmt.Errorf("failed to save recording to Redis (fallback): %w", redisErr)
@@ -185,40 +435,23 @@ func (vr *VoiceRecorder) StopRecording(userID string) (string, error) {
 		log.Printf("VoiceRecorder: [SUCCESS] Saved recording for user %s to Redis key %s", userID, redisKey)
 	}
 
-	// Trigger callback asynchronously
+	// Trigger callback asynchronously; it owns the file's media reference until transcription is done
 	if vr.OnStop != nil {
-		go vr.OnStop(userID, recording.ChannelID, redisKey, filePath)
+		AcquireMedia(filePath)
+		go vr.OnStop(userID, seg.channelID, redisKey, filePath, seg.Segment)
 	}
 
 	return redisKey, nil
 }
 
-// saveRecordingToDisk saves the recorded audio to a local temporary file
-func (vr *VoiceRecorder) saveRecordingToDisk(recording *UserRecording, stopTime int64) (string, error) {
-	// Create shared directory if it doesn't exist
-	tmpDir := "/tmp/dexter/audio"
-	if err := os.MkdirAll(tmpDir, 0777); err != nil {
-		return "", fmt.Errorf("failed to create temp audio directory: %w", err)
-	}
-
-	filename := fmt.Sprintf("%d-%d-%s-%s.wav", recording.StartTime, stopTime, recording.UserID, recording.ChannelID)
-	filePath := filepath.Join(tmpDir, filename)
-
-	// Create a buffer to write the WAV file
-	var buf bytes.Buffer
-
-	// Write WAV header
-	if err := writeWAVHeaderToBuffer(&buf, len(recording.Buffer)); err != nil {
-		return "", fmt.Errorf("failed to write WAV header: %w", err)
-	}
-
-	// Write PCM data
-	if err := binary.Write(&buf, binary.LittleEndian, recording.Buffer); err != nil {
-		return "", fmt.Errorf("failed to write audio data: %w", err)
+// saveRecordingToDisk saves an encoded segment to the media store
+func (vr *VoiceRecorder) saveRecordingToDisk(filename string, data []byte) (string, error) {
+	filePath, err := NewMediaFile(filename)
+	if err != nil {
+		return "", err
 	}
 
-	// Write to file
-	if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
 		return "", fmt.Errorf("failed to write audio file: %w", err)
 	}
 
@@ -230,10 +463,36 @@ func (vr *VoiceRecorder) SetCurrentChannel(channelID string) {
 	vr.mutex.Lock()
 	defer vr.mutex.Unlock()
 	vr.currentChannelID = channelID
+	// Decoder and VAD state belong to the old connection's streams
+	vr.speakers = make(map[string]*speakerState)
 	log.Printf("Set current voice channel to %s", channelID)
 }
 
-// RegisterSSRC maps an SSRC to a user ID for the current channel
+// getSpeaker returns the decoding/VAD state for a user, creating it on first use
+func (vr *VoiceRecorder) getSpeaker(userID string) (*speakerState, error) {
+	vr.mutex.Lock()
+	defer vr.mutex.Unlock()
+
+	if speaker, exists := vr.speakers[userID]; exists {
+		return speaker, nil
+	}
+
+	decoder, err := gopus.NewDecoder(frameRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus decoder: %w", err)
+	}
+
+	speaker := &speakerState{
+		decoder: decoder,
+		echo:    NewEchoCanceller(GetEchoConfig()),
+		vad:     NewVAD(GetVADConfig(vr.guildID)),
+	}
+	vr.speakers[userID] = speaker
+	return speaker, nil
+}
+
+// RegisterSSRC maps an SSRC to a user ID for the current channel. A user has one SSRC per
+// connection, so any older SSRC of theirs in the channel is dropped.
 func (vr *VoiceRecorder) RegisterSSRC(ssrc uint32, userID string, channelID string) {
 	vr.mutex.Lock()
 	defer vr.mutex.Unlock()
@@ -242,8 +501,22 @@ func (vr *VoiceRecorder) RegisterSSRC(ssrc uint32, userID string, channelID stri
 	if vr.ssrcToUser[channelID] == nil {
 		vr.ssrcToUser[channelID] = make(map[uint32]string)
 	}
+	channelMap := vr.ssrcToUser[channelID]
+
+	if previous, exists := channelMap[ssrc]; exists {
+		if previous == userID {
+			return
+		}
+		log.Printf("SSRC %d in channel %s moved from user %s to %s", ssrc, channelID, previous, userID)
+	}
+	for other, owner := range channelMap {
+		if owner == userID && other != ssrc {
+			log.Printf("Dropped stale SSRC %d for user %s in channel %s", other, userID, channelID)
+			delete(channelMap, other)
+		}
+	}
 
-	vr.ssrcToUser[channelID][ssrc] = userID
+	channelMap[ssrc] = userID
 	log.Printf("Registered SSRC %d for user %s in channel %s", ssrc, userID, channelID)
 }
 
@@ -272,6 +545,123 @@ func (vr *VoiceRecorder) ClearChannelSSRC(channelID string) {
 	}
 }
 
+// ClearSSRCs forgets every SSRC mapping and speaker's decoder state. SSRCs are assigned per voice
+// connection, so this is needed whenever the connection is replaced or closed.
+func (vr *VoiceRecorder) ClearSSRCs() {
+	vr.mutex.Lock()
+	defer vr.mutex.Unlock()
+
+	count := 0
+	for _, channelMap := range vr.ssrcToUser {
+		count += len(channelMap)
+	}
+	vr.ssrcToUser = make(map[string]map[uint32]string)
+	vr.speakers = make(map[string]*speakerState)
+	if count > 0 {
+		log.Printf("Cleared all %d SSRC mappings", count)
+	}
+}
+
+// RemoveUser forgets a user who left a voice channel: their SSRCs there and their decoder state are
+// dropped, and an utterance they were recording in that channel is stopped and saved
+func (vr *VoiceRecorder) RemoveUser(userID, channelID string) {
+	vr.mutex.Lock()
+	removed := 0
+	for ssrc, owner := range vr.ssrcToUser[channelID] {
+		if owner == userID {
+			delete(vr.ssrcToUser[channelID], ssrc)
+			removed++
+		}
+	}
+	if len(vr.ssrcToUser[channelID]) == 0 {
+		delete(vr.ssrcToUser, channelID)
+	}
+	if channelID == vr.currentChannelID {
+		delete(vr.speakers, userID)
+	}
+	recording, recordingExists := vr.recordings[userID]
+	vr.mutex.Unlock()
+
+	if removed > 0 {
+		log.Printf("Unregistered %d SSRC(s) for user %s, who left channel %s", removed, userID, channelID)
+	}
+	if recordingExists && recording.ChannelID == channelID {
+		if _, err := vr.StopRecording(userID); err != nil {
+			log.Printf("Error stopping recording for user %s: %v", userID, err)
+		}
+	}
+}
+
+// SSRCMapping is one SSRC the recorder attributes to a user
+type SSRCMapping struct {
+	ChannelID string `json:"channel_id"`
+	SSRC      uint32 `json:"ssrc"`
+	UserID    string `json:"user_id"`
+}
+
+// ActiveRecording describes an utterance being recorded
+type ActiveRecording struct {
+	UserID      string    `json:"user_id"`
+	ChannelID   string    `json:"channel_id"`
+	UtteranceID string    `json:"utterance_id"`
+	Segment     int       `json:"segment"`
+	StartedAt   time.Time `json:"started_at"`
+	LastSpeech  time.Time `json:"last_speech"`
+	BufferedMs  int64     `json:"buffered_ms"` // Audio of the current segment
+	Streaming   bool      `json:"streaming"`   // Sent to streaming STT as it is spoken
+}
+
+// CurrentChannel returns the channel whose SSRCs are currently decoded
+func (vr *VoiceRecorder) CurrentChannel() string {
+	vr.mutex.RLock()
+	defer vr.mutex.RUnlock()
+	return vr.currentChannelID
+}
+
+// SSRCMappings returns every SSRC mapping, ordered by channel and SSRC
+func (vr *VoiceRecorder) SSRCMappings() []SSRCMapping {
+	vr.mutex.RLock()
+	defer vr.mutex.RUnlock()
+
+	mappings := make([]SSRCMapping, 0)
+	for channelID, channelMap := range vr.ssrcToUser {
+		for ssrc, userID := range channelMap {
+			mappings = append(mappings, SSRCMapping{ChannelID: channelID, SSRC: ssrc, UserID: userID})
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].ChannelID != mappings[j].ChannelID {
+			return mappings[i].ChannelID < mappings[j].ChannelID
+		}
+		return mappings[i].SSRC < mappings[j].SSRC
+	})
+	return mappings
+}
+
+// ActiveRecordings describes every utterance being recorded, ordered by user ID
+func (vr *VoiceRecorder) ActiveRecordings() []ActiveRecording {
+	vr.mutex.RLock()
+	defer vr.mutex.RUnlock()
+
+	active := make([]ActiveRecording, 0, len(vr.recordings))
+	for _, rec := range vr.recordings {
+		rec.Mutex.Lock()
+		active = append(active, ActiveRecording{
+			UserID:      rec.UserID,
+			ChannelID:   rec.ChannelID,
+			UtteranceID: rec.UtteranceID,
+			Segment:     rec.segment,
+			StartedAt:   time.Unix(rec.StartTime, 0),
+			LastSpeech:  time.UnixMilli(rec.LastSpeechTime),
+			BufferedMs:  int64(len(rec.Buffer) / Channels * 1000 / SampleRate),
+			Streaming:   rec.stream != nil,
+		})
+		rec.Mutex.Unlock()
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].UserID < active[j].UserID })
+	return active
+}
+
 // StopAllRecordings stops and saves all active recordings (useful when moving channels)
 func (vr *VoiceRecorder) StopAllRecordings() {
 	vr.mutex.Lock()
@@ -290,11 +680,32 @@ func (vr *VoiceRecorder) StopAllRecordings() {
 	}
 }
 
-// ProcessVoicePacket processes an incoming voice packet
+// Receive processes every packet from a voice connection until its packet channel is closed
+func (vr *VoiceRecorder) Receive(conn VoiceConnection, channelID string) {
+	pktCount := 0
+	for p := range conn.Packets() {
+		if p == nil {
+			continue
+		}
+		pktCount++
+		if pktCount%250 == 0 { // Log every ~5 seconds of audio (50 packets/sec)
+			log.Printf("DEBUG: Rx Voice Packet SSRC %d (Count %d)", p.SSRC, pktCount)
+		}
+		if err := vr.ProcessVoicePacket(p.SSRC, p); err != nil {
+			log.Printf("Error processing voice packet: %v", err)
+		}
+	}
+	log.Printf("DEBUG: Voice packet channel closed for %s", channelID)
+}
+
+// ProcessVoicePacket processes an incoming voice packet. Gaps in the packet's RTP sequence and
+// timestamp are filled so recordings keep wall-clock time: a short loss is rebuilt by the decoder,
+// anything longer becomes silence in the speaker's recording.
 func (vr *VoiceRecorder) ProcessVoicePacket(ssrc uint32, packet *discordgo.Packet) error {
 	// Look up user ID from SSRC in the current channel
 	vr.mutex.RLock()
 	channelID := vr.currentChannelID
+	sessionRec := vr.sessionRec
 	var userID string
 	var exists bool
 	if channelMap, ok := vr.ssrcToUser[channelID]; ok {
@@ -308,53 +719,160 @@ func (vr *VoiceRecorder) ProcessVoicePacket(ssrc uint32, packet *discordgo.Packe
 		return nil
 	}
 
-	// Check for active recording, start if necessary
-	vr.mutex.Lock()
+	// CONSENT: Users who opted out are never decoded, buffered, recorded or transcribed
+	if IsOptedOut(userID) {
+		return nil
+	}
+
+	speaker, err := vr.getSpeaker(userID)
+	if err != nil {
+		return err
+	}
+
+	speaker.mu.Lock()
+	defer speaker.mu.Unlock()
+
+	gap := speaker.rtp.next(packet)
+	if gap.late {
+		countPacket(userID, gap, 0, 0)
+		return nil
+	}
+
+	var frames [][]int16
+	if gap.lost > 0 && gap.lost <= maxConcealedFrames {
+		frames = speaker.conceal(packet, gap.lost)
+	}
+	silence := gap.silence + gap.lost - len(frames)
+	if maxSilence := GetVADConfig(vr.guildID).SilenceTimeoutMs / vadFrameMs; silence > maxSilence {
+		// The recording has ended by now anyway
+		silence = maxSilence
+	}
+	countPacket(userID, gap, len(frames), silence)
+	if silence > 0 {
+		vr.appendSilence(userID, silence)
+	}
+
+	// Decode opus to PCM
+	pcm, err := speaker.decoder.Decode(packet.Opus, frameSize, false)
+	if err != nil {
+		return fmt.Errorf("failed to decode opus: %w", err)
+	}
+	frames = append(frames, pcm)
+
+	arrival := time.Now()
+	for i, pcm := range frames {
+		// Rebuilt frames belong just before the packet's own
+		at := arrival.Add(-time.Duration(len(frames)-1-i) * frameDuration)
+		if err := vr.processFrame(userID, channelID, ssrc, speaker, sessionRec, pcm, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendSilence adds silent frames to a user's recording, if one is running, for a gap in their packets.
+// The caller holds the speaker's lock.
+func (vr *VoiceRecorder) appendSilence(userID string, frames int) {
+	vr.mutex.RLock()
+	recording, exists := vr.recordings[userID]
+	vr.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	recording.Mutex.Lock()
+	defer recording.Mutex.Unlock()
+	zeros := make([]int16, frameSize*channels)
+	for i := 0; i < frames; i++ {
+		recording.Buffer = append(recording.Buffer, zeros...)
+		if recording.stream != nil {
+			recording.stream.Send(zeros)
+		}
+		if seg := recording.nextSegment(false); seg != nil {
+			log.Printf("VoiceRecorder: [SEGMENT] User %s paused mid-utterance; saving segment %d of utterance %s", userID, seg.Index, seg.UtteranceID)
+			go vr.dispatchSegment(seg)
+		}
+	}
+}
+
+// processFrame runs one decoded 20ms frame through echo cancellation, the VAD and the user's recording.
+// The caller holds the speaker's lock.
+func (vr *VoiceRecorder) processFrame(userID, channelID string, ssrc uint32, speaker *speakerState, sessionRec *SessionRecording, pcm []int16, arrival time.Time) error {
+	// ECHO CANCELLATION
+	// Subtract what Dexter just played from the user's mic before VAD sees it, so echo neither
+	// opens a recording nor triggers a barge-in, while quiet real speech still gets through.
+	mixer := GetMixer(vr.guildID)
+	if mixer != nil && !speaker.echo.cfg.Disabled {
+		pcm = speaker.echo.Process(pcm, mixer.EchoReference(), arrival)
+	}
+
+	// Session recordings keep everything the user said, not just what passes the VAD
+	if sessionRec != nil {
+		sessionRec.AddSpeakerFrame(userID, pcm, arrival)
+	}
+
+	if mixer != nil && mixer.IsPlaying() && (speaker.echo.cfg.Disabled || !speaker.echo.Converged()) {
+		// Canceller disabled or not yet converged, so echo may remain: only loud audio (Barge-In)
+		// passes while Dexter is speaking
+		rms := calculateRMS(pcm)
+		if rms < speaker.vad.cfg.BargeInThreshold {
+			// Drop frame (treat as silence/echo)
+			return nil
+		}
+	}
+
+	frame := speaker.vad.Process(pcm)
+
+	// Check for active recording; one starts only when the VAD detects an onset
+	vr.mutex.RLock()
 	recording, recordingExists := vr.recordings[userID]
+	vr.mutex.RUnlock()
+
 	if !recordingExists {
-		// Start new recording (must unlock first to avoid deadlock as StartRecording locks)
-		vr.mutex.Unlock()
+		if !frame.Onset {
+			return nil
+		}
+		// Checked before OnStart's barge-in silences Dexter
+		dexterSpeaking := mixer != nil && mixer.IsSpeaking()
 		if err := vr.StartRecording(userID, channelID); err != nil {
 			return fmt.Errorf("failed to auto-start recording: %w", err)
 		}
-		// Re-acquire the recording
-		vr.mutex.Lock()
+		vr.mutex.RLock()
 		recording, recordingExists = vr.recordings[userID]
+		vr.mutex.RUnlock()
 		if !recordingExists {
-			vr.mutex.Unlock()
 			return fmt.Errorf("recording failed to start for user %s", userID)
 		}
-	}
+		vr.talk.start(userID, channelID, ssrc, dexterSpeaking)
 
-	// Update last packet time
-	recording.LastPacketTime = time.Now().UnixMilli()
-	vr.mutex.Unlock()
+		// Include the audio from just before the onset so the first syllable is not clipped
+		recording.Mutex.Lock()
+		recording.Buffer = append(recording.Buffer, frame.PreRoll...)
+		if recording.stream != nil && len(frame.PreRoll) > 0 {
+			recording.stream.Send(frame.PreRoll)
+		}
+		recording.Mutex.Unlock()
+	}
 
 	recording.Mutex.Lock()
 	defer recording.Mutex.Unlock()
 
-	// Decode opus to PCM
-	pcm, err := recording.Decoder.Decode(packet.Opus, frameSize, false)
-	if err != nil {
-		return fmt.Errorf("failed to decode opus: %w", err)
+	now := arrival.UnixMilli()
+	recording.LastPacketTime = now
+	recording.Buffer = append(recording.Buffer, pcm...)
+	if recording.stream != nil {
+		recording.stream.Send(pcm)
 	}
-
-	// ECHO CANCELLATION & VAD SCALING
-	// If Dexter is currently speaking, we increase the sensitivity threshold.
-	// Only loud audio (Barge-In) should pass through. Quiet audio is likely acoustic echo.
-	mixer := GetGlobalMixer()
-	if mixer != nil && mixer.IsPlaying() {
-		rms := calculateRMS(pcm)
-		if rms < BargeInThreshold {
-			// Drop packet (treat as silence/echo)
-			return nil
-		}
-		// Log interruption for debugging (optional, can be noisy)
-		// log.Printf("Barge-In Detected: RMS %.2f > Threshold %.2f", rms, BargeInThreshold)
+	if frame.Speech {
+		recording.LastSpeechTime = now
+		recording.speechEnd = len(recording.Buffer)
 	}
 
-	// Append to buffer
-	recording.Buffer = append(recording.Buffer, pcm...)
+	// Keep long speech in bounded pieces the STT service can start on while the user talks
+	if seg := recording.nextSegment(frame.Voiced); seg != nil {
+		log.Printf("VoiceRecorder: [SEGMENT] User %s is still talking; saving segment %d of utterance %s", userID, seg.Index, seg.UtteranceID)
+		go vr.dispatchSegment(seg)
+	}
 	return nil
 }
 
@@ -370,38 +888,29 @@ func calculateRMS(pcm []int16) float64 {
 	return math.Sqrt(sum / float64(len(pcm)))
 }
 
-// saveRecordingToRedis saves the recorded audio to Redis as a WAV file in bytes
+// saveRecordingToRedis saves an encoded segment to Redis
 // Returns the Redis key where the audio is stored
-func (vr *VoiceRecorder) saveRecordingToRedis(recording *UserRecording, stopTime int64) (string, error) {
-	// Create a buffer to write the WAV file
-	var buf bytes.Buffer
+func (vr *VoiceRecorder) saveRecordingToRedis(seg *segmentAudio, data []byte) (string, error) {
+	// Generate Redis key: discord-audio:{startTime}-{stopTime}-{userID}-{channelID}-{utteranceID}.{segment}
+	redisKey := "discord-audio:" + seg.name()
 
-	// Write WAV header
-	if err := writeWAVHeaderToBuffer(&buf, len(recording.Buffer)); err != nil {
-		return "", fmt.Errorf("failed to write WAV header: %w", err)
+	if vr.redisClient == nil {
+		return "", fmt.Errorf("redis is not available")
 	}
 
-	// Write PCM data
-	if err := binary.Write(&buf, binary.LittleEndian, recording.Buffer); err != nil {
-		return "", fmt.Errorf("failed to write audio data: %w", err)
-	}
-
-	// Generate Redis key: discord-audio:{startTime}-{stopTime}-{userID}-{channelID}
-	redisKey := fmt.Sprintf("discord-audio:%d-%d-%s-%s", recording.StartTime, stopTime, recording.UserID, recording.ChannelID)
-
 	// Save to Redis with 60 second expiration
-	err := vr.redisClient.Set(vr.ctx, redisKey, buf.Bytes(), 60*time.Second).Err()
+	err := vr.redisClient.Set(vr.ctx, redisKey, data, 60*time.Second).Err()
 	if err != nil {
 		return "", fmt.Errorf("failed to save to Redis: %w", err)
 	}
 
-	duration := float64(stopTime - recording.StartTime)
-	log.Printf("Saved audio to Redis: %s (%.2f seconds, %d samples, %d bytes)", redisKey, duration, len(recording.Buffer), buf.Len())
+	duration := float64(len(seg.pcm)) / float64(SampleRate*Channels)
+	log.Printf("Saved audio to Redis: %s (%.2f seconds, %d bytes)", redisKey, duration, len(data))
 	return redisKey, nil
 }
 
-// writeWAVHeaderToBuffer writes a WAV file header to a bytes buffer
-func writeWAVHeaderToBuffer(buf *bytes.Buffer, samples int) error {
+// writeWAVHeaderToBuffer writes a 16-bit PCM WAV file header to a bytes buffer
+func writeWAVHeaderToBuffer(buf *bytes.Buffer, samples, rate, channels int) error {
 	// WAV file header
 	dataSize := samples * 2 // 16-bit samples
 	fileSize := 36 + dataSize
@@ -415,13 +924,13 @@ func writeWAVHeaderToBuffer(buf *bytes.Buffer, samples int) error {
 
 	// fmt chunk
 	copy(header[12:16], "fmt ")
-	binary.LittleEndian.PutUint32(header[16:20], 16)                           // fmt chunk size
-	binary.LittleEndian.PutUint16(header[20:22], 1)                            // PCM format
-	binary.LittleEndian.PutUint16(header[22:24], uint16(channels))             // channels
-	binary.LittleEndian.PutUint32(header[24:28], uint32(frameRate))            // sample rate
-	binary.LittleEndian.PutUint32(header[28:32], uint32(frameRate*channels*2)) // byte rate
-	binary.LittleEndian.PutUint16(header[32:34], uint16(channels*2))           // block align
-	binary.LittleEndian.PutUint16(header[34:36], 16)                           // bits per sample
+	binary.LittleEndian.PutUint32(header[16:20], 16)                      // fmt chunk size
+	binary.LittleEndian.PutUint16(header[20:22], 1)                       // PCM format
+	binary.LittleEndian.PutUint16(header[22:24], uint16(channels))        // channels
+	binary.LittleEndian.PutUint32(header[24:28], uint32(rate))            // sample rate
+	binary.LittleEndian.PutUint32(header[28:32], uint32(rate*channels*2)) // byte rate
+	binary.LittleEndian.PutUint16(header[32:34], uint16(channels*2))      // block align
+	binary.LittleEndian.PutUint16(header[34:36], 16)                      // bits per sample
 
 	// data chunk
 	copy(header[36:40], "data")
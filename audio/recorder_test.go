@@ -0,0 +1,300 @@
+package audio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"layeh.com/gopus"
+)
+
+// encodeFrames encodes 48kHz stereo frames as 20ms Opus packets
+func encodeFrames(t *testing.T, frames [][]int16) [][]byte {
+	t.Helper()
+	encoder, err := gopus.NewEncoder(SampleRate, Channels, gopus.Voip)
+	if err != nil {
+		t.Fatalf("gopus.NewEncoder: %v", err)
+	}
+	packets := make([][]byte, len(frames))
+	for i, frame := range frames {
+		if packets[i], err = encoder.Encode(frame, FrameSize, FrameBytes); err != nil {
+			t.Fatalf("encode frame %d: %v", i, err)
+		}
+	}
+	return packets
+}
+
+type stopEvent struct {
+	userID, channelID, filePath string
+	segment                     Segment
+}
+
+// newTestRecorder returns a recorder saving into a temporary media store, reporting starts and stops on channels
+func newTestRecorder(t *testing.T, guildID string) (*VoiceRecorder, chan string, chan stopEvent) {
+	t.Helper()
+	ConfigureMediaStore(t.TempDir(), 0, 0)
+	t.Cleanup(func() { ConfigureMediaStore(DefaultMediaDir, 0, 0) })
+
+	starts := make(chan string, 10)
+	stops := make(chan stopEvent, 10)
+	vr := NewVoiceRecorder(context.Background(), guildID, nil,
+		func(userID, channelID string) { starts <- userID },
+		func(userID, channelID, redisKey, filePath string, segment Segment) {
+			stops <- stopEvent{userID: userID, channelID: channelID, filePath: filePath, segment: segment}
+		})
+	t.Cleanup(vr.Close)
+	return vr, starts, stops
+}
+
+// packet returns the seq'th packet of a stream
+func packet(ssrc uint32, seq int, opus []byte) *discordgo.Packet {
+	return &discordgo.Packet{SSRC: ssrc, Sequence: uint16(seq), Timestamp: uint32(seq * FrameSize), Opus: opus}
+}
+
+func TestRecorderMapsSSRCsInCurrentChannel(t *testing.T) {
+	vr, starts, _ := newTestRecorder(t, "ssrc-guild")
+	speech := encodeFrames(t, tone(10, 440, 8000))
+
+	vr.SetCurrentChannel("voice-a")
+	vr.RegisterSSRC(111, "alice", "voice-a")
+	vr.RegisterSSRC(222, "bob", "voice-b")
+
+	// Unknown SSRCs and SSRCs mapped in another channel are ignored
+	for _, ssrc := range []uint32{333, 222} {
+		for i, opus := range speech {
+			if err := vr.ProcessVoicePacket(ssrc, packet(ssrc, i, opus)); err != nil {
+				t.Fatalf("ProcessVoicePacket(%d): %v", ssrc, err)
+			}
+		}
+	}
+	if n := vr.GetActiveRecordings(); n != 0 {
+		t.Fatalf("%d recordings started from unmapped SSRCs", n)
+	}
+
+	// Packets received on the connection are attributed to the mapped user
+	conn := NewLoopbackConnection()
+	done := make(chan struct{})
+	go func() {
+		vr.Receive(conn, "voice-a")
+		close(done)
+	}()
+	for _, opus := range speech {
+		conn.Inject(111, opus)
+	}
+	conn.Close()
+	<-done
+
+	select {
+	case userID := <-starts:
+		if userID != "alice" {
+			t.Fatalf("recording started for %s, want alice", userID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no recording started for a mapped SSRC")
+	}
+
+	// Once unmapped, the SSRC is ignored again
+	vr.DiscardRecording("alice")
+	vr.UnregisterSSRC(111, "voice-a")
+	for i, opus := range speech {
+		_ = vr.ProcessVoicePacket(111, packet(111, len(speech)+i, opus))
+	}
+	if n := vr.GetActiveRecordings(); n != 0 {
+		t.Errorf("%d recordings started after the SSRC was unregistered", n)
+	}
+
+	// Moving channels switches which mappings apply
+	vr.SetCurrentChannel("voice-b")
+	for i, opus := range speech {
+		_ = vr.ProcessVoicePacket(222, packet(222, i, opus))
+	}
+	select {
+	case userID := <-starts:
+		if userID != "bob" {
+			t.Errorf("recording started for %s after the move, want bob", userID)
+		}
+	case <-time.After(time.Second):
+		t.Error("no recording started for bob after moving to his channel")
+	}
+}
+
+func TestRecorderStopsAfterSilence(t *testing.T) {
+	ConfigureVAD(VADConfig{SilenceTimeoutMs: 300, HangoverMs: 100}, nil)
+	t.Cleanup(func() { ConfigureVAD(VADConfig{}, nil) })
+
+	vr, starts, stops := newTestRecorder(t, "silence-guild")
+	vr.SetCurrentChannel("voice-a")
+	vr.RegisterSSRC(111, "alice", "voice-a")
+
+	conn := NewLoopbackConnection()
+	go vr.Receive(conn, "voice-a")
+	defer conn.Close()
+
+	// A second of speech, then quiet packets that keep arriving, as they do from a noisy mic
+	for _, opus := range encodeFrames(t, tone(50, 440, 8000)) {
+		conn.Inject(111, opus)
+	}
+	select {
+	case <-starts:
+	case <-time.After(time.Second):
+		t.Fatal("speech did not start a recording")
+	}
+
+	// Time the silence from when the burst of speech has been taken in, not from its first frame;
+	// decoding it can take a while under the race detector
+	for i := 0; i < 1000 && len(conn.recv) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	quiet := encodeFrames(t, [][]int16{make([]int16, FrameSize*Channels)})[0]
+	started := time.Now()
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+	var stop stopEvent
+wait:
+	for {
+		select {
+		case stop = <-stops:
+			break wait
+		case <-ticker.C:
+			conn.Inject(111, quiet)
+		case <-time.After(3 * time.Second):
+			t.Fatal("recording did not stop after silence")
+		}
+	}
+
+	if waited := time.Since(started); waited > time.Second {
+		t.Errorf("recording stopped %v into the silence, want about 300ms", waited)
+	}
+	if stop.userID != "alice" || stop.channelID != "voice-a" || !stop.segment.Final {
+		t.Errorf("stop = %+v, want alice's final segment in voice-a", stop)
+	}
+	if stop.filePath == "" {
+		t.Fatal("a second of speech was not saved")
+	}
+	defer ReleaseMedia(stop.filePath)
+	if filepath.Ext(stop.filePath) != ".wav" {
+		t.Errorf("saved %s, want a WAV file", stop.filePath)
+	}
+	info, err := os.Stat(stop.filePath)
+	if err != nil {
+		t.Fatalf("saved file: %v", err)
+	}
+	// 16kHz mono, trimmed to about the second of speech plus its hangover
+	if secs := float64(info.Size()-44) / 2 / 16000; secs < 0.9 || secs > 1.5 {
+		t.Errorf("saved %.2fs of audio, want about 1s", secs)
+	}
+	if n := vr.GetActiveRecordings(); n != 0 {
+		t.Errorf("%d recordings still active", n)
+	}
+}
+
+func TestRecorderKeepsShortFinalSegment(t *testing.T) {
+	ConfigureVAD(VADConfig{SilenceTimeoutMs: 300, HangoverMs: 100}, nil)
+	t.Cleanup(func() { ConfigureVAD(VADConfig{}, nil) })
+	if err := ConfigureCapture(CaptureConfig{MaxSegmentSeconds: 1}); err != nil {
+		t.Fatalf("ConfigureCapture: %v", err)
+	}
+	t.Cleanup(func() { _ = ConfigureCapture(CaptureConfig{}) })
+
+	vr, starts, stops := newTestRecorder(t, "tail-guild")
+	vr.SetCurrentChannel("voice-a")
+	vr.RegisterSSRC(111, "alice", "voice-a")
+
+	conn := NewLoopbackConnection()
+	go vr.Receive(conn, "voice-a")
+	defer conn.Close()
+
+	// 1.2s of speech: a full 1s segment, then a 0.2s tail well under minRecordingSamples
+	for _, opus := range encodeFrames(t, tone(60, 440, 8000)) {
+		conn.Inject(111, opus)
+	}
+	select {
+	case <-starts:
+	case <-time.After(time.Second):
+		t.Fatal("speech did not start a recording")
+	}
+
+	quiet := encodeFrames(t, [][]int16{make([]int16, FrameSize*Channels)})[0]
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+	var got []stopEvent
+	for len(got) < 2 {
+		select {
+		case stop := <-stops:
+			got = append(got, stop)
+		case <-ticker.C:
+			conn.Inject(111, quiet)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("got %d segments, want 2", len(got))
+		}
+	}
+	for _, stop := range got {
+		if stop.filePath != "" {
+			defer ReleaseMedia(stop.filePath)
+		}
+	}
+
+	// Segments are saved in the background, so they may be reported in either order
+	if got[0].segment.Index > got[1].segment.Index {
+		got[0], got[1] = got[1], got[0]
+	}
+	first, tail := got[0], got[1]
+	if first.segment.Index != 0 || first.segment.Final || first.filePath == "" {
+		t.Errorf("first segment = %+v, want index 0 saved and not final", first)
+	}
+	if tail.segment.Index != 1 || !tail.segment.Final || tail.segment.UtteranceID != first.segment.UtteranceID {
+		t.Errorf("tail segment = %+v, want the utterance's final segment 1", tail.segment)
+	}
+	if tail.filePath == "" {
+		t.Fatal("the short final segment of a long utterance was dropped")
+	}
+	if ms := tail.segment.DurationMs; ms <= 0 || ms >= 750 {
+		t.Errorf("tail lasts %dms, want a short one", ms)
+	}
+}
+
+func TestRecorderSSRCLifecycle(t *testing.T) {
+	vr, starts, stops := newTestRecorder(t, "lifecycle-guild")
+	vr.SetCurrentChannel("voice-a")
+
+	// A user reconnecting gets a new SSRC; the old one must not stay theirs
+	vr.RegisterSSRC(111, "alice", "voice-a")
+	vr.RegisterSSRC(222, "bob", "voice-a")
+	vr.RegisterSSRC(333, "alice", "voice-a")
+	want := []SSRCMapping{{"voice-a", 222, "bob"}, {"voice-a", 333, "alice"}}
+	if got := vr.SSRCMappings(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("mappings %+v, want %+v", got, want)
+	}
+
+	// Leaving the channel drops the user's SSRC and ends their utterance
+	for i, opus := range encodeFrames(t, tone(10, 440, 8000)) {
+		_ = vr.ProcessVoicePacket(333, packet(333, i, opus))
+	}
+	<-starts
+	if active := vr.ActiveRecordings(); len(active) != 1 || active[0].UserID != "alice" {
+		t.Fatalf("active recordings %+v, want alice's", active)
+	}
+	vr.RemoveUser("alice", "voice-a")
+	select {
+	case stop := <-stops:
+		if stop.userID != "alice" || !stop.segment.Final {
+			t.Errorf("stop %+v, want alice's final segment", stop)
+		}
+	case <-time.After(time.Second):
+		t.Error("leaving did not stop alice's recording")
+	}
+	if got := vr.SSRCMappings(); len(got) != 1 || got[0].UserID != "bob" {
+		t.Errorf("mappings after alice left %+v, want only bob's", got)
+	}
+
+	// A new connection invalidates every SSRC
+	vr.RegisterSSRC(444, "carol", "voice-b")
+	vr.ClearSSRCs()
+	if got := vr.SSRCMappings(); len(got) != 0 {
+		t.Errorf("mappings after clearing %+v, want none", got)
+	}
+}
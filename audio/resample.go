@@ -0,0 +1,96 @@
+package audio
+
+import "math"
+
+const (
+	// resampleZeroCrossings is the half-width of the sinc kernel in zero crossings.
+	// 32 gives a steep anti-aliasing filter with negligible passband ripple for speech and music.
+	resampleZeroCrossings = 32
+	// resampleTableRes is the number of kernel table entries per zero crossing
+	resampleTableRes = 512
+	// resampleKaiserBeta trades transition width for stopband attenuation (~90dB)
+	resampleKaiserBeta = 8.6
+)
+
+// resampleKernel is a Kaiser-windowed sinc sampled at resampleTableRes points per zero crossing
+var resampleKernel = buildResampleKernel()
+
+func buildResampleKernel() []float64 {
+	n := resampleZeroCrossings*resampleTableRes + 1
+	table := make([]float64, n)
+	denom := besselI0(resampleKaiserBeta)
+	for i := range table {
+		x := float64(i) / resampleTableRes // Distance in zero crossings
+		ratio := x / resampleZeroCrossings
+		window := besselI0(resampleKaiserBeta*math.Sqrt(1-ratio*ratio)) / denom
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		table[i] = sinc * window
+	}
+	return table
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind (series expansion)
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	half := x / 2
+	for k := 1; k < 50; k++ {
+		term *= (half / float64(k)) * (half / float64(k))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+// kernelAt returns the windowed sinc value at distance x (in zero crossings), linearly interpolating the table
+func kernelAt(x float64) float64 {
+	x = math.Abs(x)
+	pos := x * resampleTableRes
+	i := int(pos)
+	if i >= len(resampleKernel)-1 {
+		return 0
+	}
+	frac := pos - float64(i)
+	return resampleKernel[i] + (resampleKernel[i+1]-resampleKernel[i])*frac
+}
+
+// Resample converts one channel of samples from one sample rate to another using band-limited
+// (windowed sinc) interpolation. When downsampling, the cutoff is lowered to the target Nyquist.
+func Resample(in []float64, fromRate, toRate int) []float64 {
+	if fromRate == toRate || len(in) == 0 {
+		out := make([]float64, len(in))
+		copy(out, in)
+		return out
+	}
+
+	ratio := float64(toRate) / float64(fromRate)
+	cutoff := math.Min(1, ratio) // Fraction of the input Nyquist to keep
+	outLen := int(math.Floor(float64(len(in)) * ratio))
+	out := make([]float64, outLen)
+
+	// Kernel half-width in input samples
+	halfWidth := float64(resampleZeroCrossings) / cutoff
+
+	for n := range out {
+		t := float64(n) / ratio // Position in input samples
+		start := int(math.Ceil(t - halfWidth))
+		end := int(math.Floor(t + halfWidth))
+		if start < 0 {
+			start = 0
+		}
+		if end > len(in)-1 {
+			end = len(in) - 1
+		}
+
+		var sum float64
+		for k := start; k <= end; k++ {
+			sum += in[k] * kernelAt((t-float64(k))*cutoff)
+		}
+		out[n] = sum * cutoff
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(n, rate int, hz float64) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = 0.5 * math.Sin(2*math.Pi*hz*float64(i)/float64(rate))
+	}
+	return out
+}
+
+func rms(x []float64) float64 {
+	return math.Sqrt(meanSquare(x))
+}
+
+func TestResampleRoundTrip(t *testing.T) {
+	for _, rate := range []int{8000, 16000, 24000} {
+		in := sine(SampleRate, SampleRate, 440)
+
+		down := Resample(in, SampleRate, rate)
+		if len(down) != rate {
+			t.Fatalf("%dHz: downsampled to %d samples, want %d", rate, len(down), rate)
+		}
+		back := Resample(down, rate, SampleRate)
+		if len(back) != len(in) {
+			t.Fatalf("%dHz: upsampled to %d samples, want %d", rate, len(back), len(in))
+		}
+
+		// Skip the edges, where the kernel runs off the ends of the signal
+		edge := SampleRate / 50
+		diff := make([]float64, 0, len(in)-2*edge)
+		for i := edge; i < len(in)-edge; i++ {
+			diff = append(diff, back[i]-in[i])
+		}
+		if e := rms(diff) / rms(in[edge:len(in)-edge]); e > 0.01 {
+			t.Errorf("%dHz: round trip error = %.4f, want below 0.01", rate, e)
+		}
+	}
+}
+
+func TestResampleRemovesContentAboveTargetNyquist(t *testing.T) {
+	// 10kHz cannot be represented at 16kHz and must not alias down into the speech band
+	out := Resample(sine(SampleRate, SampleRate, 10000), SampleRate, 16000)
+	edge := 16000 / 50
+	if level := rms(out[edge : len(out)-edge]); level > 0.01 {
+		t.Fatalf("10kHz tone at 16kHz has RMS %.4f, want it filtered out", level)
+	}
+}
+
+func TestResampleSameRateCopies(t *testing.T) {
+	in := []float64{0.1, -0.2, 0.3}
+	out := Resample(in, SampleRate, SampleRate)
+	out[0] = 1
+	if in[0] != 0.1 {
+		t.Fatal("Resample at the same rate returned the input slice instead of a copy")
+	}
+}
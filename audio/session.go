@@ -0,0 +1,254 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// VoiceSession is Dexter's voice presence in one guild: its connection, mixer and recorder
+type VoiceSession struct {
+	GuildID string
+
+	mu       sync.Mutex
+	conn     VoiceConnection
+	mixer    *AudioMixer
+	recorder *VoiceRecorder
+
+	sessionRec      *SessionRecording
+	resetting       bool // Watchdog reset in progress
+	voiceModeActive bool // Undeafened because humans are present
+}
+
+var (
+	sessions   = make(map[string]*VoiceSession)
+	sessionsMu sync.Mutex
+)
+
+// GetSession returns the voice session for a guild, or nil if Dexter has none there
+func GetSession(guildID string) *VoiceSession {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[guildID]
+}
+
+// GetOrCreateSession returns the voice session for a guild, creating it with a recorder from newRecorder if needed
+func GetOrCreateSession(guildID string, newRecorder func() (*VoiceRecorder, error)) (*VoiceSession, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if s, ok := sessions[guildID]; ok {
+		return s, nil
+	}
+
+	recorder, err := newRecorder()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &VoiceSession{GuildID: guildID, recorder: recorder}
+	sessions[guildID] = s
+	log.Printf("VoiceSession [%s]: Created", guildID)
+	return s, nil
+}
+
+// RemoveSession closes and forgets the voice session for a guild
+func RemoveSession(guildID string) {
+	sessionsMu.Lock()
+	s, ok := sessions[guildID]
+	delete(sessions, guildID)
+	sessionsMu.Unlock()
+
+	if ok {
+		s.Close()
+		log.Printf("VoiceSession [%s]: Removed", guildID)
+	}
+}
+
+// Sessions returns all voice sessions, ordered by guild ID
+func Sessions() []*VoiceSession {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	list := make([]*VoiceSession, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].GuildID < list[j].GuildID })
+	return list
+}
+
+// GetMixer returns the mixer of a guild's voice session, or nil
+func GetMixer(guildID string) *AudioMixer {
+	if s := GetSession(guildID); s != nil {
+		return s.Mixer()
+	}
+	return nil
+}
+
+// GetRecorder returns the recorder of a guild's voice session, or nil
+func GetRecorder(guildID string) *VoiceRecorder {
+	if s := GetSession(guildID); s != nil {
+		return s.Recorder()
+	}
+	return nil
+}
+
+// Connection returns the session's voice connection, or nil if not connected
+func (s *VoiceSession) Connection() VoiceConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+// ChannelID returns the voice channel the session is connected to, or ""
+func (s *VoiceSession) ChannelID() string {
+	if conn := s.Connection(); conn != nil {
+		return conn.ChannelID()
+	}
+	return ""
+}
+
+// Mixer returns the session's audio mixer, or nil if not connected
+func (s *VoiceSession) Mixer() *AudioMixer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mixer
+}
+
+// Recorder returns the session's voice recorder
+func (s *VoiceSession) Recorder() *VoiceRecorder {
+	return s.recorder
+}
+
+// SetConnection attaches a (new) voice connection and starts a fresh mixer for it.
+// Volume settings carry over from the previous mixer, or are restored from the guild's saved levels.
+func (s *VoiceSession) SetConnection(conn VoiceConnection) error {
+	mixer, err := NewAudioMixer(conn)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.mixer
+	s.conn = conn
+	s.mixer = mixer
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Stop()
+		mixer.SetLevels(old.Levels())
+	} else {
+		mixer.SetLevels(GuildMixLevels(s.GuildID))
+	}
+	s.mu.Lock()
+	mixer.SetSessionRecording(s.sessionRec)
+	s.mu.Unlock()
+	mixer.Start()
+	log.Printf("VoiceSession [%s]: Audio mixer started for channel %s", s.GuildID, conn.ChannelID())
+	return nil
+}
+
+// BeginReset marks the session as being reset by the watchdog if its connection is in a channel
+// but no longer ready. It returns false if the connection is fine or a reset is already running.
+func (s *VoiceSession) BeginReset() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resetting || s.conn == nil || s.conn.Ready() || s.conn.ChannelID() == "" {
+		return false
+	}
+	s.resetting = true
+	return true
+}
+
+// EndReset clears the watchdog reset flag
+func (s *VoiceSession) EndReset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetting = false
+}
+
+// VoiceModeActive reports whether the session was last set to listen and speak
+func (s *VoiceSession) VoiceModeActive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.voiceModeActive
+}
+
+// SetVoiceModeActive records whether the session is listening and speaking
+func (s *VoiceSession) SetVoiceModeActive(active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.voiceModeActive = active
+}
+
+// StartSessionRecording starts a multi-track recording of the session's voice channel
+func (s *VoiceSession) StartSessionRecording(nameFor func(userID string) string) (*SessionRecording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil, fmt.Errorf("not connected to a voice channel")
+	}
+	if s.sessionRec != nil {
+		return nil, fmt.Errorf("session recording %s is already running", s.sessionRec.ID())
+	}
+
+	rec, err := StartSessionRecording(s.GuildID, s.conn.ChannelID(), nameFor)
+	if err != nil {
+		return nil, err
+	}
+	s.sessionRec = rec
+	s.recorder.SetSessionRecording(rec)
+	if s.mixer != nil {
+		s.mixer.SetSessionRecording(rec)
+	}
+	return rec, nil
+}
+
+// SessionRecording returns the running session recording, or nil
+func (s *VoiceSession) SessionRecording() *SessionRecording {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionRec
+}
+
+// StopSessionRecording stops the running session recording and returns its manifest
+func (s *VoiceSession) StopSessionRecording() (SessionManifest, error) {
+	s.mu.Lock()
+	rec := s.sessionRec
+	s.sessionRec = nil
+	if s.mixer != nil {
+		s.mixer.SetSessionRecording(nil)
+	}
+	s.mu.Unlock()
+
+	if rec == nil {
+		return SessionManifest{}, fmt.Errorf("no session recording is running")
+	}
+	s.recorder.SetSessionRecording(nil)
+	return rec.Stop()
+}
+
+// Close stops recordings and the mixer. The voice connection itself is left to the caller.
+func (s *VoiceSession) Close() {
+	if s.SessionRecording() != nil {
+		if _, err := s.StopSessionRecording(); err != nil {
+			log.Printf("VoiceSession [%s]: Error stopping session recording: %v", s.GuildID, err)
+		}
+	}
+
+	s.mu.Lock()
+	mixer := s.mixer
+	s.mixer = nil
+	s.conn = nil
+	s.mu.Unlock()
+
+	if s.recorder != nil {
+		s.recorder.Close()
+		s.recorder.ClearSSRCs()
+	}
+	if mixer != nil {
+		mixer.Stop()
+	}
+}
@@ -0,0 +1,474 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"layeh.com/gopus"
+)
+
+const (
+	sessionFrame          = vadFrameMs * time.Millisecond
+	sessionMixLatency     = 50 // Frames (1s) the mixed track waits for late speaker audio
+	sessionSegmentGap     = 50 // Frames of silence (1s) that split a speaker's segments
+	sessionManifestFile   = "manifest.json"
+	sessionMixFile        = "mix.opus"
+	defaultRecordingsDays = 30
+)
+
+// SessionSpeaker is one speaker's track in a session recording
+type SessionSpeaker struct {
+	UserID   string          `json:"user_id"`
+	UserName string          `json:"user_name,omitempty"`
+	File     string          `json:"file"`
+	Segments []SpeechSegment `json:"segments"` // When the speaker was heard, relative to the session start
+}
+
+// SessionManifest describes a session recording on disk
+type SessionManifest struct {
+	ID         string           `json:"id"`
+	GuildID    string           `json:"guild_id"`
+	ChannelID  string           `json:"channel_id"`
+	StartedAt  time.Time        `json:"started_at"`
+	EndedAt    *time.Time       `json:"ended_at,omitempty"` // Unset while recording (or if the service died mid-session)
+	DurationMs int64            `json:"duration_ms"`
+	Format     string           `json:"format"`
+	Mix        string           `json:"mix"` // Every speaker plus Dexter's output
+	Speakers   []SessionSpeaker `json:"speakers"`
+}
+
+var (
+	recordingsMu        sync.RWMutex
+	recordingsDir       string
+	recordingsRetention = defaultRecordingsDays * 24 * time.Hour
+)
+
+// ConfigureSessionRecordings sets where session recordings are stored and how long they are kept (<= 0 keeps them forever)
+func ConfigureSessionRecordings(dir string, retention time.Duration) {
+	recordingsMu.Lock()
+	defer recordingsMu.Unlock()
+	recordingsDir = dir
+	recordingsRetention = retention
+}
+
+// SessionRecordingsDir returns the directory session recordings are stored in
+func SessionRecordingsDir() string {
+	recordingsMu.RLock()
+	defer recordingsMu.RUnlock()
+	if recordingsDir != "" {
+		return recordingsDir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "data", "discord", "recordings")
+}
+
+// sessionTrack is one Ogg/Opus file on the session timeline
+type sessionTrack struct {
+	file    *os.File
+	ogg     *OggOpusWriter
+	encoder *gopus.Encoder
+	silence []byte // Pre-encoded silent frame used to pad gaps
+	frames  int64  // Frames written so far (the track's position on the timeline)
+	speaker *SessionSpeaker
+}
+
+func newSessionTrack(path string, serial uint32) (*sessionTrack, error) {
+	encoder, err := gopus.NewEncoder(SampleRate, Channels, gopus.Audio)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	ogg, err := NewOggOpusWriter(file, Channels, serial)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// A silent frame from a fresh encoder decodes to silence on its own, so it can be repeated cheaply
+	silenceEncoder, err := gopus.NewEncoder(SampleRate, Channels, gopus.Audio)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	silence, err := silenceEncoder.Encode(make([]int16, FrameSize*Channels), FrameSize, FrameBytes)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &sessionTrack{file: file, ogg: ogg, encoder: encoder, silence: silence}, nil
+}
+
+func (t *sessionTrack) write(pcm []int16) error {
+	packet, err := t.encoder.Encode(pcm, FrameSize, FrameBytes)
+	if err != nil {
+		return err
+	}
+	t.frames++
+	return t.ogg.WritePacket(packet, FrameSize)
+}
+
+// padTo writes silence until the track reaches frame
+func (t *sessionTrack) padTo(frame int64) error {
+	for t.frames < frame {
+		if err := t.ogg.WritePacket(t.silence, FrameSize); err != nil {
+			return err
+		}
+		t.frames++
+	}
+	return nil
+}
+
+func (t *sessionTrack) close() error {
+	err := t.ogg.Close()
+	if cerr := t.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SessionRecording records every speaker in a voice channel to their own track, plus a mixed track that
+// also carries Dexter's output, all aligned on a timeline that starts when the recording does.
+type SessionRecording struct {
+	mu       sync.Mutex
+	dir      string
+	start    time.Time
+	manifest SessionManifest
+	nameFor  func(userID string) string
+	tracks   map[string]*sessionTrack
+	mix      *sessionTrack
+	mixBuf   map[int64][]int32 // Pending mix frames by timeline index
+	stopped  bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartSessionRecording begins recording a guild's voice channel into a new directory under SessionRecordingsDir.
+// nameFor, if set, resolves user IDs to display names for the manifest.
+func StartSessionRecording(guildID, channelID string, nameFor func(userID string) string) (*SessionRecording, error) {
+	start := time.Now()
+	id := start.UTC().Format("20060102-150405") + "-" + strconv.FormatInt(int64(rand.Intn(1<<16)), 36)
+	dir := filepath.Join(SessionRecordingsDir(), id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	mix, err := newSessionTrack(filepath.Join(dir, sessionMixFile), rand.Uint32())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mix track: %w", err)
+	}
+
+	r := &SessionRecording{
+		dir:   dir,
+		start: start,
+		manifest: SessionManifest{
+			ID:        id,
+			GuildID:   guildID,
+			ChannelID: channelID,
+			StartedAt: start,
+			Format:    "ogg/opus",
+			Mix:       sessionMixFile,
+			Speakers:  []SessionSpeaker{},
+		},
+		nameFor: nameFor,
+		tracks:  make(map[string]*sessionTrack),
+		mix:     mix,
+		mixBuf:  make(map[int64][]int32),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := r.writeManifest(); err != nil {
+		log.Printf("Session recording %s: failed to write manifest: %v", id, err)
+	}
+
+	go r.run()
+	log.Printf("Session recording %s: started in channel %s", id, channelID)
+	return r, nil
+}
+
+// ID returns the recording's ID
+func (r *SessionRecording) ID() string {
+	return r.manifest.ID
+}
+
+// frameAt returns the timeline frame index for a wall clock time
+func (r *SessionRecording) frameAt(at time.Time) int64 {
+	return int64(at.Sub(r.start) / sessionFrame)
+}
+
+// AddSpeakerFrame records one 20ms frame of a user's audio that arrived at the given time
+func (r *SessionRecording) AddSpeakerFrame(userID string, pcm []int16, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+
+	track, ok := r.tracks[userID]
+	if !ok {
+		var err error
+		file := userID + ".opus"
+		track, err = newSessionTrack(filepath.Join(r.dir, file), rand.Uint32())
+		if err != nil {
+			log.Printf("Session recording %s: failed to create track for %s: %v", r.manifest.ID, userID, err)
+			return
+		}
+		speaker := SessionSpeaker{UserID: userID, File: file}
+		if r.nameFor != nil {
+			speaker.UserName = r.nameFor(userID)
+		}
+		r.manifest.Speakers = append(r.manifest.Speakers, speaker)
+		r.tracks[userID] = track
+		r.relinkSpeakers() // append may have moved the slice
+	}
+
+	// Packets arrive in bursts; only jump ahead on a real gap so the track stays continuous
+	frame := r.frameAt(at)
+	if frame > track.frames+2 {
+		if err := track.padTo(frame); err != nil {
+			log.Printf("Session recording %s: write failed: %v", r.manifest.ID, err)
+			return
+		}
+	}
+
+	pos := track.frames
+	if err := track.write(pcm); err != nil {
+		log.Printf("Session recording %s: write failed: %v", r.manifest.ID, err)
+		return
+	}
+	r.addToMix(pos, pcm)
+
+	startMs, endMs := int(pos)*vadFrameMs, int(pos+1)*vadFrameMs
+	segments := track.speaker.Segments
+	if n := len(segments); n > 0 && startMs-segments[n-1].EndMs < sessionSegmentGap*vadFrameMs {
+		segments[n-1].EndMs = endMs
+	} else {
+		track.speaker.Segments = append(segments, SpeechSegment{StartMs: startMs, EndMs: endMs})
+	}
+}
+
+// relinkSpeakers points each track at its manifest entry. Caller holds mu.
+func (r *SessionRecording) relinkSpeakers() {
+	for i := range r.manifest.Speakers {
+		if track, ok := r.tracks[r.manifest.Speakers[i].UserID]; ok {
+			track.speaker = &r.manifest.Speakers[i]
+		}
+	}
+}
+
+// AddOutputFrame adds one 20ms frame of Dexter's own output, finished sending at the given time, to the mix
+func (r *SessionRecording) AddOutputFrame(pcm []int16, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	r.addToMix(r.frameAt(at.Add(-sessionFrame)), pcm)
+}
+
+// addToMix sums a frame into the pending mix. Frames already flushed are dropped. Caller holds mu.
+func (r *SessionRecording) addToMix(frame int64, pcm []int16) {
+	if frame < r.mix.frames {
+		return
+	}
+	buf, ok := r.mixBuf[frame]
+	if !ok {
+		buf = make([]int32, FrameSize*Channels)
+		r.mixBuf[frame] = buf
+	}
+	for i := 0; i < len(buf) && i < len(pcm); i++ {
+		buf[i] += int32(pcm[i])
+	}
+}
+
+// run flushes the mixed track once late speaker audio can no longer arrive
+func (r *SessionRecording) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			r.flushMix(r.frameAt(time.Now()) - sessionMixLatency)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// flushMix writes mix frames up to (not including) frame. Caller holds mu.
+func (r *SessionRecording) flushMix(frame int64) {
+	out := make([]int16, FrameSize*Channels)
+	for r.mix.frames < frame {
+		buf, ok := r.mixBuf[r.mix.frames]
+		if !ok {
+			if err := r.mix.padTo(r.mix.frames + 1); err != nil {
+				log.Printf("Session recording %s: mix write failed: %v", r.manifest.ID, err)
+				return
+			}
+			continue
+		}
+		delete(r.mixBuf, r.mix.frames)
+		for i, v := range buf {
+			out[i] = int16(max(-32768, min(32767, v)))
+		}
+		if err := r.mix.write(out); err != nil {
+			log.Printf("Session recording %s: mix write failed: %v", r.manifest.ID, err)
+			return
+		}
+	}
+}
+
+// Stop finishes every track and writes the final manifest
+func (r *SessionRecording) Stop() (SessionManifest, error) {
+	r.mu.Lock()
+	if r.stopped {
+		manifest := r.manifest
+		r.mu.Unlock()
+		return manifest, nil
+	}
+	r.stopped = true
+	r.mu.Unlock()
+
+	close(r.stop)
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	end := time.Now()
+	r.flushMix(r.frameAt(end) + 1)
+
+	var firstErr error
+	for _, track := range r.tracks {
+		if err := track.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := r.mix.close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	r.manifest.EndedAt = &end
+	r.manifest.DurationMs = end.Sub(r.start).Milliseconds()
+	if err := r.writeManifest(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	log.Printf("Session recording %s: stopped after %s with %d speakers", r.manifest.ID, end.Sub(r.start).Round(time.Second), len(r.manifest.Speakers))
+	return r.manifest, firstErr
+}
+
+func (r *SessionRecording) writeManifest() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, sessionManifestFile), data, 0644)
+}
+
+// LoadSessionManifest reads a session recording's manifest by ID
+func LoadSessionManifest(id string) (SessionManifest, error) {
+	var manifest SessionManifest
+	if id == "" || id != filepath.Base(id) {
+		return manifest, fmt.Errorf("invalid recording ID")
+	}
+	data, err := os.ReadFile(filepath.Join(SessionRecordingsDir(), id, sessionManifestFile))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// SessionRecordingFile returns the path of a file belonging to a recording, if the manifest lists it
+func SessionRecordingFile(id, file string) (string, error) {
+	manifest, err := LoadSessionManifest(id)
+	if err != nil {
+		return "", err
+	}
+	if file == sessionManifestFile || file == manifest.Mix {
+		return filepath.Join(SessionRecordingsDir(), id, file), nil
+	}
+	for _, speaker := range manifest.Speakers {
+		if speaker.File == file {
+			return filepath.Join(SessionRecordingsDir(), id, file), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+// ListSessionRecordings returns the manifests of all stored session recordings, newest first
+func ListSessionRecordings() ([]SessionManifest, error) {
+	entries, err := os.ReadDir(SessionRecordingsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []SessionManifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := LoadSessionManifest(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].StartedAt.After(manifests[j].StartedAt) })
+	return manifests, nil
+}
+
+// PruneSessionRecordings deletes finished recordings older than the retention period and returns how many were removed
+func PruneSessionRecordings() int {
+	recordingsMu.RLock()
+	retention := recordingsRetention
+	recordingsMu.RUnlock()
+	if retention <= 0 {
+		return 0
+	}
+
+	manifests, err := ListSessionRecordings()
+	if err != nil {
+		log.Printf("Session recordings: failed to list for pruning: %v", err)
+		return 0
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-retention)
+	for _, manifest := range manifests {
+		if manifest.EndedAt == nil && time.Since(manifest.StartedAt) < 24*time.Hour {
+			continue // Possibly still recording
+		}
+		if manifest.StartedAt.After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(SessionRecordingsDir(), manifest.ID)); err != nil {
+			log.Printf("Session recordings: failed to remove %s: %v", manifest.ID, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("Session recordings: pruned %d older than %s", removed, retention)
+	}
+	return removed
+}
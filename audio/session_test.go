@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"testing"
+)
+
+func newTestSession(t *testing.T, guildID string) (*VoiceSession, *LoopbackConnection) {
+	t.Helper()
+	session, err := GetOrCreateSession(guildID, func() (*VoiceRecorder, error) {
+		vr, _, _ := newTestRecorder(t, guildID)
+		return vr, nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+	t.Cleanup(func() { RemoveSession(guildID) })
+
+	conn := NewLoopbackConnection()
+	t.Cleanup(conn.Close)
+	if err := session.SetConnection(conn); err != nil {
+		t.Fatalf("SetConnection: %v", err)
+	}
+	return session, conn
+}
+
+func TestSessionSetConnection(t *testing.T) {
+	const guildID = "session-guild"
+	levels := DefaultMixLevels()
+	levels.Voice = 0.4
+	SaveGuildMixLevels(guildID, levels)
+	t.Cleanup(func() {
+		guildLevelsMu.Lock()
+		delete(guildLevels, guildID)
+		guildLevelsMu.Unlock()
+	})
+
+	session, conn := newTestSession(t, guildID)
+	if session.Connection() != conn {
+		t.Fatal("Connection() did not return the loopback connection")
+	}
+	if GetMixer(guildID) == nil {
+		t.Fatal("no mixer after SetConnection")
+	}
+	if got := session.Mixer().Levels(); got != levels {
+		t.Fatalf("mixer levels = %+v, want the guild's saved %+v", got, levels)
+	}
+
+	// A reconnect keeps the levels of the running mixer
+	session.Mixer().SetLevels(DefaultMixLevels())
+	next := NewLoopbackConnection()
+	t.Cleanup(next.Close)
+	if err := session.SetConnection(next); err != nil {
+		t.Fatalf("SetConnection: %v", err)
+	}
+	if got := session.Mixer().Levels(); got != DefaultMixLevels() {
+		t.Fatalf("mixer levels after reconnect = %+v, want them carried over", got)
+	}
+}
+
+func TestSessionChannelIDFollowsConnection(t *testing.T) {
+	session, conn := newTestSession(t, "channel-guild")
+	if got := session.ChannelID(); got != "loopback" {
+		t.Fatalf("ChannelID() = %q, want %q", got, "loopback")
+	}
+	conn.SetChannel("moved")
+	if got := session.ChannelID(); got != "moved" {
+		t.Fatalf("ChannelID() after a move = %q, want %q", got, "moved")
+	}
+	if err := conn.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if got := session.ChannelID(); got != "" {
+		t.Fatalf("ChannelID() after disconnect = %q, want empty", got)
+	}
+}
+
+func TestSessionBeginReset(t *testing.T) {
+	session, conn := newTestSession(t, "reset-guild")
+	if session.BeginReset() {
+		t.Fatal("BeginReset() = true for a ready connection")
+	}
+
+	conn.SetReady(false)
+	if !session.BeginReset() {
+		t.Fatal("BeginReset() = false for a stale connection")
+	}
+	if session.BeginReset() {
+		t.Fatal("BeginReset() = true while a reset is already running")
+	}
+	session.EndReset()
+	if !session.BeginReset() {
+		t.Fatal("BeginReset() = false after EndReset on a still stale connection")
+	}
+	session.EndReset()
+
+	// A connection that has left its channel is not the watchdog's to reset
+	conn.SetChannel("")
+	if session.BeginReset() {
+		t.Fatal("BeginReset() = true for a connection without a channel")
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	const guildID = "close-guild"
+	session, _ := newTestSession(t, guildID)
+	RemoveSession(guildID)
+
+	if GetSession(guildID) != nil {
+		t.Fatal("session still registered after RemoveSession")
+	}
+	if session.Connection() != nil || session.Mixer() != nil {
+		t.Fatal("Close left the connection or mixer attached")
+	}
+	if session.BeginReset() {
+		t.Fatal("BeginReset() = true for a closed session")
+	}
+}
@@ -0,0 +1,193 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxClipSeconds keeps the soundboard to stingers; longer files are skipped
+const maxClipSeconds = 30
+
+// ErrUnknownClip is returned when no soundboard clip has the requested name
+var ErrUnknownClip = errors.New("unknown sound clip")
+
+// clipNamePattern is what a file name (without extension) must look like to become a clip
+var clipNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// SoundClip is a soundboard clip, decoded once to 48kHz stereo and cached
+type SoundClip struct {
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	DurationMs int64  `json:"duration_ms"`
+
+	pcm     []int16
+	modTime time.Time
+}
+
+var (
+	soundboardMu  sync.Mutex
+	soundboardDir string
+	soundClips    = make(map[string]*SoundClip)
+)
+
+// ConfigureSoundboard sets the directory clips are loaded from
+func ConfigureSoundboard(dir string) {
+	soundboardMu.Lock()
+	defer soundboardMu.Unlock()
+	soundboardDir = dir
+	soundClips = make(map[string]*SoundClip)
+}
+
+// SoundboardDir returns the directory clips are loaded from
+func SoundboardDir() string {
+	soundboardMu.Lock()
+	defer soundboardMu.Unlock()
+	return soundboardDirLocked()
+}
+
+func soundboardDirLocked() string {
+	if soundboardDir != "" {
+		return soundboardDir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "data", "discord", "sounds")
+}
+
+// RefreshSoundboard rescans the clip directory, decoding new or changed files and dropping
+// deleted ones, and returns the clips sorted by name.
+func RefreshSoundboard() ([]SoundClip, error) {
+	soundboardMu.Lock()
+	defer soundboardMu.Unlock()
+
+	dir := soundboardDirLocked()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read soundboard directory: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		file := entry.Name()
+		name := strings.ToLower(strings.TrimSuffix(file, filepath.Ext(file)))
+		if !clipNamePattern.MatchString(name) || seen[name] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seen[name] = true
+
+		if cached, ok := soundClips[name]; ok && cached.File == file && cached.modTime.Equal(info.ModTime()) {
+			continue
+		}
+		pcm, err := decodeClip(filepath.Join(dir, file))
+		if err != nil {
+			log.Printf("Soundboard: skipping %s: %v", file, err)
+			delete(soundClips, name)
+			continue
+		}
+		soundClips[name] = &SoundClip{
+			Name:       name,
+			File:       file,
+			DurationMs: int64(len(pcm) / Channels * 1000 / SampleRate),
+			pcm:        pcm,
+			modTime:    info.ModTime(),
+		}
+	}
+	for name := range soundClips {
+		if !seen[name] {
+			delete(soundClips, name)
+		}
+	}
+
+	clips := make([]SoundClip, 0, len(soundClips))
+	for _, clip := range soundClips {
+		clips = append(clips, SoundClip{Name: clip.Name, File: clip.File, DurationMs: clip.DurationMs})
+	}
+	sort.Slice(clips, func(i, j int) bool { return clips[i].Name < clips[j].Name })
+	return clips, nil
+}
+
+// getSoundClip returns a cached clip, rescanning the directory once if it is not known yet
+func getSoundClip(name string) (*SoundClip, error) {
+	name = strings.ToLower(name)
+	soundboardMu.Lock()
+	clip, ok := soundClips[name]
+	soundboardMu.Unlock()
+	if ok {
+		return clip, nil
+	}
+
+	if _, err := RefreshSoundboard(); err != nil {
+		return nil, err
+	}
+	soundboardMu.Lock()
+	defer soundboardMu.Unlock()
+	if clip, ok := soundClips[name]; ok {
+		return clip, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownClip, name)
+}
+
+// PlaySoundClip layers a clip over the guild's voice and music on the effects bus
+func PlaySoundClip(guildID, name string) (SoundClip, error) {
+	clip, err := getSoundClip(name)
+	if err != nil {
+		return SoundClip{}, err
+	}
+	mixer := GetMixer(guildID)
+	if mixer == nil {
+		return SoundClip{}, fmt.Errorf("no active audio mixer")
+	}
+	mixer.PlayEffect(clip.pcm)
+	return SoundClip{Name: clip.Name, File: clip.File, DurationMs: clip.DurationMs}, nil
+}
+
+// decodeClip reads a clip as 48kHz stereo; WAV is decoded natively and anything else by ffmpeg
+func decodeClip(path string) ([]int16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pcm []int16
+	if IsWAV(data) {
+		pcm, err = DecodeWAV(data)
+	}
+	if pcm == nil {
+		out, ffErr := exec.Command("ffmpeg", "-v", "error", "-i", path, "-t", fmt.Sprint(maxClipSeconds+1), "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1").Output()
+		if ffErr != nil {
+			if err != nil {
+				return nil, fmt.Errorf("%v; ffmpeg: %w", err, ffErr)
+			}
+			return nil, fmt.Errorf("ffmpeg: %w", ffErr)
+		}
+		pcm = make([]int16, len(out)/2)
+		if err := binary.Read(bytes.NewReader(out[:len(pcm)*2]), binary.LittleEndian, pcm); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("no audio")
+	}
+	if len(pcm) > maxClipSeconds*SampleRate*Channels {
+		return nil, fmt.Errorf("longer than %ds", maxClipSeconds)
+	}
+	return pcm, nil
+}
@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// STTStreamRate is the sample rate of audio sent to the streaming STT endpoint (mono s16le)
+	STTStreamRate = echoRate
+
+	sttStreamBacklog = 500 // Frames (10s) buffered while connecting before audio is dropped
+	sttDialTimeout   = 5 * time.Second
+)
+
+// STTResult is a transcript returned by the STT service
+type STTResult struct {
+	Type        string  `json:"type"` // "partial" or "final"
+	Text        string  `json:"text"`
+	Language    string  `json:"language,omitempty"`
+	Probability float64 `json:"probability,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// STTStreamURL turns the STT service's HTTP base URL into its streaming WebSocket endpoint
+func STTStreamURL(serviceURL string) string {
+	u := strings.TrimSuffix(serviceURL, "/")
+	u = strings.Replace(u, "https://", "wss://", 1)
+	u = strings.Replace(u, "http://", "ws://", 1)
+	return fmt.Sprintf("%s/stream?sample_rate=%d&channels=1&encoding=s16le", u, STTStreamRate)
+}
+
+// STTStream forwards one utterance to the streaming STT endpoint while it is being spoken.
+// Audio is sent as binary 16kHz mono s16le messages; the service replies with JSON partial
+// results and, after {"type":"end"}, a final one.
+type STTStream struct {
+	frames    chan []int16
+	final     chan STTResult
+	failed    chan struct{}
+	failOnce  sync.Once
+	err       error
+	conn      *websocket.Conn
+	connMu    sync.Mutex
+	onPartial func(STTResult)
+	dec       decimator
+	done      sync.WaitGroup // run and readResults
+}
+
+// DialSTTStream starts a streaming session in the background and returns immediately;
+// audio sent before the connection is up is buffered.
+func DialSTTStream(url string, onPartial func(STTResult)) *STTStream {
+	s := &STTStream{
+		frames:    make(chan []int16, sttStreamBacklog),
+		final:     make(chan STTResult, 1),
+		failed:    make(chan struct{}),
+		onPartial: onPartial,
+	}
+	s.done.Add(1)
+	go s.run(url)
+	return s
+}
+
+// Send queues one 48kHz stereo frame. It never blocks; if the backlog is full the stream is failed
+// and the caller falls back to the recorded file.
+func (s *STTStream) Send(pcm []int16) {
+	select {
+	case <-s.failed:
+		return
+	default:
+	}
+
+	select {
+	case s.frames <- pcm:
+	default:
+		s.fail(errors.New("streaming STT backlog full"))
+	}
+}
+
+// Finish signals the end of the utterance and waits for the final transcript
+func (s *STTStream) Finish(timeout time.Duration) (STTResult, error) {
+	close(s.frames)
+	defer s.close()
+
+	select {
+	case result := <-s.final:
+		return result, nil
+	case <-s.failed:
+		return STTResult{}, s.err
+	case <-time.After(timeout):
+		return STTResult{}, errors.New("timed out waiting for final transcript")
+	}
+}
+
+// Cancel abandons the stream without waiting for a transcript
+func (s *STTStream) Cancel() {
+	s.fail(errors.New("cancelled"))
+	s.close()
+}
+
+func (s *STTStream) fail(err error) {
+	s.failOnce.Do(func() {
+		s.err = err
+		close(s.failed)
+	})
+}
+
+func (s *STTStream) close() {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// run connects, then writes queued audio until Finish closes the frame channel or the stream fails
+func (s *STTStream) run(url string) {
+	defer s.done.Done()
+	dialer := websocket.Dialer{HandshakeTimeout: sttDialTimeout}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to connect to streaming STT: %w", err))
+		return
+	}
+
+	// Cancel may have run while dialing, before there was a connection for it to close
+	s.connMu.Lock()
+	select {
+	case <-s.failed:
+		s.connMu.Unlock()
+		_ = conn.Close()
+		return
+	default:
+	}
+	s.conn = conn
+	s.connMu.Unlock()
+
+	s.done.Add(1)
+	go s.readResults(conn)
+
+	for {
+		select {
+		case <-s.failed:
+			return
+		case pcm, ok := <-s.frames:
+			if !ok {
+				if err := conn.WriteJSON(map[string]string{"type": "end"}); err != nil {
+					s.fail(fmt.Errorf("streaming STT end failed: %w", err))
+				}
+				return
+			}
+			if err := s.writeFrame(conn, pcm); err != nil {
+				s.fail(fmt.Errorf("streaming STT write failed: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// writeFrame sends one 48kHz stereo frame as 16kHz mono s16le
+func (s *STTStream) writeFrame(conn *websocket.Conn, pcm []int16) error {
+	samples := s.dec.process(downmix(pcm))
+	buf := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(floatToInt16(v)))
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+// readResults dispatches partial transcripts and delivers the final one
+func (s *STTStream) readResults(conn *websocket.Conn) {
+	defer s.done.Done()
+	for {
+		var result STTResult
+		if err := conn.ReadJSON(&result); err != nil {
+			s.fail(fmt.Errorf("streaming STT read failed: %w", err))
+			return
+		}
+
+		switch result.Type {
+		case "partial":
+			if s.onPartial != nil {
+				s.onPartial(result)
+			}
+		case "final":
+			s.final <- result
+			return
+		case "error":
+			s.fail(fmt.Errorf("streaming STT error: %s", result.Error))
+			return
+		default:
+			log.Printf("Streaming STT: ignoring message type %q", result.Type)
+		}
+	}
+}
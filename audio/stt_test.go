@@ -0,0 +1,128 @@
+package audio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sttServer is a fake streaming STT service. Each connection reports the messages it reads on
+// messages and is closed on closed once the client goes away.
+type sttServer struct {
+	url      string
+	accept   chan struct{} // Receives a value to let each handshake complete
+	messages chan string
+	closed   chan struct{}
+}
+
+func newSTTServer(t *testing.T, final string) *sttServer {
+	t.Helper()
+	srv := &sttServer{
+		accept:   make(chan struct{}, 1),
+		messages: make(chan string, 100),
+		closed:   make(chan struct{}, 1),
+	}
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-srv.accept
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				srv.closed <- struct{}{}
+				return
+			}
+			if kind == websocket.TextMessage {
+				_ = conn.WriteJSON(STTResult{Type: "final", Text: final})
+			}
+			srv.messages <- string(data)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	srv.url = STTStreamURL(ts.URL)
+	return srv
+}
+
+// waitStreamDone fails the test if the stream's goroutines do not exit
+func waitStreamDone(t *testing.T, s *STTStream) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream goroutines still running")
+	}
+}
+
+func waitClosed(t *testing.T, srv *sttServer) {
+	t.Helper()
+	select {
+	case <-srv.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client never closed the WebSocket")
+	}
+}
+
+func TestSTTStreamFinish(t *testing.T) {
+	srv := newSTTServer(t, "hello there")
+	srv.accept <- struct{}{}
+
+	s := DialSTTStream(srv.url, nil)
+	s.Send(constantFrame(1000))
+	result, err := s.Finish(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if result.Text != "hello there" {
+		t.Fatalf("final transcript = %q, want %q", result.Text, "hello there")
+	}
+	if audio := <-srv.messages; len(audio) != FrameSize/(SampleRate/STTStreamRate)*2 {
+		t.Fatalf("sent %d bytes of audio for one frame", len(audio))
+	}
+	waitStreamDone(t, s)
+	waitClosed(t, srv)
+}
+
+func TestSTTStreamCancelBeforeConnect(t *testing.T) {
+	srv := newSTTServer(t, "")
+	s := DialSTTStream(srv.url, nil)
+	s.Send(constantFrame(1000))
+	s.Cancel()
+
+	// The handshake only completes after the cancellation
+	srv.accept <- struct{}{}
+	waitClosed(t, srv)
+	waitStreamDone(t, s)
+	if len(srv.messages) != 0 {
+		t.Fatalf("%d messages sent after the stream was cancelled", len(srv.messages))
+	}
+}
+
+func TestSTTStreamCancelAfterConnect(t *testing.T) {
+	srv := newSTTServer(t, "")
+	srv.accept <- struct{}{}
+
+	s := DialSTTStream(srv.url, nil)
+	s.Send(constantFrame(1000))
+	select {
+	case <-srv.messages:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no audio reached the server")
+	}
+
+	// The writer is now idle, waiting for frames that never come
+	s.Cancel()
+	waitClosed(t, srv)
+	waitStreamDone(t, s)
+}
@@ -0,0 +1,326 @@
+package audio
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// speakingStopGrace holds back a stopped event; speech resuming within it continues the same span,
+	// so a user pausing for breath does not produce a burst of started/stopped events
+	speakingStopGrace = time.Second
+	// interruptionMinTalk is how long someone must already have been talking for a new speaker to count as interrupting them
+	interruptionMinTalk = time.Second
+	// talkStatsTTL is refreshed on every update, so stats cover calls within the last 30 days
+	talkStatsTTL = 30 * 24 * time.Hour
+)
+
+// SpeakingUpdate is a throttled speaking started/stopped transition for one user
+type SpeakingUpdate struct {
+	UserID            string
+	ChannelID         string
+	SSRC              uint32
+	Speaking          bool
+	Duration          time.Duration // Stopped only: from the first word to the last of the span
+	TalkTime          time.Duration // Stopped only: voiced time within the span
+	Overlapping       bool          // Started only: someone else was already talking
+	InterruptedDexter bool          // Started only: Dexter was speaking
+}
+
+// TalkStats are talk-time totals for a user or a channel
+type TalkStats struct {
+	TalkMs              int64 `json:"talk_ms"`
+	Utterances          int64 `json:"utterances"`
+	Overlaps            int64 `json:"overlaps"`              // Started talking while someone else was
+	Interruptions       int64 `json:"interruptions"`         // Started talking over someone mid-sentence
+	Interrupted         int64 `json:"interrupted,omitempty"` // Was talked over (per user only)
+	DexterInterruptions int64 `json:"dexter_interruptions"`  // Started talking while Dexter was speaking
+}
+
+func (s *TalkStats) apply(field string, v int64) {
+	switch field {
+	case "talk_ms":
+		s.TalkMs = v
+	case "utterances":
+		s.Utterances = v
+	case "overlaps":
+		s.Overlaps = v
+	case "interruptions":
+		s.Interruptions = v
+	case "interrupted":
+		s.Interrupted = v
+	case "dexter_interruptions":
+		s.DexterInterruptions = v
+	}
+}
+
+// SpeakerTalkStats is one user's share of a channel's talk time
+type SpeakerTalkStats struct {
+	UserID string `json:"user_id"`
+	TalkStats
+	Share float64 `json:"share"` // Fraction of the channel's talk time
+}
+
+// ChannelTalkStats are a channel's totals and its speakers, most talkative first
+type ChannelTalkStats struct {
+	ChannelID string `json:"channel_id"`
+	TalkStats
+	Speakers []SpeakerTalkStats `json:"speakers"`
+}
+
+func channelStatsKey(channelID string) string { return "voice:stats:channel:" + channelID }
+func channelUsersKey(channelID string) string { return "voice:stats:channel:" + channelID + ":users" }
+func userStatsKey(userID string) string       { return "voice:stats:user:" + userID }
+
+// talkSpan is a user's utterance in progress
+type talkSpan struct {
+	start     time.Time
+	channelID string
+}
+
+// speakingState is a user's span in the throttled event stream, which may cover several utterances
+type speakingState struct {
+	started   time.Time
+	last      time.Time
+	channelID string
+	ssrc      uint32
+	talked    time.Duration
+	stopTimer *time.Timer // Pending stopped event
+}
+
+// talkTracker turns a recorder's utterances into speaking events and talk-time statistics
+type talkTracker struct {
+	redis *redis.Client
+	ctx   context.Context
+
+	mu         sync.Mutex
+	active     map[string]*talkSpan
+	speaking   map[string]*speakingState
+	onSpeaking func(SpeakingUpdate)
+}
+
+func newTalkTracker(ctx context.Context, rdb *redis.Client) *talkTracker {
+	return &talkTracker{
+		redis:    rdb,
+		ctx:      ctx,
+		active:   make(map[string]*talkSpan),
+		speaking: make(map[string]*speakingState),
+	}
+}
+
+func (t *talkTracker) setHandler(fn func(SpeakingUpdate)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onSpeaking = fn
+}
+
+// start records the beginning of an utterance
+func (t *talkTracker) start(userID, channelID string, ssrc uint32, dexterSpeaking bool) {
+	now := time.Now()
+
+	t.mu.Lock()
+	overlapping := false
+	var interrupted []string
+	for other, span := range t.active {
+		if other == userID || span.channelID != channelID {
+			continue
+		}
+		overlapping = true
+		if now.Sub(span.start) >= interruptionMinTalk {
+			interrupted = append(interrupted, other)
+		}
+	}
+	t.active[userID] = &talkSpan{start: now, channelID: channelID}
+
+	state := t.speaking[userID]
+	var moved *speakingState // Span left open in another channel
+	emit := false
+	if state != nil && state.stopTimer != nil {
+		state.stopTimer.Stop()
+		state.stopTimer = nil
+	}
+	if state != nil && state.channelID != channelID {
+		moved, state = state, nil
+	}
+	if state == nil {
+		// Otherwise speech resumed within the grace period and continues the same span
+		state = &speakingState{started: now, channelID: channelID, ssrc: ssrc}
+		t.speaking[userID] = state
+		emit = true
+	}
+	onSpeaking := t.onSpeaking
+	t.mu.Unlock()
+
+	if moved != nil && onSpeaking != nil {
+		onSpeaking(moved.stopped(userID))
+	}
+
+	counts := map[string]int64{}
+	if overlapping {
+		counts["overlaps"] = 1
+	}
+	if len(interrupted) > 0 {
+		counts["interruptions"] = 1
+	}
+	if dexterSpeaking {
+		counts["dexter_interruptions"] = 1
+	}
+	if len(counts) > 0 {
+		go t.record(channelID, userID, counts)
+	}
+	for _, other := range interrupted {
+		go t.record(channelID, other, map[string]int64{"interrupted": 1})
+	}
+
+	if emit && onSpeaking != nil {
+		onSpeaking(SpeakingUpdate{
+			UserID:            userID,
+			ChannelID:         channelID,
+			SSRC:              ssrc,
+			Speaking:          true,
+			Overlapping:       overlapping,
+			InterruptedDexter: dexterSpeaking,
+		})
+	}
+}
+
+// stop records the end of an utterance whose last speech was at end
+func (t *talkTracker) stop(userID string, end time.Time) {
+	t.mu.Lock()
+	span := t.active[userID]
+	if span == nil {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.active, userID)
+	talked := max(end.Sub(span.start), 0)
+
+	if state := t.speaking[userID]; state != nil {
+		state.talked += talked
+		state.last = end
+		var timer *time.Timer
+		timer = time.AfterFunc(speakingStopGrace, func() {
+			// timer is assigned under t.mu, so it is read under it too
+			t.mu.Lock()
+			fired := timer
+			t.mu.Unlock()
+			t.flush(userID, fired)
+		})
+		state.stopTimer = timer
+	}
+	t.mu.Unlock()
+
+	go t.record(span.channelID, userID, map[string]int64{"talk_ms": talked.Milliseconds(), "utterances": 1})
+}
+
+// flush emits the stopped event for a span once its grace period has passed without more speech
+func (t *talkTracker) flush(userID string, timer *time.Timer) {
+	t.mu.Lock()
+	state := t.speaking[userID]
+	if state == nil || state.stopTimer != timer {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.speaking, userID)
+	onSpeaking := t.onSpeaking
+	t.mu.Unlock()
+
+	if onSpeaking != nil {
+		onSpeaking(state.stopped(userID))
+	}
+}
+
+func (s *speakingState) stopped(userID string) SpeakingUpdate {
+	return SpeakingUpdate{
+		UserID:    userID,
+		ChannelID: s.channelID,
+		SSRC:      s.ssrc,
+		Duration:  max(s.last.Sub(s.started), 0),
+		TalkTime:  s.talked,
+	}
+}
+
+// record adds to a user's totals, their totals in the channel and (except "interrupted") the channel's totals
+func (t *talkTracker) record(channelID, userID string, counts map[string]int64) {
+	if t.redis == nil {
+		return
+	}
+	pipe := t.redis.Pipeline()
+	for field, v := range counts {
+		pipe.HIncrBy(t.ctx, userStatsKey(userID), field, v)
+		pipe.HIncrBy(t.ctx, channelUsersKey(channelID), userID+"."+field, v)
+		if field != "interrupted" {
+			pipe.HIncrBy(t.ctx, channelStatsKey(channelID), field, v)
+		}
+	}
+	for _, key := range []string{userStatsKey(userID), channelUsersKey(channelID), channelStatsKey(channelID)} {
+		pipe.Expire(t.ctx, key, talkStatsTTL)
+	}
+	if _, err := pipe.Exec(t.ctx); err != nil {
+		log.Printf("Talk stats: failed to record for user %s in channel %s: %v", userID, channelID, err)
+	}
+}
+
+// GetUserTalkStats returns a user's talk-time totals across all channels
+func GetUserTalkStats(ctx context.Context, rdb *redis.Client, userID string) (TalkStats, error) {
+	var stats TalkStats
+	fields, err := rdb.HGetAll(ctx, userStatsKey(userID)).Result()
+	if err != nil {
+		return stats, err
+	}
+	for field, v := range fields {
+		stats.apply(field, parseInt64(v))
+	}
+	return stats, nil
+}
+
+// GetChannelTalkStats returns a channel's talk-time totals and its speakers, most talkative first
+func GetChannelTalkStats(ctx context.Context, rdb *redis.Client, channelID string) (ChannelTalkStats, error) {
+	stats := ChannelTalkStats{ChannelID: channelID, Speakers: []SpeakerTalkStats{}}
+
+	totals, err := rdb.HGetAll(ctx, channelStatsKey(channelID)).Result()
+	if err != nil {
+		return stats, err
+	}
+	for field, v := range totals {
+		stats.apply(field, parseInt64(v))
+	}
+
+	users, err := rdb.HGetAll(ctx, channelUsersKey(channelID)).Result()
+	if err != nil {
+		return stats, err
+	}
+	byUser := make(map[string]*SpeakerTalkStats)
+	for key, v := range users {
+		userID, field, ok := strings.Cut(key, ".")
+		if !ok {
+			continue
+		}
+		speaker := byUser[userID]
+		if speaker == nil {
+			speaker = &SpeakerTalkStats{UserID: userID}
+			byUser[userID] = speaker
+		}
+		speaker.apply(field, parseInt64(v))
+	}
+	for _, speaker := range byUser {
+		if stats.TalkMs > 0 {
+			speaker.Share = float64(speaker.TalkMs) / float64(stats.TalkMs)
+		}
+		stats.Speakers = append(stats.Speakers, *speaker)
+	}
+	sort.Slice(stats.Speakers, func(i, j int) bool { return stats.Speakers[i].TalkMs > stats.Speakers[j].TalkMs })
+	return stats, nil
+}
+
+func parseInt64(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
@@ -0,0 +1,119 @@
+//go:build ignore
+
+// gen_vad_fixtures writes the synthetic WAV fixtures used by the VAD tests:
+// speech.wav (two vowel-like utterances), keyboard.wav (key clicks) and silence.wav
+// (background noise only), all 16kHz mono over the same faint noise floor.
+//
+//	go run gen_vad_fixtures.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+)
+
+const rate = 16000
+
+var rng = rand.New(rand.NewSource(31))
+
+// background returns seconds of faint white noise (about -65dBFS)
+func background(seconds float64) []float64 {
+	out := make([]float64, int(seconds*rate))
+	for i := range out {
+		out[i] = rng.NormFloat64() * 0.0006
+	}
+	return out
+}
+
+// resonator is a two-pole band-pass filter, a crude vocal tract formant
+type resonator struct {
+	a1, a2, gain float64
+	y1, y2       float64
+}
+
+func newResonator(hz, bandwidth float64) *resonator {
+	r := math.Exp(-math.Pi * bandwidth / rate)
+	return &resonator{a1: 2 * r * math.Cos(2*math.Pi*hz/rate), a2: -r * r, gain: 1 - r}
+}
+
+func (f *resonator) next(x float64) float64 {
+	y := f.gain*x + f.a1*f.y1 + f.a2*f.y2
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// addSpeech mixes syllables of a glottal pulse train through vowel formants into out from start for seconds
+func addSpeech(out []float64, start, seconds float64) {
+	vowels := [][3]float64{{730, 1090, 2440}, {270, 2290, 3010}, {300, 870, 2240}, {530, 1840, 2480}}
+	syllable := int(0.22 * rate)
+	from := int(start * rate)
+	to := from + int(seconds*rate)
+	for s := from; s < to; s += syllable {
+		v := vowels[rng.Intn(len(vowels))]
+		formants := []*resonator{newResonator(v[0], 90), newResonator(v[1], 110), newResonator(v[2], 170)}
+		f0 := 110 + rng.Float64()*40
+		phase := 0.0
+		for i := 0; i < syllable && s+i < to; i++ {
+			phase += f0 / rate
+			pulse := 0.0
+			if phase >= 1 {
+				phase--
+				pulse = 1
+			}
+			pulse += rng.NormFloat64() * 0.02 // Breath
+			var y float64
+			for _, f := range formants {
+				y += f.next(pulse)
+			}
+			envelope := math.Sin(math.Pi * float64(i) / float64(syllable))
+			out[s+i] += y * envelope * 0.9
+		}
+	}
+}
+
+// addClicks mixes short decaying noise bursts, like mechanical key presses, into out
+func addClicks(out []float64) {
+	for pos := int(0.3 * rate); pos < len(out)-rate/10; pos += int((0.08 + rng.Float64()*0.17) * rate) {
+		amplitude := 0.2 + rng.Float64()*0.2
+		for i := 0; i < rate/100 && pos+i < len(out); i++ {
+			out[pos+i] += rng.NormFloat64() * amplitude * math.Exp(-float64(i)/(0.002*rate))
+		}
+	}
+}
+
+func writeWAV(name string, samples []float64) {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+len(samples)*2))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{16})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{rate, rate * 2})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(samples)*2))
+	for _, s := range samples {
+		_ = binary.Write(&buf, binary.LittleEndian, int16(math.Max(-1, math.Min(1, s))*32767))
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	// Utterances at 0.5-2.0s and 4.0-5.0s
+	speech := background(5.5)
+	addSpeech(speech, 0.5, 1.5)
+	addSpeech(speech, 4.0, 1.0)
+	writeWAV("speech.wav", speech)
+
+	keyboard := background(3)
+	addClicks(keyboard)
+	writeWAV("keyboard.wav", keyboard)
+
+	writeWAV("silence.wav", background(3))
+}
@@ -0,0 +1,147 @@
+package audio
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Reasons a transcript is dropped, as reported in metrics
+const (
+	DropLowProbability = "low_probability"
+	DropLanguage       = "language"
+	DropHallucination  = "hallucination"
+	DropTooManyWords   = "too_many_words"
+)
+
+// TranscriptFilterConfig controls which transcripts are trusted as real speech.
+// Zero fields fall back to DefaultTranscriptFilterConfig.
+type TranscriptFilterConfig struct {
+	Disabled       bool     `json:"disabled"`
+	MinProbability float64  `json:"min_probability"` // Lowest STT probability kept; negative disables
+	Languages      []string `json:"languages"`       // Languages kept (e.g. "en"); empty keeps all
+	DenyPhrases    []string `json:"deny_phrases"`    // Transcripts consisting of only one of these are dropped
+	MinMsPerWord   int      `json:"min_ms_per_word"` // Less audio than this per word is not speech; negative disables
+}
+
+// defaultDenyPhrases are what Whisper-style models commonly produce from silence and noise
+var defaultDenyPhrases = []string{
+	"thank you for watching",
+	"thanks for watching",
+	"thank you for watching and please subscribe",
+	"thanks for watching and dont forget to subscribe",
+	"please subscribe",
+	"like and subscribe",
+	"subscribe to my channel",
+	"see you in the next video",
+	"subtitles by the amaraorg community",
+}
+
+// DefaultTranscriptFilterConfig drops transcripts below 40% probability, the usual silence
+// hallucinations, and more than 10 words per second of audio
+func DefaultTranscriptFilterConfig() TranscriptFilterConfig {
+	return TranscriptFilterConfig{
+		MinProbability: 0.4,
+		DenyPhrases:    defaultDenyPhrases,
+		MinMsPerWord:   100,
+	}
+}
+
+// Merge returns c with every non-zero field of override applied on top
+func (c TranscriptFilterConfig) Merge(override TranscriptFilterConfig) TranscriptFilterConfig {
+	c.Disabled = c.Disabled || override.Disabled
+	if override.MinProbability != 0 {
+		c.MinProbability = override.MinProbability
+	}
+	if len(override.Languages) > 0 {
+		c.Languages = override.Languages
+	}
+	if len(override.DenyPhrases) > 0 {
+		c.DenyPhrases = override.DenyPhrases
+	}
+	if override.MinMsPerWord != 0 {
+		c.MinMsPerWord = override.MinMsPerWord
+	}
+	return c
+}
+
+var (
+	filterMu     sync.RWMutex
+	filterConfig = DefaultTranscriptFilterConfig()
+	denyPhrases  = normalizePhrases(filterConfig.DenyPhrases)
+)
+
+// ConfigureTranscriptFilter sets the transcript filter (merged onto the defaults)
+func ConfigureTranscriptFilter(cfg TranscriptFilterConfig) {
+	merged := DefaultTranscriptFilterConfig().Merge(cfg)
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	filterConfig = merged
+	denyPhrases = normalizePhrases(merged.DenyPhrases)
+}
+
+func normalizePhrases(phrases []string) map[string]bool {
+	set := make(map[string]bool, len(phrases))
+	for _, phrase := range phrases {
+		if p := normalizeTranscript(phrase); p != "" {
+			set[p] = true
+		}
+	}
+	return set
+}
+
+// normalizeTranscript lowercases text, drops punctuation and collapses whitespace,
+// so "Thank you for watching!" matches "thank you for watching"
+func normalizeTranscript(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// FilterTranscript returns why a transcript should be dropped, or "" to keep it.
+// Probability and language are only checked when the STT service reported them.
+func FilterTranscript(result STTResult, segment Segment) string {
+	filterMu.RLock()
+	defer filterMu.RUnlock()
+	cfg := filterConfig
+	if cfg.Disabled {
+		return ""
+	}
+
+	if cfg.MinProbability > 0 && result.Probability > 0 && result.Probability < cfg.MinProbability {
+		return DropLowProbability
+	}
+	if len(cfg.Languages) > 0 && result.Language != "" && !languageAllowed(result.Language, cfg.Languages) {
+		return DropLanguage
+	}
+
+	normalized := normalizeTranscript(result.Text)
+	if normalized == "" || denyPhrases[normalized] {
+		return DropHallucination
+	}
+
+	words := len(strings.Fields(normalized))
+	if cfg.MinMsPerWord > 0 && segment.DurationMs > 0 && segment.DurationMs < int64(words*cfg.MinMsPerWord) {
+		return DropTooManyWords
+	}
+	return ""
+}
+
+// languageAllowed matches a language code by its primary subtag, so "en" allows "en-US"
+func languageAllowed(language string, allowed []string) bool {
+	primary, _, _ := strings.Cut(strings.ToLower(language), "-")
+	for _, lang := range allowed {
+		want, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(lang)), "-")
+		if want == primary {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package audio
+
+import "testing"
+
+func TestFilterTranscript(t *testing.T) {
+	oneSecond := Segment{UtteranceID: "utt", Final: true, DurationMs: 1000}
+	tests := []struct {
+		name    string
+		cfg     TranscriptFilterConfig
+		result  STTResult
+		segment Segment
+		want    string
+	}{
+		{"kept", TranscriptFilterConfig{}, STTResult{Text: "turn it up", Probability: 0.9}, oneSecond, ""},
+		{"a lone you is real speech", TranscriptFilterConfig{}, STTResult{Text: "You.", Probability: 0.9}, oneSecond, ""},
+		{"low probability", TranscriptFilterConfig{}, STTResult{Text: "turn it up", Probability: 0.2}, oneSecond, DropLowProbability},
+		{"probability not reported", TranscriptFilterConfig{}, STTResult{Text: "turn it up"}, oneSecond, ""},
+		{"probability check disabled", TranscriptFilterConfig{MinProbability: -1}, STTResult{Text: "turn it up", Probability: 0.2}, oneSecond, ""},
+		{"language not allowed", TranscriptFilterConfig{Languages: []string{"en"}}, STTResult{Text: "monte le son", Language: "fr"}, oneSecond, DropLanguage},
+		{"language by primary subtag", TranscriptFilterConfig{Languages: []string{"en"}}, STTResult{Text: "turn it up", Language: "en-GB"}, oneSecond, ""},
+		{"hallucination", TranscriptFilterConfig{}, STTResult{Text: "Thanks for watching!"}, oneSecond, DropHallucination},
+		{"hallucination inside real speech", TranscriptFilterConfig{}, STTResult{Text: "thanks for watching the stream with me"}, oneSecond, ""},
+		{"custom deny phrases", TranscriptFilterConfig{DenyPhrases: []string{"bye"}}, STTResult{Text: "Bye."}, oneSecond, DropHallucination},
+		{"only punctuation", TranscriptFilterConfig{}, STTResult{Text: " ... "}, oneSecond, DropHallucination},
+		{"too many words", TranscriptFilterConfig{}, STTResult{Text: "one two three four five six"}, Segment{DurationMs: 500}, DropTooManyWords},
+		{"duration unknown", TranscriptFilterConfig{}, STTResult{Text: "one two three four five six"}, Segment{}, ""},
+		{"word rate check disabled", TranscriptFilterConfig{MinMsPerWord: -1}, STTResult{Text: "one two three four five six"}, Segment{DurationMs: 500}, ""},
+		{"filter disabled", TranscriptFilterConfig{Disabled: true}, STTResult{Text: "Thanks for watching", Probability: 0.1}, oneSecond, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigureTranscriptFilter(tt.cfg)
+			t.Cleanup(func() { ConfigureTranscriptFilter(TranscriptFilterConfig{}) })
+			if got := FilterTranscript(tt.result, tt.segment); got != tt.want {
+				t.Fatalf("FilterTranscript(%q) = %q, want %q", tt.result.Text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+const (
+	vadFrameMs = 20
+	vadFFTSize = 1024 // One 20ms frame (960 samples) zero-padded
+
+	// Speech band used for the band-energy ratio and spectral flatness
+	vadSpeechLowHz  = 300
+	vadSpeechHighHz = 3400
+)
+
+// VADConfig controls voice activity detection. Zero fields fall back to DefaultVADConfig;
+// a negative SNR threshold, hangover or pre-roll turns that feature off.
+type VADConfig struct {
+	EnergyThresholdDB   float64 `json:"energy_threshold_db"`   // Minimum frame level in dBFS
+	SNRThresholdDB      float64 `json:"snr_threshold_db"`      // Required level above the adaptive noise floor; negative disables
+	MinSpeechBandRatio  float64 `json:"min_speech_band_ratio"` // Share of energy that must fall in 300-3400Hz
+	MaxSpectralFlatness float64 `json:"max_spectral_flatness"` // Above this the frame is noise-like (0 = tone, ~0.56 = white noise)
+	MinSpeechMs         int     `json:"min_speech_ms"`         // Consecutive speech needed before an utterance starts
+	HangoverMs          int     `json:"hangover_ms"`           // Frames after speech still counted as speech; negative disables
+	PreRollMs           int     `json:"pre_roll_ms"`           // Audio kept from before the onset; negative disables
+	SilenceTimeoutMs    int     `json:"silence_timeout_ms"`    // Non-speech time that ends an utterance
+	BargeInThreshold    float64 `json:"barge_in_threshold"`    // RMS needed to count as speech while Dexter is talking
+}
+
+// DefaultVADConfig returns thresholds tuned for Discord voice
+func DefaultVADConfig() VADConfig {
+	return VADConfig{
+		EnergyThresholdDB:   -50,
+		SNRThresholdDB:      9,
+		MinSpeechBandRatio:  0.45,
+		MaxSpectralFlatness: 0.45,
+		MinSpeechMs:         60,
+		HangoverMs:          300,
+		PreRollMs:           300,
+		SilenceTimeoutMs:    1500, // Allow natural pauses/thinking time
+		BargeInThreshold:    1000, // Roughly -30dB, significantly louder than typical acoustic echo
+	}
+}
+
+// Merge returns c with every non-zero field of override applied on top
+func (c VADConfig) Merge(override VADConfig) VADConfig {
+	if override.EnergyThresholdDB != 0 {
+		c.EnergyThresholdDB = override.EnergyThresholdDB
+	}
+	if override.SNRThresholdDB != 0 {
+		c.SNRThresholdDB = override.SNRThresholdDB
+	}
+	if override.MinSpeechBandRatio != 0 {
+		c.MinSpeechBandRatio = override.MinSpeechBandRatio
+	}
+	if override.MaxSpectralFlatness != 0 {
+		c.MaxSpectralFlatness = override.MaxSpectralFlatness
+	}
+	if override.MinSpeechMs != 0 {
+		c.MinSpeechMs = override.MinSpeechMs
+	}
+	if override.HangoverMs != 0 {
+		c.HangoverMs = override.HangoverMs
+	}
+	if override.PreRollMs != 0 {
+		c.PreRollMs = override.PreRollMs
+	}
+	if override.SilenceTimeoutMs != 0 {
+		c.SilenceTimeoutMs = override.SilenceTimeoutMs
+	}
+	if override.BargeInThreshold != 0 {
+		c.BargeInThreshold = override.BargeInThreshold
+	}
+	return c
+}
+
+var (
+	vadMu       sync.RWMutex
+	vadDefaults = DefaultVADConfig()
+	vadGuilds   = map[string]VADConfig{}
+)
+
+// ConfigureVAD sets the service-wide VAD settings and per-guild overrides (both merged onto the defaults)
+func ConfigureVAD(defaults VADConfig, guilds map[string]VADConfig) {
+	vadMu.Lock()
+	defer vadMu.Unlock()
+	vadDefaults = DefaultVADConfig().Merge(defaults)
+	vadGuilds = make(map[string]VADConfig, len(guilds))
+	for guildID, cfg := range guilds {
+		vadGuilds[guildID] = cfg
+	}
+}
+
+// GetVADConfig returns the effective VAD settings for a guild
+func GetVADConfig(guildID string) VADConfig {
+	vadMu.RLock()
+	defer vadMu.RUnlock()
+	return vadDefaults.Merge(vadGuilds[guildID])
+}
+
+// VADFrame is the detector's verdict on one 20ms frame
+type VADFrame struct {
+	Speech  bool    // Frame is speech (or within the hangover after speech)
+	Voiced  bool    // The frame itself classed as speech, ignoring the hangover
+	Onset   bool    // An utterance starts with this frame
+	PreRoll []int16 // On onset, the audio buffered before this frame
+	LevelDB float64 // Frame level in dBFS
+}
+
+// VAD is a frame-by-frame voice activity detector for one speaker. It combines frame energy
+// against an adaptive noise floor with the share of energy in the speech band and the spectral
+// flatness, so steady hum and broadband noise do not hold an utterance open.
+type VAD struct {
+	cfg        VADConfig
+	noiseFloor float64 // Mean square, normalised to full scale
+	speechRun  int     // Consecutive speech frames before onset
+	hangover   int     // Frames left in the hangover
+	active     bool
+	history    [][]int16 // Recent frames kept for pre-roll
+	maxHistory int
+}
+
+// NewVAD creates a detector with the given settings
+func NewVAD(cfg VADConfig) *VAD {
+	cfg = DefaultVADConfig().Merge(cfg)
+	return &VAD{
+		cfg:        cfg,
+		noiseFloor: dbToPower(cfg.EnergyThresholdDB),
+		maxHistory: (max(cfg.PreRollMs, 0) + cfg.MinSpeechMs) / vadFrameMs,
+	}
+}
+
+// Active reports whether the detector is inside an utterance (including hangover)
+func (v *VAD) Active() bool {
+	return v.active
+}
+
+// Process classifies one frame of 48kHz interleaved stereo audio
+func (v *VAD) Process(pcm []int16) VADFrame {
+	power, isSpeech := v.classify(pcm)
+	result := VADFrame{LevelDB: powerToDB(power), Voiced: isSpeech}
+
+	if !v.active {
+		if isSpeech {
+			v.speechRun++
+		} else {
+			v.speechRun = 0
+		}
+
+		if v.speechRun*vadFrameMs >= v.cfg.MinSpeechMs {
+			v.active = true
+			v.speechRun = 0
+			v.hangover = max(v.cfg.HangoverMs, 0) / vadFrameMs
+			result.Speech = true
+			result.Onset = true
+			for _, frame := range v.history {
+				result.PreRoll = append(result.PreRoll, frame...)
+			}
+			v.history = nil
+			return result
+		}
+
+		v.remember(pcm)
+		return result
+	}
+
+	if isSpeech {
+		v.hangover = max(v.cfg.HangoverMs, 0) / vadFrameMs
+		result.Speech = true
+	} else if v.hangover > 0 {
+		v.hangover--
+		result.Speech = true
+	} else {
+		v.active = false
+	}
+	return result
+}
+
+// remember keeps a copy of a frame for pre-roll
+func (v *VAD) remember(pcm []int16) {
+	if v.maxHistory <= 0 {
+		return
+	}
+	frame := make([]int16, len(pcm))
+	copy(frame, pcm)
+	v.history = append(v.history, frame)
+	if len(v.history) > v.maxHistory {
+		v.history = v.history[len(v.history)-v.maxHistory:]
+	}
+}
+
+// classify computes the frame features, updates the noise floor and returns the frame power and verdict
+func (v *VAD) classify(pcm []int16) (float64, bool) {
+	mono := downmix(pcm)
+	power := meanSquare(mono)
+	levelDB := powerToDB(power)
+	snrDB := levelDB - powerToDB(v.noiseFloor)
+
+	isSpeech := levelDB >= v.cfg.EnergyThresholdDB && (v.cfg.SNRThresholdDB < 0 || snrDB >= v.cfg.SNRThresholdDB)
+	if isSpeech {
+		bandRatio, flatness := spectralFeatures(mono)
+		isSpeech = bandRatio >= v.cfg.MinSpeechBandRatio && flatness <= v.cfg.MaxSpectralFlatness
+	}
+
+	// Track the noise floor: quickly downward, slowly upward, and barely at all during an utterance
+	switch {
+	case power < v.noiseFloor:
+		v.noiseFloor = 0.7*v.noiseFloor + 0.3*power
+	case isSpeech || v.active:
+		v.noiseFloor = 0.999*v.noiseFloor + 0.001*power
+	default:
+		v.noiseFloor = 0.95*v.noiseFloor + 0.05*power
+	}
+	v.noiseFloor = math.Max(v.noiseFloor, dbToPower(-90))
+
+	return power, isSpeech
+}
+
+// downmix averages interleaved stereo into mono samples scaled to [-1, 1]
+func downmix(pcm []int16) []float64 {
+	mono := make([]float64, len(pcm)/Channels)
+	for i := range mono {
+		mono[i] = (float64(pcm[i*2]) + float64(pcm[i*2+1])) / (2 * 32768)
+	}
+	return mono
+}
+
+func meanSquare(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range x {
+		sum += s * s
+	}
+	return sum / float64(len(x))
+}
+
+func powerToDB(p float64) float64 {
+	return 10 * math.Log10(p+1e-12)
+}
+
+func dbToPower(db float64) float64 {
+	return math.Pow(10, db/10)
+}
+
+// spectralFeatures returns the share of energy in the speech band and the spectral flatness within it
+func spectralFeatures(mono []float64) (bandRatio, flatness float64) {
+	buf := make([]complex128, vadFFTSize)
+	n := len(mono)
+	for i := 0; i < n && i < vadFFTSize; i++ {
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) // Hann
+		buf[i] = complex(mono[i]*window, 0)
+	}
+	fft(buf)
+
+	binHz := float64(SampleRate) / vadFFTSize
+	lowBin := int(vadSpeechLowHz / binHz)
+	highBin := int(vadSpeechHighHz / binHz)
+
+	var total, band, logSum float64
+	for k := 1; k < vadFFTSize/2; k++ {
+		p := real(buf[k])*real(buf[k]) + imag(buf[k])*imag(buf[k])
+		total += p
+		if k >= lowBin && k <= highBin {
+			band += p
+			logSum += math.Log(p + 1e-20)
+		}
+	}
+	if total == 0 {
+		return 0, 1
+	}
+
+	bins := float64(highBin - lowBin + 1)
+	geometric := math.Exp(logSum / bins)
+	arithmetic := band / bins
+	return band / total, geometric / arithmetic
+}
+
+// fft is an in-place iterative radix-2 FFT; len(x) must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// SpeechSegment is a detected utterance in an analysed recording
+type SpeechSegment struct {
+	StartMs int `json:"start_ms"`
+	EndMs   int `json:"end_ms"`
+}
+
+// DetectSpeech runs the VAD over 48kHz interleaved stereo audio and returns the utterances it
+// would have recorded, ending each after SilenceTimeoutMs without speech. Used to tune settings
+// offline against WAV fixtures.
+func DetectSpeech(pcm []int16, cfg VADConfig) []SpeechSegment {
+	cfg = DefaultVADConfig().Merge(cfg)
+	vad := NewVAD(cfg)
+	frameLen := FrameSize * Channels
+
+	var segments []SpeechSegment
+	var current *SpeechSegment
+	lastSpeechMs := 0
+
+	for i := 0; i+frameLen <= len(pcm); i += frameLen {
+		nowMs := i / frameLen * vadFrameMs
+		res := vad.Process(pcm[i : i+frameLen])
+
+		if res.Onset && current == nil {
+			preRollMs := len(res.PreRoll) / frameLen * vadFrameMs
+			current = &SpeechSegment{StartMs: nowMs - preRollMs}
+		}
+		if current == nil {
+			continue
+		}
+		if res.Speech {
+			lastSpeechMs = nowMs + vadFrameMs
+		} else if nowMs-lastSpeechMs >= cfg.SilenceTimeoutMs {
+			current.EndMs = lastSpeechMs
+			segments = append(segments, *current)
+			current = nil
+		}
+	}
+
+	if current != nil {
+		current.EndMs = lastSpeechMs
+		segments = append(segments, *current)
+	}
+	return segments
+}
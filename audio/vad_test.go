@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadFixture decodes a WAV from testdata (see testdata/gen_vad_fixtures.go) to 48kHz stereo
+func loadFixture(t *testing.T, name string) []int16 {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	pcm, err := DecodeWAV(data)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	return pcm
+}
+
+func TestDetectSpeech(t *testing.T) {
+	// Utterances in speech.wav run from 0.5-2.0s and 4.0-5.0s; segments include pre-roll and hangover
+	const toleranceMs = 100
+	tests := []struct {
+		name    string
+		fixture string
+		cfg     VADConfig
+		want    []SpeechSegment
+	}{
+		{"speech", "speech.wav", VADConfig{}, []SpeechSegment{{180, 1940}, {3680, 5300}}},
+		{"speech without pre-roll or hangover", "speech.wav", VADConfig{PreRollMs: -1, HangoverMs: -1}, []SpeechSegment{{480, 1560}, {3980, 4200}}},
+		{"speech with a long silence timeout", "speech.wav", VADConfig{SilenceTimeoutMs: 3000}, []SpeechSegment{{180, 5300}}},
+		{"speech below the energy threshold", "speech.wav", VADConfig{EnergyThresholdDB: -20}, nil},
+		{"keyboard", "keyboard.wav", VADConfig{}, nil},
+		{"keyboard without level gates", "keyboard.wav", VADConfig{EnergyThresholdDB: -80, SNRThresholdDB: -1}, nil},
+		{"silence", "silence.wav", VADConfig{}, nil},
+		{"silence without level gates", "silence.wav", VADConfig{EnergyThresholdDB: -80, SNRThresholdDB: -1}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectSpeech(loadFixture(t, tt.fixture), tt.cfg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("DetectSpeech() = %+v, want %+v", got, tt.want)
+			}
+			for i, seg := range got {
+				want := tt.want[i]
+				if abs(seg.StartMs-want.StartMs) > toleranceMs || abs(seg.EndMs-want.EndMs) > toleranceMs {
+					t.Errorf("segment %d = %+v, want %+v (±%dms)", i, seg, want, toleranceMs)
+				}
+			}
+		})
+	}
+}
+
+func TestVADConfigMerge(t *testing.T) {
+	base := DefaultVADConfig()
+
+	got := base.Merge(VADConfig{SNRThresholdDB: 12})
+	if got.SNRThresholdDB != 12 || got.HangoverMs != base.HangoverMs {
+		t.Fatalf("Merge() = %+v, want only the SNR threshold changed", got)
+	}
+
+	// Negative values survive the merge and turn the feature off instead of falling back
+	got = base.Merge(VADConfig{SNRThresholdDB: -1, HangoverMs: -1, PreRollMs: -1})
+	if got.SNRThresholdDB >= 0 || got.HangoverMs >= 0 || got.PreRollMs >= 0 {
+		t.Fatalf("Merge() = %+v, want negative values kept", got)
+	}
+	vad := NewVAD(got)
+	if vad.maxHistory != got.MinSpeechMs/vadFrameMs {
+		t.Fatalf("pre-roll history = %d frames, want only the %d onset frames", vad.maxHistory, got.MinSpeechMs/vadFrameMs)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnsupportedFormat is returned by the native decoders for input they cannot handle.
+// Callers should fall back to ffmpeg.
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// IsWAV reports whether data starts with a RIFF/WAVE header
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// DecodeWAV decodes a PCM or IEEE float WAV file into 48kHz stereo s16 samples (interleaved),
+// resampling and up/down-mixing as needed.
+func DecodeWAV(data []byte) ([]int16, error) {
+	if !IsWAV(data) {
+		return nil, fmt.Errorf("%w: not a RIFF/WAVE file", ErrUnsupportedFormat)
+	}
+
+	var (
+		format, numChannels, bitsPerSample int
+		sampleRate                         int
+		pcm                                []byte
+		haveFmt                            bool
+	)
+
+	// Walk the chunks after the 12 byte RIFF header
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		end := body + size
+		if end > len(data) {
+			// Streaming writers often leave the data size as 0 or 0xFFFFFFFF; take what is there
+			end = len(data)
+		}
+
+		switch id {
+		case "fmt ":
+			if end-body < 16 {
+				return nil, fmt.Errorf("%w: truncated fmt chunk", ErrUnsupportedFormat)
+			}
+			chunk := data[body:end]
+			format = int(binary.LittleEndian.Uint16(chunk[0:2]))
+			numChannels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+			if format == wavFormatExtensible && len(chunk) >= 26 {
+				// The real format is the first two bytes of the SubFormat GUID
+				format = int(binary.LittleEndian.Uint16(chunk[24:26]))
+			}
+			haveFmt = true
+		case "data":
+			pcm = data[body:end]
+		}
+
+		// Chunks are word aligned
+		pos = end + (size & 1)
+		if pcm != nil {
+			break
+		}
+	}
+
+	if !haveFmt || pcm == nil {
+		return nil, fmt.Errorf("%w: missing fmt or data chunk", ErrUnsupportedFormat)
+	}
+	if numChannels < 1 || sampleRate < 1 {
+		return nil, fmt.Errorf("%w: invalid channel count or sample rate", ErrUnsupportedFormat)
+	}
+
+	channelsData, err := deinterleaveWAV(pcm, format, numChannels, bitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+
+	// Map to stereo: mono is duplicated, extra channels beyond the first two are dropped
+	left := channelsData[0]
+	right := left
+	if numChannels > 1 {
+		right = channelsData[1]
+	}
+
+	left = Resample(left, sampleRate, SampleRate)
+	if numChannels > 1 {
+		right = Resample(right, sampleRate, SampleRate)
+	} else {
+		right = left
+	}
+
+	out := make([]int16, len(left)*Channels)
+	for i := range left {
+		out[i*2] = floatToInt16(left[i])
+		out[i*2+1] = floatToInt16(right[i])
+	}
+	return out, nil
+}
+
+// deinterleaveWAV converts raw WAV sample data into per-channel float samples in [-1, 1]
+func deinterleaveWAV(pcm []byte, format, numChannels, bitsPerSample int) ([][]float64, error) {
+	bytesPerSample := bitsPerSample / 8
+	switch {
+	case format == wavFormatPCM && (bitsPerSample == 8 || bitsPerSample == 16 || bitsPerSample == 24 || bitsPerSample == 32):
+	case format == wavFormatFloat && (bitsPerSample == 32 || bitsPerSample == 64):
+	default:
+		return nil, fmt.Errorf("%w: format %d with %d bits per sample", ErrUnsupportedFormat, format, bitsPerSample)
+	}
+
+	frameBytes := bytesPerSample * numChannels
+	frames := len(pcm) / frameBytes
+	out := make([][]float64, numChannels)
+	for c := range out {
+		out[c] = make([]float64, frames)
+	}
+
+	for f := 0; f < frames; f++ {
+		for c := 0; c < numChannels; c++ {
+			b := pcm[f*frameBytes+c*bytesPerSample:]
+			var v float64
+			switch {
+			case format == wavFormatFloat && bitsPerSample == 32:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			case format == wavFormatFloat:
+				v = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			case bitsPerSample == 8:
+				v = (float64(b[0]) - 128) / 128 // 8-bit WAV is unsigned
+			case bitsPerSample == 16:
+				v = float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+			case bitsPerSample == 24:
+				s := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+				v = float64(s) / 8388608
+			case bitsPerSample == 32:
+				v = float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+			}
+			out[c][f] = v
+		}
+	}
+	return out, nil
+}
+
+func floatToInt16(v float64) int16 {
+	v = math.Round(v * 32767)
+	if v > 32767 {
+		return 32767
+	}
+	if v < -32768 {
+		return -32768
+	}
+	return int16(v)
+}
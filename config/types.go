@@ -13,14 +13,81 @@ type SystemConfig = sharedConfig.SystemConfig
 
 // DiscordOptions holds Discord-specific settings
 type DiscordOptions struct {
-	Token               string     `json:"token"`
-	ServerID            string     `json:"server_id"`
-	DebugChannelID      string     `json:"debug_channel_id"`
-	BuildChannelID      string     `json:"build_channel_id"`
-	MasterUser          string     `json:"master_user"`
-	DefaultVoiceChannel string     `json:"default_voice_channel"`
-	QuietMode           bool       `json:"quiet_mode"`
-	Roles               RoleConfig `json:"roles"`
+	Token               string                  `json:"token"`
+	ServerID            string                  `json:"server_id"`
+	DebugChannelID      string                  `json:"debug_channel_id"`
+	BuildChannelID      string                  `json:"build_channel_id"`
+	MasterUser          string                  `json:"master_user"`
+	DefaultVoiceChannel string                  `json:"default_voice_channel"`
+	QuietMode           bool                    `json:"quiet_mode"`
+	Roles               RoleConfig              `json:"roles"`
+	VoiceActivity       VADOptions              `json:"voice_activity"`
+	EchoCancellation    EchoOptions             `json:"echo_cancellation"`
+	StreamingSTT        bool                    `json:"streaming_stt"` // Forward speech to the STT service's WebSocket endpoint while users talk
+	Capture             CaptureOptions          `json:"capture"`
+	VoicePresence       VoicePresenceOptions    `json:"voice_presence"`
+	SessionRecording    SessionRecordingOptions `json:"session_recording"`
+	AnnounceRecording   bool                    `json:"announce_recording"` // Tell people who join Dexter's channel that voice is recorded
+	MediaStore          MediaStoreOptions       `json:"media_store"`
+	SoundboardDir       string                  `json:"soundboard_dir"` // Sound clips for /audio/sfx; defaults to ~/.local/data/discord/sounds
+	Listening           ListeningOptions        `json:"listening"`
+	TranscriptFilter    TranscriptFilterOptions `json:"transcript_filter"`
+	Captions            map[string]string       `json:"captions"` // Voice channel ID -> "voice" (its own text chat) or a text channel or thread ID
+	Reader              ReaderOptions           `json:"reader"`
+}
+
+// ReaderOptions controls reader mode: messages in these text channels are read aloud in voice
+type ReaderOptions struct {
+	Channels  []string `json:"channels"`   // Text channel IDs to read from
+	MaxLength int      `json:"max_length"` // Longer messages are cut short (default 300 characters)
+	QueueSize int      `json:"queue_size"` // Messages waiting to be read per guild; more are skipped (default 5)
+	Muted     []string `json:"muted"`      // User IDs never read aloud
+}
+
+// TranscriptFilterOptions controls which transcripts are dropped as likely noise. Zero values use the built-in defaults.
+type TranscriptFilterOptions struct {
+	Disabled       bool     `json:"disabled"`
+	MinProbability float64  `json:"min_probability"` // Default 0.4; negative disables
+	Languages      []string `json:"languages"`       // e.g. ["en"]; empty keeps every language
+	DenyPhrases    []string `json:"deny_phrases"`    // Replaces the built-in list of hallucinated phrases
+	MinMsPerWord   int      `json:"min_ms_per_word"` // Default 100; negative disables
+}
+
+// ListeningOptions controls which speech is transcribed and reported as events
+type ListeningOptions struct {
+	Mode              string   `json:"mode"`                 // always (default), wake_word or push_to_talk
+	WakeWords         []string `json:"wake_words"`           // Default ["dexter"]
+	AttentiveSeconds  int      `json:"attentive_seconds"`    // How long Dexter keeps listening after a wake word (default 20)
+	PushToTalkSeconds int      `json:"push_to_talk_seconds"` // How long /listen turns listening on in push_to_talk (default 30)
+}
+
+// CaptureOptions controls the format utterances are saved in for transcription
+type CaptureOptions struct {
+	SampleRate        int    `json:"sample_rate"`         // Default 16000
+	Channels          int    `json:"channels"`            // Default 1
+	Format            string `json:"format"`              // wav (default), flac or opus
+	MaxSegmentSeconds int    `json:"max_segment_seconds"` // Default 30; negative disables splitting
+}
+
+// VoicePresenceOptions controls when Dexter joins, moves between and leaves voice channels on its own
+type VoicePresenceOptions struct {
+	FollowUser             string   `json:"follow_user"`               // User ID to follow between voice channels; "master" follows master_user
+	AutoJoinChannels       []string `json:"auto_join_channels"`        // Voice channel IDs Dexter may join unprompted
+	AutoJoinMinHumans      int      `json:"auto_join_min_humans"`      // People needed in an allowlisted channel before joining (default 2)
+	LeaveAfterAloneSeconds int      `json:"leave_after_alone_seconds"` // Leave after this long alone in a channel; 0 stays
+}
+
+// SessionRecordingOptions controls where multi-track session recordings are kept and for how long
+type SessionRecordingOptions struct {
+	Dir           string `json:"dir"`            // Defaults to ~/.local/data/discord/recordings
+	RetentionDays int    `json:"retention_days"` // Recordings older than this are deleted (default 30, negative keeps forever)
+}
+
+// MediaStoreOptions controls the shared directory of transient audio (utterances awaiting STT, TTS output)
+type MediaStoreOptions struct {
+	Dir           string `json:"dir"`             // Defaults to /tmp/dexter/audio; the STT and TTS services must see the same path
+	MaxMB         int    `json:"max_mb"`          // Oldest files are deleted above this size (default 512, negative disables)
+	MaxAgeMinutes int    `json:"max_age_minutes"` // Files older than this are deleted (default 60, negative disables)
 }
 
 // RoleConfig holds role ID mapping
@@ -30,3 +97,33 @@ type RoleConfig struct {
 	Contributor string `json:"contributor"`
 	User        string `json:"user"`
 }
+
+// VADOptions holds voice activity detection settings. Zero values use the built-in defaults.
+type VADOptions struct {
+	VADSettings
+	Guilds map[string]VADSettings `json:"guilds"` // Per-guild overrides, keyed by guild ID
+}
+
+// VADSettings holds one set of voice activity detection thresholds
+type VADSettings struct {
+	EnergyThresholdDB   float64 `json:"energy_threshold_db"`
+	SNRThresholdDB      float64 `json:"snr_threshold_db"`
+	MinSpeechBandRatio  float64 `json:"min_speech_band_ratio"`
+	MaxSpectralFlatness float64 `json:"max_spectral_flatness"`
+	MinSpeechMs         int     `json:"min_speech_ms"`
+	HangoverMs          int     `json:"hangover_ms"`
+	PreRollMs           int     `json:"pre_roll_ms"`
+	SilenceTimeoutMs    int     `json:"silence_timeout_ms"`
+	BargeInThreshold    float64 `json:"barge_in_threshold"`
+}
+
+// EchoOptions tunes the acoustic echo canceller. Zero values use the built-in defaults.
+type EchoOptions struct {
+	Disabled      bool    `json:"disabled"`
+	FilterMs      int     `json:"filter_ms"`
+	DelayMs       int     `json:"delay_ms"`
+	StepSize      float64 `json:"step_size"`
+	DoubleTalkMul float64 `json:"double_talk"`
+	MinRefLevelDB float64 `json:"min_ref_level"`
+	Regularizer   float64 `json:"regularization"`
+}
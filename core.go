@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +13,6 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -34,9 +34,11 @@ var defaultVoiceChannelID string
 var serverID string
 var redisClient *redis.Client
 var roleConfig config.RoleConfig
-var voiceRecorder *audio.VoiceRecorder
-var activeVoiceConnection *discordgo.VoiceConnection
-var voiceConnectionMutex sync.Mutex
+var streamingSTT bool
+var announceRecording bool
+var lastPartials sync.Map     // userID -> last partial transcript sent
+var voiceCtx context.Context  // Lifetime of per-guild voice recorders
+var voiceJoinMutex sync.Mutex // Serialises joins and moves across guilds
 
 var buildChannelID string
 var debugChannelID string
@@ -47,6 +49,7 @@ func RunCoreLogic(ctx context.Context, token, serviceURL, ttsURL, sttURL, defaul
 	ttsServiceURL = ttsURL
 	sttServiceURL = sttURL
 	endpoints.SetEventServiceURL(serviceURL)
+	endpoints.SetTTSServiceURL(ttsURL)
 	utils.SetEventServiceURL(serviceURL)
 	defaultVoiceChannelID = defaultChannel
 	serverID = guildID
@@ -55,58 +58,24 @@ func RunCoreLogic(ctx context.Context, token, serviceURL, ttsURL, sttURL, defaul
 	debugChannelID = dChannelID
 	redisClient = rc
 
+	voiceCtx = ctx
+	audio.ConfigureConsent(endpoints.LookupVoiceConsent)
+	if streamingSTT {
+		log.Printf("Streaming STT enabled: %s", audio.STTStreamURL(sttURL))
+	}
+
 	var dg *discordgo.Session // Declare dg early so callbacks capture it
 	var err error
-	voiceRecorder, err = audio.NewVoiceRecorder(ctx,
-		// OnStart callback
-		func(userID, channelID string) {
-			// Barge-In: Stop Dexter speaking if a user starts talking
-			// We assume self-echo is handled by OpusRecv filtering or SSRC logic, but we double check ID.
-			if dg != nil && dg.State != nil && dg.State.User != nil && userID == dg.State.User.ID {
-				return
-			}
 
-			log.Printf("VAD: User %s started speaking. Triggering Barge-In Interrupt.", userID)
-			if mixer := audio.GetGlobalMixer(); mixer != nil {
-				mixer.InterruptVoice()
-			}
+	audio.ConfigureMixLevels(rc)
+	audio.ConfigureMusic(rc,
+		func(guildID string, track audio.Track) {
+			sendMusicEvent(dg, utils.EventTypeMessagingBotMusicStarted, guildID, track, "")
 		},
-		// OnStop callback
-		func(userID, channelID, redisKey, filePath string) {
-			// user, _ := dg.User(userID)
-			// channel, _ := dg.Channel(channelID)
-
-			log.Printf("VAD: User %s stopped speaking.", userID)
-
-			/*
-				event := utils.UserSpeakingEvent{
-					GenericMessagingEvent: utils.GenericMessagingEvent{
-						Source:      "discord",
-						UserID:      userID,
-						UserName:    user.Username,
-						ChannelID:   channelID,
-						ChannelName: channel.Name,
-						ServerID:    guildID,
-						Timestamp:   time.Now(),
-						Type:        utils.EventTypeMessagingUserSpeakingStopped,
-					},
-				}
-				if err := sendEventData(event); err != nil {
-					log.Printf("Error sending speaking stopped event: %v", err)
-				}
-			*/
-
-			if redisKey != "" || filePath != "" {
-				go transcribeAudio(dg, userID, channelID, redisKey, filePath)
-			}
+		func(guildID string, track audio.Track, reason string) {
+			sendMusicEvent(dg, utils.EventTypeMessagingBotMusicEnded, guildID, track, reason)
 		},
 	)
-	if err != nil {
-		log.Printf("FATAL: Error creating voice recorder: %v", err)
-		utils.SetHealthStatus("ERROR", "Failed to create voice recorder")
-		return err
-	}
-	audio.SetGlobalRecorder(voiceRecorder)
 
 	dg, err = discordgo.New("Bot " + token)
 	if err != nil {
@@ -114,24 +83,38 @@ func RunCoreLogic(ctx context.Context, token, serviceURL, ttsURL, sttURL, defaul
 		return err
 	}
 	defer func() {
-		// Explicitly disconnect from voice before closing the session
-		voiceConnectionMutex.Lock()
-		if activeVoiceConnection != nil {
-			log.Println("Graceful Shutdown: Disconnecting from voice channel...")
-			if err := activeVoiceConnection.Disconnect(); err != nil {
-				log.Printf("Error disconnecting voice: %v", err)
-			} else {
-				// Wait briefly for the disconnect packet to be sent
-				time.Sleep(500 * time.Millisecond)
+		// Explicitly disconnect from voice in every guild before closing the session
+		disconnected := false
+		for _, session := range audio.Sessions() {
+			if conn := session.Connection(); conn != nil {
+				log.Printf("Graceful Shutdown: Disconnecting from voice channel in guild %s...", session.GuildID)
+				if err := conn.Disconnect(); err != nil {
+					log.Printf("Error disconnecting voice: %v", err)
+				} else {
+					disconnected = true
+				}
 			}
+			audio.RemoveSession(session.GuildID)
+		}
+		if disconnected {
+			// Wait briefly for the disconnect packets to be sent
+			time.Sleep(500 * time.Millisecond)
 		}
-		voiceConnectionMutex.Unlock()
 
 		if err := dg.Close(); err != nil {
 			log.Printf("Error closing Discord session: %v", err)
 		}
 	}()
 
+	endpoints.SetVoiceControls(
+		func(guildID, channelID string) (*discordgo.VoiceConnection, error) {
+			return joinOrMoveToVoiceChannel(dg, guildID, channelID, utils.VoiceMoveAPI, "Requested over the API")
+		},
+		func(guildID string) error {
+			return leaveVoiceChannel(dg, guildID, utils.VoiceMoveAPI, "Requested over the API")
+		},
+	)
+
 	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildVoiceStates | discordgo.IntentsGuildMembers | discordgo.IntentsDirectMessages | discordgo.IntentsGuildPresences
 	dg.ShouldReconnectOnError = true
 
@@ -208,11 +191,10 @@ func RunCoreLogic(ctx context.Context, token, serviceURL, ttsURL, sttURL, defaul
 		// Join default channel if configured
 		if defaultVoiceChannelID != "" && serverID != "" {
 			log.Printf("Joining default voice channel...")
-			vc, err := joinOrMoveToVoiceChannel(dg, serverID, defaultVoiceChannelID)
+			vc, err := joinOrMoveToVoiceChannel(dg, serverID, defaultVoiceChannelID, utils.VoiceMoveDefault, "Joined the default voice channel on startup")
 			if err != nil {
 				log.Printf("Error joining default voice channel: %v", err)
 			} else {
-				endpoints.SetActiveVoiceConnection(vc)
 				// Only play greeting if humans are present
 				if hasHumansInChannel(dg, vc.GuildID, vc.ChannelID) {
 					go playGreeting(dg, vc)
@@ -225,6 +207,10 @@ func RunCoreLogic(ctx context.Context, token, serviceURL, ttsURL, sttURL, defaul
 		// Start Voice Watchdog
 		go voiceWatchdog(dg)
 
+		// Prune expired session recordings and transient audio
+		go sessionRecordingJanitor(ctx)
+		go mediaJanitor(ctx)
+
 		// Start Voice Lock Manager (Priority & Locking)
 		go voiceLockManager(dg)
 
@@ -264,50 +250,36 @@ func voiceLockManager(s *discordgo.Session) {
 
 var lastVoiceModeActive bool
 
-// evaluateVoiceState checks if Dexter is alone in a voice channel and updates the cognitive lock and active process state accordingly.
+// evaluateVoiceState checks whether Dexter has company in any voice channel and updates the cognitive lock and active process state accordingly.
+// Each guild's connection is deafened while Dexter is alone there; the STT/TTS services sleep only when every guild is empty.
 func evaluateVoiceState(s *discordgo.Session) {
 	lockKey := "system:cognitive_lock"
 	voiceModeID := "voice-mode"
 
-	voiceConnectionMutex.Lock()
-	vc := activeVoiceConnection
-	voiceConnectionMutex.Unlock()
-
-	// 1. Not in voice? Release lock if we hold it.
-	if vc == nil || vc.ChannelID == "" {
-		val, _ := redisClient.Get(context.Background(), lockKey).Result()
-		if val == voiceModeID {
-			redisClient.Del(context.Background(), lockKey)
-			utils.ClearProcess(context.Background(), redisClient, "voice-mode")
-			log.Printf("Voice Lock released (Not in voice)")
-		}
-
-		if lastVoiceModeActive {
-			hibernateSTTTTS(s, "", "") // No specific channel needed for global hibernation
-			lastVoiceModeActive = false
-		}
-		return
-	}
-
-	// 2. In voice? Count humans.
-	guild, err := s.State.Guild(vc.GuildID)
-	if err != nil {
-		return
-	}
-
 	humanCount := 0
-	for _, vs := range guild.VoiceStates {
-		if vs.ChannelID == vc.ChannelID {
-			if vs.UserID == s.State.User.ID {
-				continue
+	for _, session := range audio.Sessions() {
+		guildID, channelID := session.GuildID, session.ChannelID()
+		if channelID == "" {
+			continue
+		}
+		humans := countHumansInChannel(s, guildID, channelID)
+		humanCount += humans
+
+		// Per-guild Discord state: listening and speaking only while someone is there
+		if active := humans > 0; active != session.VoiceModeActive() {
+			session.SetVoiceModeActive(active)
+			if active {
+				log.Printf("Voice Mode [%s]: Setting Discord state to Undeafened/Unmuted", guildID)
+				_, _ = s.ChannelVoiceJoin(guildID, channelID, false, false)
+			} else {
+				log.Printf("Voice Mode [%s]: Setting Discord state to Deafened/Muted", guildID)
+				_, _ = s.ChannelVoiceJoin(guildID, channelID, true, true)
 			}
-			humanCount++
 		}
 	}
 
 	currentVoiceModeActive := humanCount > 0
 
-	// 3. Update State
 	if currentVoiceModeActive {
 		// Humans present: Acquire or refresh
 		holder, _ := redisClient.Get(context.Background(), lockKey).Result()
@@ -322,26 +294,48 @@ func evaluateVoiceState(s *discordgo.Session) {
 		}
 
 		if !lastVoiceModeActive {
-			wakeupSTTTTS(s, vc.GuildID, vc.ChannelID)
+			wakeupSTTTTS()
 			lastVoiceModeActive = true
 		}
 	} else {
-		// Alone in channel: Release if we hold it
+		// Alone everywhere (or not in voice): Release if we hold it
 		holder, _ := redisClient.Get(context.Background(), lockKey).Result()
 		if holder == voiceModeID {
 			redisClient.Del(context.Background(), lockKey)
 			utils.ClearProcess(context.Background(), redisClient, "voice-mode")
-			log.Printf("Voice Lock released (Alone in channel)")
+			log.Printf("Voice Lock released (No humans in voice)")
 		}
 
 		if lastVoiceModeActive {
-			hibernateSTTTTS(s, vc.GuildID, vc.ChannelID)
+			hibernateSTTTTS()
 			lastVoiceModeActive = false
 		}
 	}
 }
 
-func wakeupSTTTTS(s *discordgo.Session, guildID, channelID string) {
+// countHumansInChannel returns the number of human users other than Dexter in a voice channel.
+func countHumansInChannel(s *discordgo.Session, guildID, channelID string) int {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID == channelID && vs.UserID != s.State.User.ID && !isBotUser(s, guildID, vs.UserID) {
+			count++
+		}
+	}
+	return count
+}
+
+// isBotUser reports whether a guild member is a bot account (other music bots and the like).
+func isBotUser(s *discordgo.Session, guildID, userID string) bool {
+	member, err := s.State.Member(guildID, userID)
+	return err == nil && member.User != nil && member.User.Bot
+}
+
+func wakeupSTTTTS() {
 	if sttServiceURL != "" {
 		log.Printf("Voice Mode: Waking up STT service at %s...", sttServiceURL)
 		go func() { _, _ = http.Post(sttServiceURL+"/wakeup", "application/json", nil) }()
@@ -350,14 +344,9 @@ func wakeupSTTTTS(s *discordgo.Session, guildID, channelID string) {
 		log.Printf("Voice Mode: Waking up TTS service at %s...", ttsServiceURL)
 		go func() { _, _ = http.Post(ttsServiceURL+"/wakeup", "application/json", nil) }()
 	}
-	// Synchronize Discord state: Active voice mode means we are listening and speaking
-	if s != nil && guildID != "" && channelID != "" {
-		log.Printf("Voice Mode: Setting Discord state to Undeafened/Unmuted")
-		_, _ = s.ChannelVoiceJoin(guildID, channelID, false, false)
-	}
 }
 
-func hibernateSTTTTS(s *discordgo.Session, guildID, channelID string) {
+func hibernateSTTTTS() {
 	if sttServiceURL != "" {
 		log.Printf("Voice Mode: Hibernating STT service at %s...", sttServiceURL)
 		go func() { _, _ = http.Post(sttServiceURL+"/hibernate", "application/json", nil) }()
@@ -366,11 +355,6 @@ func hibernateSTTTTS(s *discordgo.Session, guildID, channelID string) {
 		log.Printf("Voice Mode: Hibernating TTS service at %s...", ttsServiceURL)
 		go func() { _, _ = http.Post(ttsServiceURL+"/hibernate", "application/json", nil) }()
 	}
-	// Synchronize Discord state: Hibernating means we are neither listening nor speaking
-	if s != nil && guildID != "" && channelID != "" {
-		log.Printf("Voice Mode: Setting Discord state to Deafened/Muted")
-		_, _ = s.ChannelVoiceJoin(guildID, channelID, true, true)
-	}
 }
 
 // resolveRoleIDs attempts to fix invalid role IDs by matching names
@@ -475,49 +459,83 @@ func voiceWatchdog(s *discordgo.Session) {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		voiceConnectionMutex.Lock()
-		vc := activeVoiceConnection
-		voiceConnectionMutex.Unlock()
+		for _, session := range audio.Sessions() {
+			if session.BeginReset() {
+				go resetVoiceSession(s, session)
+			}
+		}
+	}
+}
 
-		if vc != nil {
-			if !vc.Ready {
-				log.Printf("Voice Watchdog: Connection detected as not ready. Initiating Hard Reset...")
+// resetVoiceSession hard resets a guild's voice connection that is no longer ready.
+func resetVoiceSession(s *discordgo.Session, session *audio.VoiceSession) {
+	defer session.EndReset()
+
+	conn := session.Connection()
+	if conn == nil {
+		return
+	}
+	guildID := session.GuildID
+	channelID := conn.ChannelID()
+	log.Printf("Voice Watchdog [%s]: Connection detected as not ready. Initiating Hard Reset...", guildID)
 
-				guildID := vc.GuildID
-				channelID := vc.ChannelID
+	// 1. Explicitly Disconnect to clear session state on Discord's end
+	log.Printf("Voice Watchdog [%s]: Disconnecting from %s...", guildID, channelID)
+	_ = conn.Disconnect()
 
-				if guildID != "" && channelID != "" {
-					// 1. Explicitly Disconnect to clear session state on Discord's end
-					log.Printf("Voice Watchdog: Disconnecting from %s...", channelID)
-					_ = vc.Disconnect()
+	// Wait for state to clear
+	time.Sleep(1 * time.Second)
 
-					// Wait for state to clear
-					time.Sleep(1 * time.Second)
+	// 2. Re-join
+	log.Printf("Voice Watchdog [%s]: Re-joining %s...", guildID, channelID)
+	newVC, err := s.ChannelVoiceJoin(guildID, channelID, false, false)
+	if err != nil {
+		log.Printf("Voice Watchdog [%s]: Re-join failed: %v", guildID, err)
+		return
+	}
+	log.Printf("Voice Watchdog [%s]: Re-join successful.", guildID)
 
-					// 2. Re-join
-					log.Printf("Voice Watchdog: Re-joining %s...", channelID)
-					newVC, err := s.ChannelVoiceJoin(guildID, channelID, false, false)
-					if err != nil {
-						log.Printf("Voice Watchdog: Re-join failed: %v", err)
-					} else {
-						log.Printf("Voice Watchdog: Re-join successful.")
+	// 3. Re-attach listeners for VAD and restart the mixer on the new connection.
+	// SSRCs belong to the old connection; speakers are mapped again as they talk.
+	session.Recorder().StopAllRecordings()
+	session.Recorder().ClearSSRCs()
+	session.Recorder().SetCurrentChannel(channelID)
+	setupVoiceReceivers(s, newVC)
+	if err := session.SetConnection(audio.WrapVoiceConnection(newVC)); err != nil {
+		log.Printf("Voice Watchdog [%s]: Failed to create audio mixer: %v", guildID, err)
+	}
+}
 
-						// 3. Update Global State
-						voiceConnectionMutex.Lock()
-						activeVoiceConnection = newVC
-						voiceConnectionMutex.Unlock()
+// mediaJanitor enforces the media store quotas every minute and publishes its usage as metrics.
+func mediaJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-						endpoints.SetActiveVoiceConnection(newVC)
+	for {
+		usage := audio.PruneMedia()
+		utils.SetMediaUsage(usage.Files, usage.Bytes, usage.Referenced, usage.Pruned)
+		if usage.Pruned > 0 {
+			log.Printf("Media: pruned %d file(s); %d file(s), %d bytes in use", usage.Pruned, usage.Files, usage.Bytes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-						// Re-attach listeners for VAD
-						setupVoiceReceivers(s, newVC)
+// sessionRecordingJanitor deletes session recordings past their retention period, hourly.
+func sessionRecordingJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
 
-						if voiceRecorder != nil {
-							voiceRecorder.SetCurrentChannel(channelID)
-						}
-					}
-				}
-			}
+	for {
+		audio.PruneSessionRecordings()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 	}
 }
@@ -526,52 +544,13 @@ func playGreeting(s *discordgo.Session, vc *discordgo.VoiceConnection) {
 	// Simple TTS greeting
 	text := "Dexter online. Systems functional."
 
-	// Create temp file path
-	tmpDir := "/tmp/dexter/audio"
-	_ = os.MkdirAll(tmpDir, 0777)
-	filename := fmt.Sprintf("greeting-%d.wav", time.Now().UnixNano())
-	filePath := filepath.Join(tmpDir, filename)
-
-	ttsURL := ttsServiceURL + "/generate"
-	reqBody := map[string]string{
-		"text":        text,
-		"output_path": filePath,
-	}
-	jsonBody, _ := json.Marshal(reqBody)
-
-	resp, err := http.Post(ttsURL, "application/json", bytes.NewBuffer(jsonBody))
+	filePath, audioData, err := endpoints.SynthesizeSpeech(text)
 	if err != nil {
 		log.Printf("Failed to generate greeting TTS: %v", err)
 		return
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("TTS service returned error: %d", resp.StatusCode)
-		return
-	}
-
-	// Check if we got a file path back
-	var respData map[string]string
-	useFile := false
-
-	// Peek at body to see if it is JSON
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	if json.Unmarshal(bodyBytes, &respData) == nil && respData["file_path"] != "" {
-		useFile = true
-	}
-
-	var fakeReq *http.Request
-	if useFile {
-		fakeReq, _ = http.NewRequest("POST", "/audio/play", nil)
-		fakeReq.Header.Set("X-File-Path", filePath)
-	} else {
-		// Fallback: Use bytes (re-wrap bodyBytes)
-		fakeReq, _ = http.NewRequest("POST", "/audio/play", bytes.NewBuffer(bodyBytes))
-	}
-
-	fakeW := &fakeResponseWriter{}
-	endpoints.PlayAudioHandler(fakeW, fakeReq)
+	endpoints.EnqueuePlayback(vc.GuildID, "greeting", "", text, filePath, audioData).Wait()
 
 	// Emit event
 	event := utils.GenericMessagingEvent{
@@ -603,12 +582,47 @@ func playGreeting(s *discordgo.Session, vc *discordgo.VoiceConnection) {
 	_ = utils.AppendToChannelContext(vc.ChannelID, voiceEvent)
 }
 
-// fakeResponseWriter to satisfy http.ResponseWriter interface
-type fakeResponseWriter struct{}
+// sendMusicEvent emits a music track lifecycle event for the given guild.
+func sendMusicEvent(s *discordgo.Session, eventType utils.EventType, guildID string, track audio.Track, reason string) {
+	if s == nil || s.State == nil || s.State.User == nil {
+		return
+	}
 
-func (f *fakeResponseWriter) Header() http.Header         { return http.Header{} }
-func (f *fakeResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
-func (f *fakeResponseWriter) WriteHeader(statusCode int)  {}
+	channelID := ""
+	if session := audio.GetSession(guildID); session != nil {
+		channelID = session.ChannelID()
+	}
+
+	channelName := ""
+	if channelID != "" {
+		if channel, err := s.State.Channel(channelID); err == nil {
+			channelName = channel.Name
+		}
+	}
+
+	event := utils.BotMusicEvent{
+		GenericMessagingEvent: utils.GenericMessagingEvent{
+			Type:        eventType,
+			Source:      "discord",
+			UserID:      s.State.User.ID,
+			UserName:    s.State.User.Username,
+			UserLevel:   string(utils.LevelMe),
+			ChannelID:   channelID,
+			ChannelName: channelName,
+			ServerID:    guildID,
+			Timestamp:   time.Now(),
+		},
+		TrackID:     track.ID,
+		URL:         track.URL,
+		Title:       track.Title,
+		Duration:    track.Duration,
+		RequestedBy: track.RequestedBy,
+		Reason:      reason,
+	}
+	if err := sendEventData(event); err != nil {
+		log.Printf("Error sending music event: %v", err)
+	}
+}
 
 func ready(s *discordgo.Session, event *discordgo.Ready) {
 	log.Printf("Logged in as %s#%s", s.State.User.Username, s.State.User.Discriminator)
@@ -624,99 +638,217 @@ func ready(s *discordgo.Session, event *discordgo.Ready) {
 	}()
 }
 
-func joinOrMoveToVoiceChannel(s *discordgo.Session, guildID, channelID string) (*discordgo.VoiceConnection, error) {
-	voiceConnectionMutex.Lock()
-	defer voiceConnectionMutex.Unlock()
+// getOrCreateVoiceSession returns the guild's voice session, creating it and its recorder on first use.
+func getOrCreateVoiceSession(s *discordgo.Session, guildID string) (*audio.VoiceSession, error) {
+	return audio.GetOrCreateSession(guildID, func() (*audio.VoiceRecorder, error) {
+		recorder := audio.NewVoiceRecorder(voiceCtx, guildID, redisClient,
+			// OnStart callback
+			func(userID, channelID string) {
+				// Barge-In: Stop Dexter speaking if a user starts talking
+				// We assume self-echo is handled by OpusRecv filtering or SSRC logic, but we double check ID.
+				if s.State != nil && s.State.User != nil && userID == s.State.User.ID {
+					return
+				}
+
+				// Only interrupt for speech Dexter is listening to; in wake_word and push_to_talk
+				// modes chatter outside the listening window must not cut a reply short.
+				if audio.GetListeningMode() != audio.ListenAlways && !audio.Attentive(guildID) {
+					return
+				}
+
+				log.Printf("VAD: User %s started speaking. Triggering Barge-In Interrupt.", userID)
+				if mixer := audio.GetMixer(guildID); mixer != nil {
+					mixer.InterruptVoice()
+				}
+			},
+			// OnStop callback
+			func(userID, channelID, redisKey, filePath string, segment audio.Segment) {
+				if segment.Final {
+					log.Printf("VAD: User %s stopped speaking.", userID)
+				}
+
+				if redisKey == "" && filePath == "" {
+					return
+				}
+				if !audio.ShouldTranscribe(guildID, segment.UtteranceID) {
+					// Push-to-talk is off; the audio is never sent to STT
+					utils.IncrementTranscriptionsSkipped()
+					audio.RemoveMedia(filePath)
+					audio.ReleaseMedia(filePath)
+					return
+				}
+				go transcribeAudio(s, userID, channelID, redisKey, filePath, segment)
+			},
+		)
+
+		recorder.SetSpeakingHandler(func(update audio.SpeakingUpdate) {
+			go sendSpeakingEvent(s, guildID, update)
+		})
+
+		if streamingSTT {
+			recorder.EnableStreamingSTT(audio.STTStreamURL(sttServiceURL),
+				func(userID, channelID string, result audio.STTResult) {
+					sendPartialTranscript(s, userID, channelID, result)
+				},
+				func(userID, channelID string, segment audio.Segment, result audio.STTResult) {
+					lastPartials.Delete(userID)
+					emitTranscription(s, userID, channelID, result, segment)
+				},
+			)
+		}
+		return recorder, nil
+	})
+}
+
+// joinOrMoveToVoiceChannel connects to a voice channel, moving within the guild if already in voice there.
+// reason and details explain the move in the emitted event.
+func joinOrMoveToVoiceChannel(s *discordgo.Session, guildID, channelID, reason, details string) (*discordgo.VoiceConnection, error) {
+	voiceJoinMutex.Lock()
+	defer voiceJoinMutex.Unlock()
+
+	session, err := getOrCreateVoiceSession(s, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create voice session: %w", err)
+	}
+	current := audio.DiscordVoiceConnection(session.Connection())
+	currentChannelID := session.ChannelID()
 
 	// If we are already in the target channel with an active connection, do nothing.
-	if activeVoiceConnection != nil && activeVoiceConnection.ChannelID == channelID {
+	if current != nil && currentChannelID == channelID {
 		log.Printf("Already in voice channel %s, reusing connection.", channelID)
-		return activeVoiceConnection, nil
+		return current, nil
 	}
 
-	// If we are moving channels, stop recordings first.
-	if activeVoiceConnection != nil {
-		log.Printf("Moving voice connection from %s to %s", activeVoiceConnection.ChannelID, channelID)
-		voiceRecorder.StopAllRecordings()
+	// If we are moving channels, stop recordings and forget the old channel's speakers first.
+	if current != nil {
+		log.Printf("Moving voice connection in guild %s from %s to %s", guildID, currentChannelID, channelID)
+		if session.SessionRecording() != nil {
+			_, _ = endpoints.StopSessionRecording(guildID, "moved")
+		}
+		session.Recorder().StopAllRecordings()
+		session.Recorder().ClearChannelSSRC(currentChannelID)
 	}
 
 	// Join the new channel. This will return a new or existing connection object.
 	// Set selfMute to false so the bot can speak.
 	vc, err := s.ChannelVoiceJoin(guildID, channelID, false, false)
 	if err != nil {
+		if current == nil {
+			audio.RemoveSession(guildID)
+		}
 		return nil, fmt.Errorf("failed to join voice channel: %w", err)
 	}
 
 	// If the returned connection is a brand new object, we must set up its handlers.
 	// This covers the initial join and any reconnection scenarios where a new connection is made.
-	if vc != activeVoiceConnection {
+	if vc != current {
 		log.Println("New voice connection object detected. Setting up voice receivers...")
+		// SSRCs from any earlier connection could now belong to someone else
+		session.Recorder().ClearSSRCs()
 		setupVoiceReceivers(s, vc)
 	}
 
-	// Update the global active connection and the recorder's current channel.
-	activeVoiceConnection = vc
-	voiceRecorder.SetCurrentChannel(channelID)
+	// Update the recorder's current channel.
+	session.Recorder().SetCurrentChannel(channelID)
 
 	// Wait for connection to stabilize before enabling mixer
 	time.Sleep(1 * time.Second)
-	endpoints.SetActiveVoiceConnection(vc) // Register with endpoints for playback
+	if err := session.SetConnection(audio.WrapVoiceConnection(vc)); err != nil {
+		log.Printf("Failed to create audio mixer: %v", err)
+	}
 
 	// Emit event after the mixer is ready
 	log.Printf("Bot joined voice channel: %s", vc.ChannelID)
-	channel, _ := s.Channel(vc.ChannelID)
+	sendBotVoiceEvent(s, utils.EventTypeMessagingBotJoinedVoice, vc.GuildID, vc.ChannelID, reason, details)
+
+	// Start the leave-when-alone timer if nobody is here
+	go checkAlone(s, guildID)
+
+	return vc, nil
+}
+
+// leaveVoiceChannel disconnects from a guild's voice channel and tears down its session.
+// Music in that guild is paused so its queue survives until Dexter is back.
+func leaveVoiceChannel(s *discordgo.Session, guildID, reason, details string) error {
+	voiceJoinMutex.Lock()
+	defer voiceJoinMutex.Unlock()
+
+	session := audio.GetSession(guildID)
+	if session == nil || session.Connection() == nil {
+		return fmt.Errorf("not in a voice channel in guild %s", guildID)
+	}
+	conn := session.Connection()
+	channelID := conn.ChannelID()
+
+	log.Printf("Leaving voice channel %s in guild %s", channelID, guildID)
+	cancelAloneTimer(guildID)
+	if session.SessionRecording() != nil {
+		_, _ = endpoints.StopSessionRecording(guildID, "left_voice")
+	}
+	if player := audio.LookupMusicPlayer(guildID); player != nil {
+		player.Pause()
+	}
+	session.Recorder().StopAllRecordings()
+	session.Recorder().ClearChannelSSRC(channelID)
+	audio.RemoveSession(guildID)
+
+	if err := conn.Disconnect(); err != nil {
+		log.Printf("Error disconnecting voice: %v", err)
+	}
+
+	sendBotVoiceEvent(s, utils.EventTypeMessagingBotLeftVoice, guildID, channelID, reason, details)
+	evaluateVoiceState(s)
+	return nil
+}
+
+// sendBotVoiceEvent emits a bot joined/left voice event for a channel, with the reason for the move.
+func sendBotVoiceEvent(s *discordgo.Session, eventType utils.EventType, guildID, channelID, reason, details string) {
+	channel, _ := s.Channel(channelID)
 	channelName := "unknown"
 	if channel != nil {
 		channelName = channel.Name
 	}
-	event := utils.UserVoiceStateChangeEvent{
+	event := utils.BotVoiceEvent{
 		GenericMessagingEvent: utils.GenericMessagingEvent{
-			Type:        utils.EventType("messaging.bot.joined_voice"),
+			Type:        eventType,
 			Source:      "discord",
 			UserID:      s.State.User.ID,
 			UserName:    s.State.User.Username,
-			UserLevel:   string(utils.GetUserLevel(s, redisClient, vc.GuildID, s.State.User.ID, roleConfig)),
-			ChannelID:   vc.ChannelID,
+			UserLevel:   string(utils.GetUserLevel(s, redisClient, guildID, s.State.User.ID, roleConfig)),
+			ChannelID:   channelID,
 			ChannelName: channelName,
-			ServerID:    vc.GuildID,
+			ServerID:    guildID,
 			Timestamp:   time.Now(),
 		},
+		Reason:  reason,
+		Details: details,
 	}
 	if err := sendEventData(event); err != nil {
-		log.Printf("Error sending bot voice join event: %v", err)
+		log.Printf("Error sending bot voice event: %v", err)
 	}
-
-	return vc, nil
 }
 
 func setupVoiceReceivers(s *discordgo.Session, vc *discordgo.VoiceConnection) {
+	recorder := audio.GetRecorder(vc.GuildID)
+	if recorder == nil {
+		log.Printf("No voice recorder for guild %s; not receiving audio", vc.GuildID)
+		return
+	}
+
 	vc.AddHandler(func(vc *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
 		// ECHO CANCELLATION: Do not register our own SSRC.
 		// If we register it, the recorder will capture our own output, causing feedback loops.
 		if vs.UserID == s.State.User.ID {
 			return
 		}
-		voiceRecorder.RegisterSSRC(uint32(vs.SSRC), vs.UserID, vc.ChannelID)
+		recorder.RegisterSSRC(uint32(vs.SSRC), vs.UserID, vc.ChannelID)
 	})
 
-	go func() {
-		pktCount := 0
-		for p := range vc.OpusRecv {
-			if p != nil {
-				pktCount++
-				if pktCount%250 == 0 { // Log every ~5 seconds of audio (50 packets/sec)
-					log.Printf("DEBUG: Rx Voice Packet SSRC %d (Count %d)", p.SSRC, pktCount)
-				}
-				if err := voiceRecorder.ProcessVoicePacket(p.SSRC, p); err != nil {
-					log.Printf("Error processing voice packet: %v", err)
-				}
-			}
-		}
-		log.Printf("DEBUG: OpusRecv channel closed for %s", vc.ChannelID)
-	}()
+	go recorder.Receive(audio.WrapVoiceConnection(vc), vc.ChannelID)
 }
 
 func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	endpoints.NoteCaptionChannelMessage(m.ChannelID, m.ID)
 	if m.Author.ID == s.State.User.ID {
 		return
 	}
@@ -743,6 +875,11 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		serverID = m.GuildID
 	}
 
+	// Reader mode: speak messages from mic-less members in Dexter's voice channel
+	if m.GuildID != "" && endpoints.ReadMessageAloud(m.GuildID, m.Message) {
+		log.Printf("Reader [%s]: Queued message %s from %s", m.GuildID, m.ID, m.Author.Username)
+	}
+
 	// 1. EXCLUSIVE: Build Channel & Threads Handling
 	isBuildRelated := m.ChannelID == buildChannelID
 	if !isBuildRelated && channel != nil && channel.ParentID == buildChannelID {
@@ -902,11 +1039,230 @@ func handleDiscordCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 	case "restrict", "restricted":
 		_ = redisClient.Set(ctx, "darwin:yolo_mode", "false", 0).Err()
 		_, _ = s.ChannelMessageSend(m.ChannelID, "🔒 **Darwin YOLO Mode: OFF** (Restricted)")
+	case "optout", "optin":
+		optedOut := commandName == "optout"
+		if _, err := endpoints.SetVoiceConsent(ctx, m.Author.ID, optedOut, m.Author.ID); err != nil {
+			log.Printf("Error saving voice consent for %s: %v", m.Author.ID, err)
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't save that. Please try again.")
+			return
+		}
+		if optedOut {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "🔇 Got it. I won't record or transcribe your voice. Use /optin to undo.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "🎙️ Thanks! I'll listen to you in voice again. Use /optout to stop.")
+		}
+	case "join", "move", "leave":
+		handleVoiceCommand(s, m, commandName, strings.Join(parts[1:], " "))
+	case "sfx":
+		handleSoundboardCommand(s, m, strings.Join(parts[1:], " "))
+	case "listen":
+		handleListenCommand(s, m, strings.Join(parts[1:], " "))
+	case "captions":
+		handleCaptionsCommand(s, m, strings.Join(parts[1:], " "))
+	case "reader":
+		handleReaderCommand(s, m, parts[1:])
 	default:
 		// Unknown command, ignore or send help
 	}
 }
 
+// handleVoiceCommand runs /join [channel], /move <channel> and /leave for admins.
+// /join without a channel follows the caller into their current voice channel.
+func handleVoiceCommand(s *discordgo.Session, m *discordgo.MessageCreate, command, arg string) {
+	if m.GuildID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Voice commands only work in a server.")
+		return
+	}
+	level := utils.GetUserLevel(s, redisClient, m.GuildID, m.Author.ID, roleConfig)
+	if level != utils.LevelMaster && level != utils.LevelAdmin {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "⛔ Only admins can move me between voice channels.")
+		return
+	}
+
+	if command == "leave" {
+		if err := leaveVoiceChannel(s, m.GuildID, utils.VoiceMoveCommand, fmt.Sprintf("/leave from %s", m.Author.Username)); err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "I'm not in a voice channel.")
+			return
+		}
+		_, _ = s.ChannelMessageSend(m.ChannelID, "👋 Left voice.")
+		return
+	}
+
+	var channelID string
+	if arg == "" && command == "join" {
+		if vs, err := s.State.VoiceState(m.GuildID, m.Author.ID); err == nil && vs.ChannelID != "" {
+			channelID = vs.ChannelID
+		}
+	} else if channel, err := utils.ResolveVoiceChannel(s, m.GuildID, arg); err == nil {
+		channelID = channel.ID
+	} else {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Couldn't find that channel: %v", err))
+		return
+	}
+	if channelID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Usage: /%s <voice channel>", command))
+		return
+	}
+
+	if session := audio.GetSession(m.GuildID); command == "move" && (session == nil || session.Connection() == nil) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "I'm not in a voice channel. Use /join instead.")
+		return
+	}
+
+	vc, err := joinOrMoveToVoiceChannel(s, m.GuildID, channelID, utils.VoiceMoveCommand, fmt.Sprintf("/%s from %s", command, m.Author.Username))
+	if err != nil {
+		log.Printf("Voice command /%s failed: %v", command, err)
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to join that channel.")
+		return
+	}
+	_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🔊 Joined <#%s>.", vc.ChannelID))
+}
+
+// handleSoundboardCommand plays a soundboard clip in the caller's guild (/sfx <name>), or lists the clips (/sfx)
+func handleSoundboardCommand(s *discordgo.Session, m *discordgo.MessageCreate, name string) {
+	if name == "" {
+		clips, err := audio.RefreshSoundboard()
+		if err != nil {
+			log.Printf("Error listing soundboard clips: %v", err)
+		}
+		if len(clips) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The soundboard is empty.")
+			return
+		}
+		names := make([]string, len(clips))
+		for i, clip := range clips {
+			names[i] = "`" + clip.Name + "`"
+		}
+		_, _ = s.ChannelMessageSend(m.ChannelID, "🔊 Sounds: "+strings.Join(names, ", "))
+		return
+	}
+
+	if m.GuildID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sounds only play in a server.")
+		return
+	}
+	if _, err := audio.PlaySoundClip(m.GuildID, name); err != nil {
+		if errors.Is(err, audio.ErrUnknownClip) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("I don't have a sound called `%s`. Type /sfx to list them.", name))
+			return
+		}
+		_, _ = s.ChannelMessageSend(m.ChannelID, "I'm not in a voice channel here.")
+	}
+}
+
+// handleListenCommand opens the listening window in the caller's guild (/listen), closes it (/listen stop),
+// or switches the listening mode for admins (/listen always|wake_word|push_to_talk)
+func handleListenCommand(s *discordgo.Session, m *discordgo.MessageCreate, arg string) {
+	if m.GuildID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Listening only works in a server.")
+		return
+	}
+
+	switch strings.ToLower(arg) {
+	case "":
+		if audio.GetListeningMode() == audio.ListenAlways {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "👂 I'm always listening.")
+			return
+		}
+		window := audio.Listen(m.GuildID)
+		log.Printf("Listening [%s]: Opened for %s by %s", m.GuildID, window, m.Author.Username)
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("👂 Listening for %ds.", int(window.Seconds())))
+		return
+	case "stop", "off":
+		audio.StopListening(m.GuildID)
+		_, _ = s.ChannelMessageSend(m.ChannelID, "🙉 Stopped listening.")
+		return
+	}
+
+	mode, err := audio.ParseListeningMode(arg)
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: /listen [stop | always | wake_word | push_to_talk]")
+		return
+	}
+	level := utils.GetUserLevel(s, redisClient, m.GuildID, m.Author.ID, roleConfig)
+	if level != utils.LevelMaster && level != utils.LevelAdmin {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "⛔ Only admins can change how I listen.")
+		return
+	}
+	audio.SetListeningMode(mode)
+	utils.SetListeningMode(string(mode))
+	_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("👂 Listening mode: **%s**", mode))
+}
+
+// handleCaptionsCommand lets admins caption their current voice channel in the channel or thread the
+// command is typed in (/captions on), or turn captions off (/captions off)
+func handleCaptionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, arg string) {
+	if m.GuildID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Captions only work in a server.")
+		return
+	}
+	level := utils.GetUserLevel(s, redisClient, m.GuildID, m.Author.ID, roleConfig)
+	if level != utils.LevelMaster && level != utils.LevelAdmin {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "⛔ Only admins can change live captions.")
+		return
+	}
+	vs, err := s.State.VoiceState(m.GuildID, m.Author.ID)
+	if err != nil || vs.ChannelID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Join the voice channel you want captioned first.")
+		return
+	}
+
+	target := ""
+	switch strings.ToLower(arg) {
+	case "", "on", "here":
+		target = m.ChannelID
+		if target == vs.ChannelID {
+			target = endpoints.CaptionVoiceChat
+		}
+	case "off":
+	default:
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: /captions [on | off]")
+		return
+	}
+
+	if err := endpoints.SetCaptionTarget(context.Background(), vs.ChannelID, target); err != nil {
+		log.Printf("Error saving caption target for %s: %v", vs.ChannelID, err)
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't save that. Please try again.")
+		return
+	}
+	if target == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("💬 Captions for <#%s> are off.", vs.ChannelID))
+		return
+	}
+	_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("💬 Captioning <#%s> here.", vs.ChannelID))
+}
+
+// handleReaderCommand mutes or unmutes someone in reader mode (/reader mute|unmute [@user]).
+// Anyone can mute themselves; muting someone else needs a moderator.
+func handleReaderCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 || (args[0] != "mute" && args[0] != "unmute") {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: /reader mute|unmute [@user]")
+		return
+	}
+	muted := args[0] == "mute"
+
+	target := m.Author
+	if len(m.Mentions) > 0 && m.Mentions[0].ID != m.Author.ID {
+		level := utils.GetUserLevel(s, redisClient, m.GuildID, m.Author.ID, roleConfig)
+		if level != utils.LevelMaster && level != utils.LevelAdmin && level != utils.LevelModerator {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "⛔ Only moderators can mute someone else.")
+			return
+		}
+		target = m.Mentions[0]
+	}
+
+	if err := endpoints.SetReaderMuted(context.Background(), target.ID, muted); err != nil {
+		log.Printf("Error updating reader mute for %s: %v", target.ID, err)
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't save that. Please try again.")
+		return
+	}
+	if muted {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🔇 I won't read messages from %s aloud.", target.Username))
+	} else {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🔊 I'll read messages from %s aloud again.", target.Username))
+	}
+}
+
 func voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
 	// Detect if bot joined a voice channel
 	/*
@@ -974,6 +1330,41 @@ func voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
 
 		// Immediate re-evaluation of voice lock when someone joins or leaves
 		evaluateVoiceState(s)
+
+		if eventType == utils.EventTypeMessagingUserJoinedVoice {
+			go announceRecordingTo(s, v.GuildID, v.UserID, channelID)
+		}
+	}
+
+	// Forget the SSRCs of whoever left a channel, so they cannot be attributed to the wrong speaker later
+	if v.BeforeUpdate != nil && v.BeforeUpdate.ChannelID != "" && v.BeforeUpdate.ChannelID != v.ChannelID {
+		pruneVoiceSSRCs(s, v.GuildID, v.UserID, v.BeforeUpdate.ChannelID, v.ChannelID)
+	}
+
+	// Follow-me, auto-join and leave-when-alone policies
+	if v.UserID != s.State.User.ID {
+		go applyVoicePresence(s, v)
+	}
+}
+
+// pruneVoiceSSRCs updates a guild's SSRC mappings when someone leaves or moves out of a voice channel.
+// When it is Dexter that was moved (or disconnected) from outside, the recorder follows it.
+func pruneVoiceSSRCs(s *discordgo.Session, guildID, userID, fromChannelID, toChannelID string) {
+	recorder := audio.GetRecorder(guildID)
+	if recorder == nil {
+		return
+	}
+	if userID != s.State.User.ID {
+		recorder.RemoveUser(userID, fromChannelID)
+		return
+	}
+	if recorder.CurrentChannel() != fromChannelID {
+		return // Already handled by joinOrMoveToVoiceChannel
+	}
+	recorder.StopAllRecordings()
+	recorder.ClearChannelSSRC(fromChannelID)
+	if toChannelID != "" {
+		recorder.SetCurrentChannel(toChannelID)
 	}
 }
 
@@ -999,50 +1390,13 @@ func guildMemberAdd(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
 }
 
 func sendEventData(eventData interface{}) error {
-	eventJSON, err := json.Marshal(eventData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	// Log event type for observability
-	var typeFinder struct {
-		Type string `json:"type"`
-	}
-	_ = json.Unmarshal(eventJSON, &typeFinder)
-	log.Printf("Discord Service: [EVENT] Sending %s (%d bytes)...", typeFinder.Type, len(eventJSON))
-
-	request := map[string]interface{}{"service": "dex-discord-service", "event": json.RawMessage(eventJSON)}
-	body, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	for i := 0; i < 3; i++ {
-		resp, err := http.Post(eventServiceURL+"/events", "application/json", bytes.NewBuffer(body))
-		if err == nil {
-			defer func() {
-				if err := resp.Body.Close(); err != nil {
-					log.Printf("Error closing response body: %v", err)
-				}
-			}()
-			if resp.StatusCode < 300 {
-				utils.IncrementEventsSent()
-				log.Printf("Discord Service: [SUCCESS] Event %s emitted", typeFinder.Type)
-				return nil
-			}
-
-			// Read response body for error details
-			respBody, _ := io.ReadAll(resp.Body)
-			log.Printf("Discord Service: [ERROR] Failed to send event (Attempt %d/3): Status %d, Body: %s", i+1, resp.StatusCode, string(respBody))
-		} else {
-			log.Printf("Discord Service: [ERROR] Failed to send event (Attempt %d/3): %v", i+1, err)
-		}
-		time.Sleep(time.Duration(i+1) * 2 * time.Second)
-	}
-	return fmt.Errorf("failed to send event after multiple attempts")
+	return utils.SendEvent(eventData)
 }
 
-func transcribeAudio(s *discordgo.Session, userID, channelID, redisKey, filePath string) {
+func transcribeAudio(s *discordgo.Session, userID, channelID, redisKey, filePath string, segment audio.Segment) {
+	// The recorder holds the file for us until the STT service has read it
+	defer audio.ReleaseMedia(filePath)
+
 	// Call STT Service using multipart form
 	// Priority: filePath > redisKey
 	body := &bytes.Buffer{}
@@ -1069,29 +1423,41 @@ func transcribeAudio(s *discordgo.Session, userID, channelID, redisKey, filePath
 		return
 	}
 
-	// Structure to parse STT service JSON output
-	var sttOutput struct {
-		Text        string  `json:"text"`
-		Language    string  `json:"language"`
-		Probability float64 `json:"probability"`
-	}
-
+	// The STT service answers with the same text/language/probability fields as its stream
+	var sttOutput audio.STTResult
 	if err := json.NewDecoder(resp.Body).Decode(&sttOutput); err != nil {
 		log.Printf("Failed to parse STT response: %v", err)
 		return
 	}
 
-	transcription := sttOutput.Text
+	emitTranscription(s, userID, channelID, sttOutput, segment)
+}
 
+// emitTranscription sends a final transcript as a messaging.user.transcribed event and stores it in the channel context
+func emitTranscription(s *discordgo.Session, userID, channelID string, result audio.STTResult, segment audio.Segment) {
+	transcription := result.Text
 	// IGNORE empty or whitespace-only transcriptions
 	if strings.TrimSpace(transcription) == "" {
 		log.Printf("Ignoring empty transcription from user %s in channel %s.", userID, channelID)
 		return
 	}
+	// Drop what is likely noise transcribed as speech
+	if reason := audio.FilterTranscript(result, segment); reason != "" {
+		log.Printf("Dropping transcription from user %s in channel %s (%s, language %q, probability %.2f, %dms): %s",
+			userID, channelID, reason, result.Language, result.Probability, segment.DurationMs, transcription)
+		utils.IncrementTranscriptsDropped(reason)
+		return
+	}
 
 	channel, _ := s.Channel(channelID)
 	userName := utils.GetUserDisplayName(s, redisClient, channel.GuildID, userID)
 
+	if !audio.AdmitTranscript(channel.GuildID, segment, transcription) {
+		log.Printf("Listening: Ignoring transcript from %s in %s (not addressed to Dexter)", userName, channel.Name)
+		utils.IncrementTranscriptsSuppressed()
+		return
+	}
+
 	log.Printf("user %s in channel %s said: %s", userName, channel.Name, transcription)
 
 	event := utils.UserTranscribedEvent{
@@ -1108,6 +1474,11 @@ func transcribeAudio(s *discordgo.Session, userID, channelID, redisKey, filePath
 		},
 		Transcription: transcription,
 		Content:       transcription,
+		UtteranceID:   segment.UtteranceID,
+		Segment:       segment.Index,
+		FinalSegment:  segment.Final,
+		Language:      result.Language,
+		Probability:   result.Probability,
 	}
 	if err := sendEventData(event); err != nil {
 		log.Printf("Error sending transcription event: %v", err)
@@ -1115,6 +1486,83 @@ func transcribeAudio(s *discordgo.Session, userID, channelID, redisKey, filePath
 
 	// Local Context Storage
 	_ = utils.AppendToChannelContext(channelID, event)
+
+	endpoints.PostCaption(channelID, userID, userName, transcription)
+}
+
+// sendSpeakingEvent emits messaging.user.speaking.started/stopped for a throttled speaking update
+func sendSpeakingEvent(s *discordgo.Session, guildID string, update audio.SpeakingUpdate) {
+	eventType := utils.EventTypeMessagingUserSpeakingStopped
+	if update.Speaking {
+		eventType = utils.EventTypeMessagingUserSpeakingStarted
+	}
+	channelName := ""
+	if channel, err := s.State.Channel(update.ChannelID); err == nil {
+		channelName = channel.Name
+	}
+
+	event := utils.UserSpeakingEvent{
+		GenericMessagingEvent: utils.GenericMessagingEvent{
+			Type:        eventType,
+			Source:      "discord",
+			UserID:      update.UserID,
+			UserName:    utils.GetUserDisplayName(s, redisClient, guildID, update.UserID),
+			UserLevel:   string(utils.GetUserLevel(s, redisClient, guildID, update.UserID, roleConfig)),
+			ChannelID:   update.ChannelID,
+			ChannelName: channelName,
+			ServerID:    guildID,
+			Timestamp:   time.Now(),
+		},
+		SSRC:              update.SSRC,
+		DurationMs:        update.Duration.Milliseconds(),
+		TalkMs:            update.TalkTime.Milliseconds(),
+		Overlapping:       update.Overlapping,
+		InterruptedDexter: update.InterruptedDexter,
+	}
+	if err := sendEventData(event); err != nil {
+		log.Printf("Error sending speaking event: %v", err)
+	}
+}
+
+// sendPartialTranscript emits a messaging.user.transcribing event when a streamed partial transcript changes
+func sendPartialTranscript(s *discordgo.Session, userID, channelID string, result audio.STTResult) {
+	text := strings.TrimSpace(result.Text)
+	if text == "" {
+		return
+	}
+	if last, ok := lastPartials.Load(userID); ok && last.(string) == text {
+		return
+	}
+	lastPartials.Store(userID, text)
+
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+		if err != nil {
+			return
+		}
+	}
+	if !audio.AdmitPartial(channel.GuildID, text) {
+		return
+	}
+
+	event := utils.UserTranscribingEvent{
+		GenericMessagingEvent: utils.GenericMessagingEvent{
+			Type:        utils.EventTypeMessagingUserTranscribing,
+			Source:      "discord",
+			UserID:      userID,
+			UserName:    utils.GetUserDisplayName(s, redisClient, channel.GuildID, userID),
+			ChannelID:   channelID,
+			ChannelName: channel.Name,
+			ServerID:    channel.GuildID,
+			Timestamp:   time.Now(),
+		},
+		Transcription: text,
+		Language:      result.Language,
+	}
+	if err := sendEventData(event); err != nil {
+		log.Printf("Error sending partial transcription event: %v", err)
+	}
 }
 
 func guildMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
@@ -1,48 +1,21 @@
 package endpoints
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
-	"sync"
 
 	"github.com/EasterCompany/dex-discord-service/audio"
-	"github.com/bwmarrin/discordgo"
 )
 
-var (
-	vcMutex  sync.Mutex
-	activeVC *discordgo.VoiceConnection
-)
-
-// GetActiveVoiceConnection returns the current voice connection safely
-func GetActiveVoiceConnection() *discordgo.VoiceConnection {
-	vcMutex.Lock()
-	defer vcMutex.Unlock()
-	return activeVC
-}
-
-// SetActiveVoiceConnection sets the active voice connection for audio playback
-func SetActiveVoiceConnection(vc *discordgo.VoiceConnection) {
-	vcMutex.Lock()
-	activeVC = vc
-	vcMutex.Unlock()
-
-	// Initialize and start the global mixer
-	mixer, err := audio.NewAudioMixer(vc)
-	if err != nil {
-		log.Printf("Failed to create audio mixer: %v", err)
-		return
-	}
-	audio.SetGlobalMixer(mixer)
-	mixer.Start()
-	log.Println("Audio mixer started")
-}
-
 // AudioHandler handles requests for audio files from Redis (GET)
 func AudioHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -57,16 +30,14 @@ func AudioHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the global voice recorder instance
-	voiceRecorder := audio.GetGlobalRecorder()
-	if voiceRecorder == nil {
-		log.Printf("Error: global voice recorder not initialized")
+	if redisClient == nil {
+		log.Printf("Error: Redis client not initialized")
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	// Get audio data from Redis
-	audioData, err := voiceRecorder.GetRedis().Get(context.Background(), redisKey).Bytes()
+	audioData, err := redisClient.Get(context.Background(), redisKey).Bytes()
 	if err != nil {
 		log.Printf("Error getting audio from Redis: %v", err)
 		http.Error(w, "Audio not found", http.StatusNotFound)
@@ -81,144 +52,205 @@ func AudioHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// PlayMusicHandler handles requests to play music from a URL (e.g., YouTube)
-func PlayMusicHandler(w http.ResponseWriter, r *http.Request) {
+// PlayAudioHandler queues audio for playback in a guild's voice channel (POST)
+// It returns a playback ID immediately; pass ?wait=true to block until playback ends.
+func PlayAudioHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req struct {
-		URL string `json:"url"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if req.URL == "" {
-		http.Error(w, "URL is required", http.StatusBadRequest)
-		return
-	}
-
-	mixer := audio.GetGlobalMixer()
-	if mixer == nil {
+	guildID := resolveGuildID(guildIDFromRequest(r))
+	if guildID == "" || audio.GetMixer(guildID) == nil {
 		http.Error(w, "No active audio mixer", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Launch async so we don't block the HTTP response
-	go func() {
-		log.Printf("Starting playback for URL: %s", req.URL)
+	// Check if we are streaming from a file
+	filePath := r.URL.Query().Get("file_path")
+	if filePath == "" {
+		filePath = r.Header.Get("X-File-Path")
+	}
 
-		// 1. Start yt-dlp to stream audio to stdout
-		ytDlp := exec.Command("yt-dlp", "-f", "bestaudio", "-o", "-", req.URL)
-		ytOut, err := ytDlp.StdoutPipe()
-		if err != nil {
-			log.Printf("Error creating yt-dlp stdout pipe: %v", err)
+	var data []byte
+	if filePath != "" {
+		// Validate file exists
+		if _, err := os.Stat(filePath); err != nil {
+			log.Printf("PlayAudioHandler: File not found: %s", filePath)
+			http.Error(w, "File not found", http.StatusBadRequest)
 			return
 		}
-
-		if err := ytDlp.Start(); err != nil {
-			log.Printf("Error starting yt-dlp: %v", err)
+	} else {
+		// The request ends before playback does, so buffer the body now
+		var err error
+		data, err = io.ReadAll(r.Body)
+		if err != nil || len(data) == 0 {
+			http.Error(w, "Missing audio data", http.StatusBadRequest)
 			return
 		}
-		defer func() { _ = ytDlp.Wait() }()
+	}
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		tag = r.Header.Get("X-Playback-Tag")
+	}
 
-		// 2. Start ffmpeg to convert stdin (from yt-dlp) to PCM s16le 48kHz stereo
-		ffmpeg := exec.Command("ffmpeg", "-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
-		ffmpeg.Stdin = ytOut
+	// The spoken text is optional and only used for live captions
+	text := r.URL.Query().Get("text")
+	if text == "" {
+		text = r.Header.Get("X-Playback-Text")
+	}
+
+	p := EnqueuePlayback(guildID, "api", tag, text, filePath, data)
 
-		ffmpegOut, err := ffmpeg.StdoutPipe()
+	status := http.StatusAccepted
+	if r.URL.Query().Get("wait") == "true" {
+		p.Wait()
+		status = http.StatusOK
+	}
+
+	snapshot, _ := GetPlayback(p.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"playback_id": snapshot.ID,
+		"state":       snapshot.State,
+	})
+}
+
+// streamVoiceAudio streams raw audio data (or, if data is nil, the file at filePath) to the mixer's
+// voice channel until it ends or ctx is cancelled. WAV and Ogg/Opus are decoded natively;
+// anything else is handed to ffmpeg.
+func streamVoiceAudio(ctx context.Context, mixer *audio.AudioMixer, filePath string, data []byte) error {
+	defer removeTempAudio(filePath)
+
+	if data == nil {
+		var err error
+		data, err = os.ReadFile(filePath)
 		if err != nil {
-			log.Printf("Error creating ffmpeg stdout pipe: %v", err)
-			return
+			return fmt.Errorf("failed to read audio file: %w", err)
 		}
+	}
 
-		if err := ffmpeg.Start(); err != nil {
-			log.Printf("Error starting ffmpeg: %v", err)
-			return
+	switch {
+	case audio.IsWAV(data):
+		pcm, err := audio.DecodeWAV(data)
+		if err == nil {
+			return mixer.StreamPCM(ctx, pcm, true)
 		}
-		defer func() { _ = ffmpeg.Wait() }()
-
-		// 3. Stream to Mixer (isVoice = false)
-		// This will block until stream ends
-		if err := mixer.StreamFromReader(context.Background(), ffmpegOut, false); err != nil {
-			log.Printf("Error streaming music to mixer: %v", err)
+		log.Printf("Native WAV decode failed, falling back to ffmpeg: %v", err)
+	case audio.IsOggOpus(data):
+		err := mixer.StreamOggOpus(ctx, bytes.NewReader(data))
+		if !errors.Is(err, audio.ErrUnsupportedFormat) {
+			return err
 		}
+		log.Printf("Native Ogg/Opus decode failed, falling back to ffmpeg: %v", err)
+	}
+
+	return streamWithFFmpeg(ctx, mixer, data)
+}
+
+// streamWithFFmpeg decodes formats the native decoders do not handle
+func streamWithFFmpeg(ctx context.Context, mixer *audio.AudioMixer, data []byte) error {
+	ffmpeg := exec.Command("ffmpeg", "-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
+	ffmpeg.Stdin = bytes.NewReader(data)
 
-		log.Printf("Finished playback for URL: %s", req.URL)
+	ffmpegOut, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ffmpeg stdout pipe: %w", err)
+	}
+
+	if err := ffmpeg.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	defer func() {
+		_ = ffmpeg.Process.Kill()
+		_ = ffmpeg.Wait()
 	}()
 
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"playing"}`))
+	return mixer.StreamFromReader(ctx, ffmpegOut, true)
 }
 
-// PlayAudioHandler handles requests to play audio on the active voice connection (POST)
-func PlayAudioHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// removeTempAudio releases and deletes a played audio file if it is in the media store
+// (or, for paths handed to us by other services, if it looks like a temp file)
+func removeTempAudio(filePath string) {
+	if audio.IsMediaFile(filePath) {
+		audio.ReleaseMedia(filePath)
+		audio.RemoveMedia(filePath)
 		return
 	}
-
-	mixer := audio.GetGlobalMixer()
-	if mixer == nil {
-		http.Error(w, "No active audio mixer", http.StatusServiceUnavailable)
-		return
+	if filePath != "" && strings.Contains(filePath, "tmp") {
+		_ = os.Remove(filePath)
 	}
+}
 
-	// Check if we are streaming from a file
-	filePath := r.URL.Query().Get("file_path")
-	if filePath == "" {
-		filePath = r.Header.Get("X-File-Path")
-	}
+// VolumeRequest is a partial update of the mixer levels; omitted fields are left unchanged
+type VolumeRequest struct {
+	GuildID       string   `json:"guild_id"`
+	Voice         *float64 `json:"voice"`
+	Music         *float64 `json:"music"`
+	Effects       *float64 `json:"effects"`
+	Ducking       *float64 `json:"ducking"`
+	DuckAttackMs  *int     `json:"duck_attack_ms"`
+	DuckReleaseMs *int     `json:"duck_release_ms"`
+}
 
-	var ffmpeg *exec.Cmd
-	if filePath != "" {
-		// Validate file exists
-		if _, err := os.Stat(filePath); err != nil {
-			log.Printf("PlayAudioHandler: File not found: %s", filePath)
-			http.Error(w, "File not found", http.StatusBadRequest)
+// VolumeHandler reads (GET) or adjusts (POST) the per-channel gains and ducking of a guild's mixer
+func VolumeHandler(w http.ResponseWriter, r *http.Request) {
+	var req VolumeRequest
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		// Stream from file
-		ffmpeg = exec.Command("ffmpeg", "-i", filePath, "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
-	} else {
-		// Stream from request body
-		ffmpeg = exec.Command("ffmpeg", "-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
-		ffmpeg.Stdin = r.Body
-	}
-
-	ffmpegOut, err := ffmpeg.StdoutPipe()
-	if err != nil {
-		log.Printf("Error creating ffmpeg stdout pipe: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if err := ffmpeg.Start(); err != nil {
-		log.Printf("Error starting ffmpeg: %v", err)
-		http.Error(w, "ffmpeg error", http.StatusInternalServerError)
+	if req.GuildID == "" {
+		req.GuildID = guildIDFromRequest(r)
+	}
+	guildID := resolveGuildID(req.GuildID)
+	mixer := audio.GetMixer(guildID)
+	if mixer == nil {
+		http.Error(w, "No active audio mixer", http.StatusServiceUnavailable)
 		return
 	}
 
-	defer func() {
-		_ = ffmpeg.Wait()
-		// Clean up temp file if used and it looks like a temp file
-		if filePath != "" && strings.Contains(filePath, "tmp") {
-			_ = os.Remove(filePath)
+	if r.Method == http.MethodPost {
+		levels := mixer.Levels()
+		if req.Voice != nil {
+			levels.Voice = *req.Voice
+		}
+		if req.Music != nil {
+			levels.Music = *req.Music
+		}
+		if req.Effects != nil {
+			levels.Effects = *req.Effects
+		}
+		if req.Ducking != nil {
+			levels.Ducking = *req.Ducking
+		}
+		if req.DuckAttackMs != nil {
+			levels.DuckAttackMs = *req.DuckAttackMs
+		}
+		if req.DuckReleaseMs != nil {
+			levels.DuckReleaseMs = *req.DuckReleaseMs
 		}
-	}()
 
-	// Stream to Mixer (isVoice = true)
-	// We use the mixer's voice context to allow interruption
-	if err := mixer.StreamFromReader(mixer.GetVoiceContext(), ffmpegOut, true); err != nil {
-		if err == context.Canceled {
-			log.Println("PlayAudioHandler: Voice playback interrupted (Barge-In).")
-		} else {
-			log.Printf("Error streaming voice to mixer: %v", err)
+		if err := levels.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		mixer.SetLevels(levels)
+		audio.SaveGuildMixLevels(guildID, levels)
+		log.Printf("Mixer levels updated: %+v", levels)
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(mixer.Levels())
 }
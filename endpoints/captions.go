@@ -0,0 +1,241 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// CaptionVoiceChat posts captions in the voice channel's built-in text chat
+	CaptionVoiceChat = "voice"
+	// captionOff is stored to turn off a caption target set in options.json
+	captionOff = "off"
+
+	// captionMergeWindow is how long a speaker's caption message keeps growing while they keep talking
+	captionMergeWindow = 2 * time.Minute
+	// captionMaxLength keeps merged captions under Discord's 2000 character limit
+	captionMaxLength = 1900
+)
+
+func captionKey(voiceChannelID string) string { return "discord:captions:" + voiceChannelID }
+
+// captionMessage is the last caption posted to a target, which the same speaker's next line is merged into
+type captionMessage struct {
+	messageID string
+	speakerID string
+	content   string
+	updated   time.Time
+}
+
+// captionTarget serialises posting to one text channel or thread
+type captionTarget struct {
+	mu   sync.Mutex
+	last *captionMessage
+}
+
+var (
+	captionsMu       sync.Mutex
+	captionConfig    = make(map[string]string) // Voice channel ID -> target from options.json
+	captionOverrides = make(map[string]string) // Voice channel ID -> target set at runtime ("off" disables)
+	captionTargets   = make(map[string]*captionTarget)
+)
+
+// ConfigureCaptions sets the caption targets from options.json: voice channel ID to "voice"
+// (the channel's own text chat) or the ID of a text channel or thread
+func ConfigureCaptions(targets map[string]string) {
+	captionsMu.Lock()
+	defer captionsMu.Unlock()
+	captionConfig = make(map[string]string, len(targets))
+	for voiceChannelID, target := range targets {
+		captionConfig[voiceChannelID] = target
+	}
+}
+
+// GetCaptionTarget returns the channel captions for a voice channel are posted in, or "" if captions are off.
+// Targets set at runtime are kept in Redis and override options.json.
+func GetCaptionTarget(ctx context.Context, voiceChannelID string) string {
+	captionsMu.Lock()
+	target, overridden := captionOverrides[voiceChannelID]
+	configured := captionConfig[voiceChannelID]
+	captionsMu.Unlock()
+
+	if !overridden && redisClient != nil {
+		stored, err := redisClient.Get(ctx, captionKey(voiceChannelID)).Result()
+		if err == nil {
+			target, overridden = stored, true
+			captionsMu.Lock()
+			captionOverrides[voiceChannelID] = stored
+			captionsMu.Unlock()
+		}
+	}
+	if !overridden {
+		target = configured
+	}
+
+	switch target {
+	case "", captionOff:
+		return ""
+	case CaptionVoiceChat:
+		return voiceChannelID
+	}
+	return target
+}
+
+// SetCaptionTarget sets where a voice channel's captions go ("voice", a channel or thread ID, or "" to turn them off)
+func SetCaptionTarget(ctx context.Context, voiceChannelID, target string) error {
+	if target == "" {
+		target = captionOff
+	}
+	if redisClient != nil {
+		if err := redisClient.Set(ctx, captionKey(voiceChannelID), target, 0).Err(); err != nil {
+			return err
+		}
+	}
+	captionsMu.Lock()
+	captionOverrides[voiceChannelID] = target
+	captionsMu.Unlock()
+	log.Printf("Captions for voice channel %s: %s", voiceChannelID, target)
+	return nil
+}
+
+// PostCaption mirrors a line spoken in a voice channel into its caption target as "**Name:** text".
+// Consecutive lines from the same speaker are merged into one edited message.
+func PostCaption(voiceChannelID, speakerID, speakerName, text string) {
+	text = strings.TrimSpace(text)
+	if voiceChannelID == "" || text == "" {
+		return
+	}
+	targetID := GetCaptionTarget(context.Background(), voiceChannelID)
+	if targetID == "" {
+		return
+	}
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+	if dg == nil {
+		return
+	}
+
+	captionsMu.Lock()
+	target, ok := captionTargets[targetID]
+	if !ok {
+		target = &captionTarget{}
+		captionTargets[targetID] = target
+	}
+	captionsMu.Unlock()
+
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	// Transcripts are not trusted to mention anyone
+	noMentions := &discordgo.MessageAllowedMentions{}
+
+	if last := target.last; last != nil && last.speakerID == speakerID && time.Since(last.updated) < captionMergeWindow &&
+		len(last.content)+1+len(text) <= captionMaxLength {
+		content := last.content + " " + text
+		_, err := dg.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              last.messageID,
+			Channel:         targetID,
+			Content:         &content,
+			AllowedMentions: noMentions,
+		})
+		if err == nil {
+			last.content = content
+			last.updated = time.Now()
+			return
+		}
+		log.Printf("Captions: failed to edit caption in %s, posting a new one: %v", targetID, err)
+	}
+
+	content := fmt.Sprintf("**%s:** %s", speakerName, text)
+	if runes := []rune(content); len(runes) > captionMaxLength {
+		content = string(runes[:captionMaxLength-3]) + "..."
+	}
+	msg, err := dg.ChannelMessageSendComplex(targetID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: noMentions,
+	})
+	if err != nil {
+		log.Printf("Captions: failed to post caption in %s: %v", targetID, err)
+		target.last = nil
+		return
+	}
+	target.last = &captionMessage{messageID: msg.ID, speakerID: speakerID, content: content, updated: time.Now()}
+}
+
+// PostBotCaption captions something Dexter is saying in a guild's voice channel
+func PostBotCaption(guildID, text string) {
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+	if dg == nil || dg.State == nil || dg.State.User == nil {
+		return
+	}
+	session := audio.GetSession(guildID)
+	if session == nil {
+		return
+	}
+	voiceChannelID := session.ChannelID()
+	botID := dg.State.User.ID
+	PostCaption(voiceChannelID, botID, utils.GetUserDisplayName(dg, redisClient, guildID, botID), text)
+}
+
+// NoteCaptionChannelMessage stops merging captions into the last one once anything else is posted after it
+func NoteCaptionChannelMessage(channelID, messageID string) {
+	captionsMu.Lock()
+	target, ok := captionTargets[channelID]
+	captionsMu.Unlock()
+	if !ok {
+		return
+	}
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if target.last != nil && target.last.messageID != messageID {
+		target.last = nil
+	}
+}
+
+// CaptionsHandler reads (GET) or sets (POST {"target": "voice" | "<channel or thread ID>" | ""})
+// where a voice channel's captions are posted (/voice/captions/{voice_channel_id})
+func CaptionsHandler(w http.ResponseWriter, r *http.Request) {
+	voiceChannelID := strings.TrimPrefix(r.URL.Path, "/voice/captions/")
+	if voiceChannelID == "" || strings.Contains(voiceChannelID, "/") {
+		http.Error(w, "Invalid voice channel ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := SetCaptionTarget(r.Context(), voiceChannelID, req.Target); err != nil {
+			http.Error(w, "Failed to save caption target: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"voice_channel_id": voiceChannelID,
+		"target_id":        GetCaptionTarget(r.Context(), voiceChannelID),
+	})
+}
@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/profile"
+)
+
+// LookupVoiceConsent reports whether a user has opted out of voice recording
+func LookupVoiceConsent(userID string) (bool, error) {
+	if redisClient == nil {
+		return false, nil
+	}
+	consent, err := profile.NewStore(redisClient).GetVoiceConsent(context.Background(), userID)
+	if err != nil {
+		return false, err
+	}
+	return consent.OptedOut, nil
+}
+
+// SetVoiceConsent stores a user's recording opt-out and applies it to live voice sessions immediately
+func SetVoiceConsent(ctx context.Context, userID string, optedOut bool, updatedBy string) (*profile.VoiceConsent, error) {
+	if redisClient == nil {
+		return nil, fmt.Errorf("redis unavailable")
+	}
+	consent := &profile.VoiceConsent{
+		UserID:    userID,
+		OptedOut:  optedOut,
+		UpdatedAt: time.Now().Format(time.RFC3339),
+		UpdatedBy: updatedBy,
+	}
+	if err := profile.NewStore(redisClient).SaveVoiceConsent(ctx, consent); err != nil {
+		return nil, err
+	}
+	audio.SetOptedOut(userID, optedOut)
+	log.Printf("Voice consent for %s set to opted_out=%v by %s", userID, optedOut, updatedBy)
+	return consent, nil
+}
+
+// VoiceConsentHandler reads (GET) or sets (POST {"opted_out": true}) a user's voice recording consent (/voice/consent/{user_id})
+func VoiceConsentHandler(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimPrefix(r.URL.Path, "/voice/consent/")
+	if userID == "" || strings.Contains(userID, "/") {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if redisClient == nil {
+		http.Error(w, "Redis unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var consent *profile.VoiceConsent
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		consent, err = profile.NewStore(redisClient).GetVoiceConsent(r.Context(), userID)
+	case http.MethodPost:
+		var req struct {
+			OptedOut bool `json:"opted_out"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		consent, err = SetVoiceConsent(r.Context(), userID, req.OptedOut, "api")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to access voice consent: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(consent)
+}
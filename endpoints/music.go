@@ -0,0 +1,140 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+)
+
+// MusicRequest is the body accepted by the music endpoints
+type MusicRequest struct {
+	GuildID     string  `json:"guild_id"`
+	URL         string  `json:"url,omitempty"`
+	RequestedBy string  `json:"requested_by,omitempty"`
+	Position    float64 `json:"position,omitempty"` // Seek target in seconds
+	Mode        string  `json:"mode,omitempty"`     // Loop mode: off, track, queue
+}
+
+// PlayMusicHandler handles requests to queue music from a URL (e.g., YouTube)
+func PlayMusicHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MusicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+
+	guildID := resolveGuildID(req.GuildID)
+	if guildID == "" || audio.GetMixer(guildID) == nil {
+		http.Error(w, "No active audio mixer", http.StatusServiceUnavailable)
+		return
+	}
+
+	track, position := audio.GetMusicPlayer(guildID).Enqueue(req.URL, req.RequestedBy)
+	log.Printf("Music [%s]: Queued %s at position %d", guildID, req.URL, position)
+
+	status := "queued"
+	if position == 0 {
+		status = "playing"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"position": position,
+		"track":    track,
+	})
+}
+
+// MusicQueueHandler returns the now-playing track and the upcoming queue (GET /audio/queue)
+func MusicQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	guildID := resolveGuildID(r.URL.Query().Get("guild_id"))
+	if guildID == "" {
+		http.Error(w, "guild_id is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(audio.GetMusicPlayer(guildID).State()); err != nil {
+		log.Printf("Error encoding music queue: %v", err)
+	}
+}
+
+// MusicControlHandler handles /audio/music/{skip,pause,resume,stop,seek,loop,shuffle}
+func MusicControlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := strings.TrimPrefix(r.URL.Path, "/audio/music/")
+
+	var req MusicRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	guildID := resolveGuildID(req.GuildID)
+	if guildID == "" {
+		http.Error(w, "guild_id is required", http.StatusBadRequest)
+		return
+	}
+	player := audio.GetMusicPlayer(guildID)
+
+	ok := true
+	switch action {
+	case "skip":
+		ok = player.Skip()
+	case "pause":
+		ok = player.Pause()
+	case "resume":
+		ok = player.Resume()
+	case "stop":
+		player.Stop()
+	case "seek":
+		if err := player.Seek(time.Duration(req.Position * float64(time.Second))); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	case "loop":
+		if err := player.SetLoop(audio.LoopMode(req.Mode)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "shuffle":
+		player.Shuffle()
+	default:
+		http.Error(w, "Unknown music action", http.StatusNotFound)
+		return
+	}
+
+	if !ok {
+		http.Error(w, "Nothing to "+action, http.StatusConflict)
+		return
+	}
+
+	log.Printf("Music [%s]: %s", guildID, action)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(player.State())
+}
@@ -0,0 +1,299 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+)
+
+// PlaybackState is the lifecycle state of a queued voice clip
+type PlaybackState string
+
+const (
+	PlaybackQueued      PlaybackState = "queued"
+	PlaybackPlaying     PlaybackState = "playing"
+	PlaybackFinished    PlaybackState = "finished"
+	PlaybackInterrupted PlaybackState = "interrupted"
+	PlaybackFailed      PlaybackState = "failed"
+)
+
+// playbackRetention is how long finished playbacks stay queryable
+const playbackRetention = 10 * time.Minute
+
+// Playback is a single voice clip in the playback queue
+type Playback struct {
+	ID        string        `json:"id"`
+	GuildID   string        `json:"guild_id"`
+	State     PlaybackState `json:"state"`
+	Source    string        `json:"source"`         // Who queued it: api, stream, greeting
+	Tag       string        `json:"tag,omitempty"`  // Caller-supplied correlation tag
+	Text      string        `json:"text,omitempty"` // What is being said, for live captions
+	Error     string        `json:"error,omitempty"`
+	QueuedAt  time.Time     `json:"queued_at"`
+	StartedAt *time.Time    `json:"started_at,omitempty"`
+	EndedAt   *time.Time    `json:"ended_at,omitempty"`
+
+	filePath string
+	data     []byte
+	done     chan struct{}
+}
+
+// Wait blocks until the playback has finished, been interrupted or failed
+func (p *Playback) Wait() {
+	<-p.done
+}
+
+// playbackQueue plays one guild's clips in order
+type playbackQueue struct {
+	guildID string
+	pending []*Playback // Guarded by playbacksMu
+	wake    chan struct{}
+}
+
+var (
+	playbacksMu    sync.Mutex
+	playbackItems  map[string]*Playback        // All recent playbacks by ID
+	playbackQueues map[string]*playbackQueue   // Keyed by guild ID
+	playbackEvents chan utils.BotPlaybackEvent // Sent in order by a single worker
+	playbackSeq    atomic.Uint64               // Keeps IDs unique when clips are queued in the same clock tick
+)
+
+// InitPlaybackQueue prepares the voice playback queues and starts the event worker
+func InitPlaybackQueue() {
+	playbackItems = make(map[string]*Playback)
+	playbackQueues = make(map[string]*playbackQueue)
+	playbackEvents = make(chan utils.BotPlaybackEvent, 64)
+	go sendPlaybackEvents()
+}
+
+// getPlaybackQueue returns a guild's queue, starting its worker on first use. Caller holds playbacksMu.
+func getPlaybackQueue(guildID string) *playbackQueue {
+	q, ok := playbackQueues[guildID]
+	if !ok {
+		q = &playbackQueue{guildID: guildID, wake: make(chan struct{}, 1)}
+		playbackQueues[guildID] = q
+		go q.run()
+	}
+	return q
+}
+
+// EnqueuePlayback queues a voice clip for a guild from a file path or raw audio data and returns immediately.
+// text, if known, is captioned when the clip starts playing.
+func EnqueuePlayback(guildID, source, tag, text, filePath string, data []byte) *Playback {
+	p := &Playback{
+		ID:       strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(playbackSeq.Add(1), 36),
+		GuildID:  guildID,
+		State:    PlaybackQueued,
+		Source:   source,
+		Tag:      tag,
+		Text:     text,
+		QueuedAt: time.Now(),
+		filePath: filePath,
+		data:     data,
+		done:     make(chan struct{}),
+	}
+
+	// Keep the janitor away from the file until it has been played
+	audio.AcquireMedia(filePath)
+
+	playbacksMu.Lock()
+	prunePlaybacks()
+	playbackItems[p.ID] = p
+	q := getPlaybackQueue(guildID)
+	q.pending = append(q.pending, p)
+	snapshot := *p
+	playbacksMu.Unlock()
+
+	// Emit before waking the worker so "queued" always precedes "playing"
+	emitPlaybackEvent(snapshot)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return p
+}
+
+// GetPlayback returns a copy of a playback's current status
+func GetPlayback(id string) (Playback, bool) {
+	playbacksMu.Lock()
+	defer playbacksMu.Unlock()
+	p, ok := playbackItems[id]
+	if !ok {
+		return Playback{}, false
+	}
+	return *p, true
+}
+
+// prunePlaybacks drops completed playbacks older than the retention window. Caller holds playbacksMu.
+func prunePlaybacks() {
+	for id, p := range playbackItems {
+		if p.EndedAt != nil && time.Since(*p.EndedAt) > playbackRetention {
+			delete(playbackItems, id)
+		}
+	}
+}
+
+// run plays queued clips one after another on the guild mixer's voice channel
+func (q *playbackQueue) run() {
+	for range q.wake {
+		for {
+			playbacksMu.Lock()
+			if len(q.pending) == 0 {
+				playbacksMu.Unlock()
+				break
+			}
+			p := q.pending[0]
+			q.pending = q.pending[1:]
+			playbacksMu.Unlock()
+
+			q.play(p)
+		}
+	}
+}
+
+func (q *playbackQueue) play(p *Playback) {
+	mixer := audio.GetMixer(q.guildID)
+	if mixer == nil {
+		removeTempAudio(p.filePath)
+		q.finish(p, PlaybackFailed, "no active audio mixer")
+		return
+	}
+
+	// Bind to the current voice context so a barge-in interrupts this clip
+	ctx := mixer.GetVoiceContext()
+
+	playbacksMu.Lock()
+	now := time.Now()
+	p.State = PlaybackPlaying
+	p.StartedAt = &now
+	snapshot := *p
+	playbacksMu.Unlock()
+	emitPlaybackEvent(snapshot)
+	if p.Text != "" {
+		go PostBotCaption(q.guildID, p.Text)
+	}
+
+	err := streamVoiceAudio(ctx, mixer, p.filePath, p.data)
+	if err == nil {
+		// Frames are buffered ahead of real time; report completion once they have actually been heard
+		err = mixer.WaitVoiceDrained(ctx)
+	}
+
+	switch {
+	case err == context.Canceled:
+		log.Printf("Playback %s: interrupted (Barge-In).", p.ID)
+		q.finish(p, PlaybackInterrupted, "")
+		q.interruptPending()
+	case err != nil:
+		log.Printf("Playback %s: failed: %v", p.ID, err)
+		q.finish(p, PlaybackFailed, err.Error())
+	default:
+		q.finish(p, PlaybackFinished, "")
+	}
+}
+
+// interruptPending drops everything queued behind an interrupted clip; the user has started talking
+func (q *playbackQueue) interruptPending() {
+	playbacksMu.Lock()
+	dropped := q.pending
+	q.pending = nil
+	playbacksMu.Unlock()
+
+	for _, p := range dropped {
+		removeTempAudio(p.filePath)
+		q.finish(p, PlaybackInterrupted, "")
+	}
+}
+
+func (q *playbackQueue) finish(p *Playback, state PlaybackState, errMsg string) {
+	playbacksMu.Lock()
+	now := time.Now()
+	p.State = state
+	p.Error = errMsg
+	p.EndedAt = &now
+	p.data = nil
+	snapshot := *p
+	playbacksMu.Unlock()
+
+	close(p.done)
+	emitPlaybackEvent(snapshot)
+}
+
+// emitPlaybackEvent queues a messaging.bot.playback.* event for a snapshot of a playback
+func emitPlaybackEvent(snapshot Playback) {
+	if eventServiceURL == "" {
+		return
+	}
+
+	event := utils.BotPlaybackEvent{
+		GenericMessagingEvent: utils.GenericMessagingEvent{
+			Type:      utils.EventType("messaging.bot.playback." + string(snapshot.State)),
+			Source:    "discord",
+			UserLevel: string(utils.LevelMe),
+			Timestamp: time.Now(),
+		},
+		PlaybackID: snapshot.ID,
+		State:      string(snapshot.State),
+		Origin:     snapshot.Source,
+		Tag:        snapshot.Tag,
+		Error:      snapshot.Error,
+	}
+	if dg := discordSession; dg != nil && dg.State != nil && dg.State.User != nil {
+		event.UserID = dg.State.User.ID
+		event.UserName = dg.State.User.Username
+	}
+	event.ServerID = snapshot.GuildID
+	if session := audio.GetSession(snapshot.GuildID); session != nil {
+		event.ChannelID = session.ChannelID()
+	}
+	if snapshot.StartedAt != nil && snapshot.EndedAt != nil {
+		event.DurationMs = snapshot.EndedAt.Sub(*snapshot.StartedAt).Milliseconds()
+	}
+
+	select {
+	case playbackEvents <- event:
+	default:
+		log.Printf("Playback event backlog full, dropping %s for %s", event.Type, snapshot.ID)
+	}
+}
+
+func sendPlaybackEvents() {
+	for event := range playbackEvents {
+		if err := utils.SendEvent(event); err != nil {
+			log.Printf("Error sending playback event: %v", err)
+		}
+	}
+}
+
+// PlaybackStatusHandler returns the status of a queued voice clip (GET /audio/playback/{id})
+func PlaybackStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/audio/playback/")
+	if id == "" {
+		http.Error(w, "Missing playback ID", http.StatusBadRequest)
+		return
+	}
+
+	p, ok := GetPlayback(id)
+	if !ok {
+		http.Error(w, "Playback not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,28 @@
+package endpoints
+
+import "testing"
+
+func TestEnqueuePlaybackIDsAreUnique(t *testing.T) {
+	InitPlaybackQueue()
+
+	// Clips queued back to back land in the same clock tick on coarse clocks
+	seen := make(map[string]bool)
+	var clips []*Playback
+	for i := 0; i < 100; i++ {
+		p := EnqueuePlayback("no-mixer-guild", "api", "", "", "", nil)
+		if seen[p.ID] {
+			t.Fatalf("clip %d reused ID %s", i, p.ID)
+		}
+		seen[p.ID] = true
+		clips = append(clips, p)
+	}
+
+	// Without a voice connection every clip fails, each under its own ID
+	for _, p := range clips {
+		p.Wait()
+		got, ok := GetPlayback(p.ID)
+		if !ok || got.State != PlaybackFailed {
+			t.Fatalf("playback %s = %+v, want it found and failed", p.ID, got)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+	"github.com/bwmarrin/discordgo"
+)
+
+// readerMutedKey is the Redis set of users whose messages are never read aloud
+const readerMutedKey = "discord:reader:muted"
+
+// ReaderConfig controls reader mode. Zero values use the defaults.
+type ReaderConfig struct {
+	Channels  []string // Text channels whose messages are read aloud
+	MaxLength int      // Longer messages are cut at a word boundary (default 300 characters)
+	QueueSize int      // Messages waiting to be read per guild; more are skipped (default 5)
+	Muted     []string // User IDs never read aloud, on top of those muted by command
+}
+
+// readRequest is a message waiting to be read aloud
+type readRequest struct {
+	messageID string
+	userID    string
+	text      string
+}
+
+var (
+	readerMu      sync.Mutex
+	readerConfig  = ReaderConfig{MaxLength: 300, QueueSize: 5}
+	readerQueues  = make(map[string]chan readRequest) // Keyed by guild ID
+	readerMutedID = make(map[string]bool)             // From options.json
+)
+
+// ConfigureReader sets the reader mode channels and limits
+func ConfigureReader(cfg ReaderConfig) {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = 300
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 5
+	}
+	readerMu.Lock()
+	defer readerMu.Unlock()
+	readerConfig = cfg
+	readerMutedID = make(map[string]bool, len(cfg.Muted))
+	for _, userID := range cfg.Muted {
+		readerMutedID[userID] = true
+	}
+}
+
+// IsReaderChannel reports whether messages in a channel are read aloud
+func IsReaderChannel(channelID string) bool {
+	readerMu.Lock()
+	defer readerMu.Unlock()
+	for _, id := range readerConfig.Channels {
+		if id == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetReaderMuted adds or removes a user from the reader mute list
+func SetReaderMuted(ctx context.Context, userID string, muted bool) error {
+	if redisClient == nil {
+		return fmt.Errorf("redis unavailable")
+	}
+	if muted {
+		return redisClient.SAdd(ctx, readerMutedKey, userID).Err()
+	}
+	return redisClient.SRem(ctx, readerMutedKey, userID).Err()
+}
+
+// IsReaderMuted reports whether a user's messages are never read aloud
+func IsReaderMuted(ctx context.Context, userID string) bool {
+	readerMu.Lock()
+	muted := readerMutedID[userID]
+	readerMu.Unlock()
+	if muted || redisClient == nil {
+		return muted
+	}
+	muted, err := redisClient.SIsMember(ctx, readerMutedKey, userID).Result()
+	if err != nil {
+		log.Printf("Reader: failed to check mute list for %s: %v", userID, err)
+	}
+	return muted
+}
+
+// ReadMessageAloud queues a message from a reader channel to be spoken in Dexter's voice channel.
+// Only messages from people in that voice channel are read, prefixed with the author's name.
+// It returns false if the message was not queued.
+func ReadMessageAloud(guildID string, m *discordgo.Message) bool {
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+	if dg == nil || !IsReaderChannel(m.ChannelID) {
+		return false
+	}
+
+	session := audio.GetSession(guildID)
+	if session == nil || session.ChannelID() == "" {
+		return false
+	}
+	vs, err := dg.State.VoiceState(guildID, m.Author.ID)
+	if err != nil || vs.ChannelID != session.ChannelID() {
+		return false
+	}
+	if IsReaderMuted(context.Background(), m.Author.ID) {
+		return false
+	}
+
+	readerMu.Lock()
+	maxLength, queueSize := readerConfig.MaxLength, readerConfig.QueueSize
+	queue, ok := readerQueues[guildID]
+	if !ok {
+		queue = make(chan readRequest, queueSize)
+		readerQueues[guildID] = queue
+		go runReader(guildID, queue)
+	}
+	readerMu.Unlock()
+
+	text := cleanTextForSpeech(m.ContentWithMentionsReplaced())
+	if text == "" {
+		return false
+	}
+	text = truncateForSpeech(text, maxLength)
+
+	select {
+	case queue <- readRequest{messageID: m.ID, userID: m.Author.ID, text: text}:
+		return true
+	default:
+		log.Printf("Reader [%s]: queue full, skipping message %s from %s", guildID, m.ID, m.Author.ID)
+		return false
+	}
+}
+
+// runReader reads a guild's queued messages one at a time, waiting for each to finish playing
+func runReader(guildID string, queue chan readRequest) {
+	for req := range queue {
+		sessionMutex.RLock()
+		dg := discordSession
+		sessionMutex.RUnlock()
+		if dg == nil || audio.GetMixer(guildID) == nil {
+			continue
+		}
+
+		name := utils.GetUserDisplayName(dg, redisClient, guildID, req.userID)
+		filePath, data, err := SynthesizeSpeech(fmt.Sprintf("%s says: %s", name, req.text))
+		if err != nil {
+			log.Printf("Reader [%s]: speech synthesis failed for message %s: %v", guildID, req.messageID, err)
+			continue
+		}
+		// No caption: the message is already in text
+		EnqueuePlayback(guildID, "reader", req.messageID, "", filePath, data).Wait()
+	}
+}
+
+// truncateForSpeech cuts text to at most limit characters, at the last word boundary
+func truncateForSpeech(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -0,0 +1,167 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+)
+
+// StartSessionRecording starts a multi-track recording of Dexter's voice channel in a guild
+func StartSessionRecording(guildID string) (*audio.SessionRecording, error) {
+	session := audio.GetSession(guildID)
+	if session == nil {
+		return nil, errNotInVoice
+	}
+
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+
+	rec, err := session.StartSessionRecording(func(userID string) string {
+		if dg == nil {
+			return ""
+		}
+		return utils.GetUserDisplayName(dg, redisClient, guildID, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	emitRecordingEvent(utils.EventTypeMessagingBotRecordingStarted, guildID, session.ChannelID(), audio.SessionManifest{ID: rec.ID()}, "")
+	return rec, nil
+}
+
+// StopSessionRecording stops a guild's session recording; reason is included in the event (e.g. "requested", "left_voice")
+func StopSessionRecording(guildID, reason string) (audio.SessionManifest, error) {
+	session := audio.GetSession(guildID)
+	if session == nil || session.SessionRecording() == nil {
+		return audio.SessionManifest{}, errNoSessionRecording
+	}
+
+	manifest, err := session.StopSessionRecording()
+	if err != nil {
+		log.Printf("Error finishing session recording %s: %v", manifest.ID, err)
+	}
+	emitRecordingEvent(utils.EventTypeMessagingBotRecordingStopped, guildID, manifest.ChannelID, manifest, reason)
+	return manifest, err
+}
+
+func emitRecordingEvent(eventType utils.EventType, guildID, channelID string, manifest audio.SessionManifest, reason string) {
+	event := utils.BotRecordingEvent{
+		GenericMessagingEvent: utils.GenericMessagingEvent{
+			Type:      eventType,
+			Source:    "discord",
+			ChannelID: channelID,
+			ServerID:  guildID,
+			Timestamp: time.Now(),
+		},
+		RecordingID: manifest.ID,
+		DurationMs:  manifest.DurationMs,
+		Speakers:    len(manifest.Speakers),
+		Reason:      reason,
+	}
+	go func() {
+		if err := utils.SendEvent(event); err != nil {
+			log.Printf("Error sending recording event: %v", err)
+		}
+	}()
+}
+
+// SessionRecordingHandler starts or stops a guild's session recording (POST /voice/recording/{start,stop})
+func SessionRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VoiceChannelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GuildID == "" {
+		req.GuildID = guildIDFromRequest(r)
+	}
+	guildID := resolveGuildID(req.GuildID)
+	if guildID == "" {
+		http.Error(w, "guild_id is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch action := strings.TrimPrefix(r.URL.Path, "/voice/recording/"); action {
+	case "start":
+		rec, err := StartSessionRecording(guildID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": rec.ID()})
+	case "stop":
+		manifest, err := StopSessionRecording(guildID, "requested")
+		if err == errNoSessionRecording {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(manifest)
+	default:
+		http.Error(w, "Unknown action", http.StatusNotFound)
+	}
+}
+
+// RecordingsHandler lists session recordings (GET /recordings), returns one manifest (GET /recordings/{id})
+// or downloads one of its files (GET /recordings/{id}/{file})
+func RecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/recordings"), "/"), "/")
+	switch {
+	case parts[0] == "":
+		manifests, err := audio.ListSessionRecordings()
+		if err != nil {
+			log.Printf("Error listing session recordings: %v", err)
+			http.Error(w, "Failed to list recordings", http.StatusInternalServerError)
+			return
+		}
+		if manifests == nil {
+			manifests = []audio.SessionManifest{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(manifests)
+
+	case len(parts) == 1:
+		manifest, err := audio.LoadSessionManifest(parts[0])
+		if err != nil {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(manifest)
+
+	case len(parts) == 2:
+		path, err := audio.SessionRecordingFile(parts[0], parts[1])
+		if err != nil {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if strings.HasSuffix(path, ".opus") {
+			w.Header().Set("Content-Type", "audio/ogg")
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+parts[0]+"-"+parts[1]+"\"")
+		http.ServeFile(w, r, path)
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,70 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+)
+
+// SoundboardHandler lists soundboard clips (GET /audio/sfx) and plays one on the effects bus (POST /audio/sfx/{name})
+func SoundboardHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/audio/sfx"), "/")
+
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		clips, err := audio.RefreshSoundboard()
+		if err != nil {
+			log.Printf("Error listing soundboard clips: %v", err)
+			http.Error(w, "Failed to list sound clips", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clips)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		GuildID string `json:"guild_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GuildID == "" {
+		req.GuildID = guildIDFromRequest(r)
+	}
+	guildID := resolveGuildID(req.GuildID)
+	if guildID == "" || audio.GetMixer(guildID) == nil {
+		http.Error(w, "No active audio mixer", http.StatusServiceUnavailable)
+		return
+	}
+
+	clip, err := audio.PlaySoundClip(guildID, name)
+	if errors.Is(err, audio.ErrUnknownClip) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error playing sound clip %s: %v", name, err)
+		http.Error(w, "Failed to play sound clip", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Soundboard [%s]: Playing %s", guildID, clip.Name)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clip)
+}
@@ -0,0 +1,278 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+)
+
+var ttsServiceURL string
+
+// discordMarkupPattern matches custom emoji, mentions and channel links, e.g. <a:typing:123>, <@123>, <#123>
+var discordMarkupPattern = regexp.MustCompile(`<(a?:\w+:|@[!&]?|#)\d+>`)
+
+// SetTTSServiceURL sets the URL for the TTS service
+func SetTTSServiceURL(url string) {
+	ttsServiceURL = url
+}
+
+// SynthesizeSpeech asks the TTS service to generate audio for the given text.
+// It returns either the path of the generated WAV file or the raw audio bytes.
+func SynthesizeSpeech(text string) (string, []byte, error) {
+	if ttsServiceURL == "" {
+		return "", nil, fmt.Errorf("TTS service URL not configured")
+	}
+
+	filePath, err := audio.NewMediaFile(fmt.Sprintf("speech-%d.wav", time.Now().UnixNano()))
+	if err != nil {
+		return "", nil, err
+	}
+
+	reqBody, _ := json.Marshal(map[string]string{
+		"text":        text,
+		"output_path": filePath,
+	})
+
+	resp, err := http.Post(ttsServiceURL+"/generate", "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to call TTS service: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("TTS service returned status %d", resp.StatusCode)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read TTS response: %w", err)
+	}
+
+	// The TTS service either writes to output_path and answers with JSON, or returns the audio directly
+	var respData map[string]string
+	if json.Unmarshal(bodyBytes, &respData) == nil && respData["file_path"] != "" {
+		return respData["file_path"], nil, nil
+	}
+	return "", bodyBytes, nil
+}
+
+// speechStreamIdleTimeout releases the synthesis worker of a stream that stops getting updates without being completed
+const speechStreamIdleTimeout = 2 * time.Minute
+
+// speechStream incrementally speaks the text of a StreamSession as sentences complete.
+// Sentences are synthesized while earlier ones play, so audio starts while the LLM is still writing.
+type speechStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{} // Signals the worker that sentences were queued or the stream closed
+
+	mu      sync.Mutex
+	pending []string // Sentences waiting for synthesis; unbounded so a long reply never loses text
+	closed  bool
+
+	offset int // Byte offset into the session content that has already been queued; only used by feed
+}
+
+// newSpeechStream starts the synthesis worker for a stream spoken in a guild's voice channel.
+// The worker is bound to the mixer's current voice context, so a barge-in cancels the rest of the stream.
+func newSpeechStream(guildID, messageID string) *speechStream {
+	parent := context.Background()
+	if mixer := audio.GetMixer(guildID); mixer != nil {
+		parent = mixer.GetVoiceContext()
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	ss := &speechStream{
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+	}
+	go ss.run(guildID, messageID)
+	return ss
+}
+
+// run synthesizes queued sentences in order. Clips go through the shared playback queue so they stay
+// in order with other speech. It returns once the stream is closed and drained, on a barge-in, or
+// when no update has arrived for speechStreamIdleTimeout.
+func (ss *speechStream) run(guildID, messageID string) {
+	defer ss.cancel()
+	idle := time.NewTimer(speechStreamIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		sentence, ok, closed := ss.next()
+		if !ok {
+			if closed {
+				return
+			}
+			select {
+			case <-ss.wake:
+				idle.Reset(speechStreamIdleTimeout)
+				continue
+			case <-ss.ctx.Done():
+				return
+			case <-idle.C:
+				log.Printf("Stream %s: no updates for %v, abandoning speech", messageID, speechStreamIdleTimeout)
+				return
+			}
+		}
+
+		filePath, data, err := SynthesizeSpeech(sentence)
+		if err != nil {
+			log.Printf("Stream %s: speech synthesis failed: %v", messageID, err)
+			continue
+		}
+		if ss.ctx.Err() != nil {
+			log.Printf("Stream %s: speech interrupted (Barge-In). Dropping the rest of the stream.", messageID)
+			removeTempAudio(filePath)
+			return
+		}
+		EnqueuePlayback(guildID, "stream", messageID, sentence, filePath, data)
+	}
+}
+
+// next takes the oldest queued sentence. ok is false if there is none; closed then reports that none will follow.
+func (ss *speechStream) next() (sentence string, ok, closed bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.pending) == 0 {
+		return "", false, ss.closed
+	}
+	sentence = ss.pending[0]
+	ss.pending = ss.pending[1:]
+	return sentence, true, false
+}
+
+// signal wakes the worker without blocking
+func (ss *speechStream) signal() {
+	select {
+	case ss.wake <- struct{}{}:
+	default:
+	}
+}
+
+// feed queues every sentence of content completed since the last call.
+// When final is true, any trailing partial sentence is queued and the stream is closed.
+func (ss *speechStream) feed(content string, final bool) {
+	ss.mu.Lock()
+	closed := ss.closed
+	ss.mu.Unlock()
+	if closed {
+		return
+	}
+	if ss.offset > len(content) {
+		// Content was rewritten shorter than what we already spoke; nothing sensible to add
+		ss.offset = len(content)
+	}
+
+	pending := content[ss.offset:]
+	for {
+		end := sentenceEnd(pending)
+		if end < 0 {
+			break
+		}
+		ss.queue(pending[:end])
+		ss.offset += end
+		pending = pending[end:]
+	}
+
+	if final {
+		ss.queue(pending)
+		ss.offset = len(content)
+		ss.mu.Lock()
+		ss.closed = true
+		ss.mu.Unlock()
+		ss.signal()
+	}
+}
+
+func (ss *speechStream) queue(text string) {
+	text = cleanTextForSpeech(text)
+	if text == "" || ss.ctx.Err() != nil {
+		return
+	}
+	ss.mu.Lock()
+	ss.pending = append(ss.pending, text)
+	ss.mu.Unlock()
+	ss.signal()
+}
+
+// sentenceEnd returns the byte index just past the first complete sentence in s, or -1.
+// A sentence is complete once a terminator is followed by whitespace, or at a newline.
+func sentenceEnd(s string) int {
+	runes := []rune(s)
+	pos := 0
+	for i, r := range runes {
+		pos += len(string(r))
+		switch r {
+		case '\n':
+			return pos
+		case '.', '!', '?', ':', ';':
+			if i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+				// Avoid splitting on common abbreviations like "e.g. " and initials like "J. Smith"
+				if r == '.' && i > 0 && isAbbreviation(runes[:i], runes[i+1:]) {
+					continue
+				}
+				return pos
+			}
+		}
+	}
+	return -1
+}
+
+// isAbbreviation reports whether the word before a full stop is an abbreviation rather than the end of
+// a sentence. A single capital letter only counts as an initial when a capitalised name follows it and
+// it starts a sentence or follows a capitalised word (or another initial), so "plan B. Then" still splits.
+func isAbbreviation(before, after []rune) bool {
+	start := len(before)
+	for start > 0 && !unicode.IsSpace(before[start-1]) {
+		start--
+	}
+	word := []rune(strings.ToLower(string(before[start:])))
+	switch string(word) {
+	case "mr", "mrs", "ms", "dr", "st", "vs", "etc", "e.g", "i.e":
+		return true
+	}
+	if len(word) != 1 || !unicode.IsUpper(before[start]) {
+		return false
+	}
+
+	next := strings.TrimLeftFunc(string(after), unicode.IsSpace)
+	if first, _ := utf8.DecodeRuneInString(next); !unicode.IsUpper(first) {
+		return false
+	}
+	previous := strings.Fields(string(before[:start]))
+	if len(previous) == 0 {
+		return true
+	}
+	prev := []rune(previous[len(previous)-1])
+	return unicode.IsUpper(prev[0]) || strings.ContainsRune(".!?:;", prev[len(prev)-1])
+}
+
+// cleanTextForSpeech strips markdown and Discord markup that should not be read aloud.
+func cleanTextForSpeech(text string) string {
+	text = discordMarkupPattern.ReplaceAllString(text, "")
+	replacer := strings.NewReplacer("**", "", "__", "", "~~", "", "`", "", "*", "", "#", "", ">", "")
+	text = replacer.Replace(text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	// Skip fragments with nothing pronounceable (e.g. a lone bullet or emoji code)
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return text
+		}
+	}
+	return ""
+}
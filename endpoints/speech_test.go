@@ -0,0 +1,89 @@
+package endpoints
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSentenceEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // The first sentence, or "" if none is complete
+	}{
+		{"full stop", "Hello there. How are you", "Hello there."},
+		{"question", "Ready? Go", "Ready?"},
+		{"newline", "A list\n- item", "A list\n"},
+		{"incomplete", "Still writing.", ""},
+		{"decimal", "It costs 3.50 dollars. Cheap", "It costs 3.50 dollars."},
+		{"title", "Ask Dr. Smith today. Then", "Ask Dr. Smith today."},
+		{"e.g.", "Fruit, e.g. apples. More", "Fruit, e.g. apples."},
+		{"initial", "John F. Kennedy spoke. Then", "John F. Kennedy spoke."},
+		{"initials", "J. R. R. Tolkien wrote it. Then", "J. R. R. Tolkien wrote it."},
+		{"single letter ends sentence", "We go with plan B. Then we wait", "We go with plan B."},
+		{"lowercase letter", "Press x. Now", "Press x."},
+		{"letter before lowercase word", "Ask Mr B. he knows", "Ask Mr B."},
+	}
+	for _, tt := range tests {
+		end := sentenceEnd(tt.in)
+		got := ""
+		if end >= 0 {
+			got = tt.in[:end]
+		}
+		if got != tt.want {
+			t.Errorf("%s: sentenceEnd(%q) gave %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCleanTextForSpeech(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"**Bold** and _plain_", "Bold and _plain_"},
+		{"Hi <@123456>, see <#987654>", "Hi , see"},
+		{"<a:typing:1449387367315275786>", ""},
+		{"`code`   spaced\n\nout", "code spaced out"},
+		{"> quoted ~~struck~~", "quoted struck"},
+		{"- ", ""},
+		{"## 2 items", "2 items"},
+	}
+	for _, tt := range tests {
+		if got := cleanTextForSpeech(tt.in); got != tt.want {
+			t.Errorf("cleanTextForSpeech(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSpeechStreamKeepsLongReplies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// No worker runs, so every sentence stays queued
+	ss := &speechStream{ctx: ctx, cancel: cancel, wake: make(chan struct{}, 1)}
+
+	content := ""
+	for i := 0; i < 100; i++ {
+		content += "This is one more sentence. "
+		ss.feed(content, false)
+	}
+	ss.feed(content+"And the last", true)
+
+	if len(ss.pending) != 101 {
+		t.Fatalf("queued %d sentences, want 101", len(ss.pending))
+	}
+	if _, ok, _ := ss.next(); !ok {
+		t.Fatal("nothing to take from the queue")
+	}
+	ss.pending = nil
+	if _, ok, closed := ss.next(); ok || !closed {
+		t.Errorf("drained stream: ok=%v closed=%v, want closed", ok, closed)
+	}
+
+	// A barge-in stops anything more being queued
+	cancel()
+	ss.closed = false
+	ss.feed(content+"More. ", false)
+	if len(ss.pending) != 0 {
+		t.Errorf("queued %d sentences after the barge-in", len(ss.pending))
+	}
+}
@@ -0,0 +1,51 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+)
+
+// voiceSessionDebug is one guild's receive-side state
+type voiceSessionDebug struct {
+	GuildID          string                  `json:"guild_id"`
+	ChannelID        string                  `json:"channel_id"`       // Channel the voice connection is in
+	RecorderChannel  string                  `json:"recorder_channel"` // Channel whose SSRCs are decoded
+	SSRCs            []audio.SSRCMapping     `json:"ssrcs"`
+	ActiveRecordings []audio.ActiveRecording `json:"active_recordings"`
+}
+
+// VoiceSSRCHandler shows each voice session's SSRC mappings and active recordings, for debugging
+// audio attributed to the wrong speaker (GET /voice/ssrc, optionally ?guild_id=)
+func VoiceSSRCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	guildID := guildIDFromRequest(r)
+	sessions := make([]voiceSessionDebug, 0)
+	for _, session := range audio.Sessions() {
+		if guildID != "" && session.GuildID != guildID {
+			continue
+		}
+		debug := voiceSessionDebug{
+			GuildID:          session.GuildID,
+			ChannelID:        session.ChannelID(),
+			SSRCs:            []audio.SSRCMapping{},
+			ActiveRecordings: []audio.ActiveRecording{},
+		}
+		if recorder := session.Recorder(); recorder != nil {
+			debug.RecorderChannel = recorder.CurrentChannel()
+			debug.SSRCs = recorder.SSRCMappings()
+			debug.ActiveRecordings = recorder.ActiveRecordings()
+		}
+		sessions = append(sessions, debug)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+	})
+}
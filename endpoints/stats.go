@@ -0,0 +1,81 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+)
+
+// VoiceStatsHandler returns talk-time statistics (GET /voice/stats).
+// With ?user_id= it returns that user's totals; otherwise the totals and speakers of ?channel_id=,
+// defaulting to Dexter's current voice channel in the guild.
+func VoiceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if redisClient == nil {
+		http.Error(w, "Redis not available", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := context.Background()
+	query := r.URL.Query()
+
+	if userID := query.Get("user_id"); userID != "" {
+		stats, err := audio.GetUserTalkStats(ctx, redisClient, userID)
+		if err != nil {
+			log.Printf("Error reading talk stats for user %s: %v", userID, err)
+			http.Error(w, "Failed to read stats", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id": userID,
+			"stats":   stats,
+		})
+		return
+	}
+
+	channelID := query.Get("channel_id")
+	guildID := resolveGuildID(guildIDFromRequest(r))
+	if channelID == "" {
+		if session := audio.GetSession(guildID); session != nil {
+			channelID = session.ChannelID()
+		}
+	}
+	if channelID == "" {
+		http.Error(w, "channel_id is required when not in voice", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := audio.GetChannelTalkStats(ctx, redisClient, channelID)
+	if err != nil {
+		log.Printf("Error reading talk stats for channel %s: %v", channelID, err)
+		http.Error(w, "Failed to read stats", http.StatusInternalServerError)
+		return
+	}
+
+	// Names make the ranking usable without another lookup
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+	if guildID == "" {
+		guildID = guildForChannel(channelID)
+	}
+	names := make(map[string]string, len(stats.Speakers))
+	if dg != nil {
+		for _, speaker := range stats.Speakers {
+			names[speaker.UserID] = utils.GetUserDisplayName(dg, redisClient, guildID, speaker.UserID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"channel":    stats,
+		"user_names": names,
+	})
+}
@@ -14,6 +14,7 @@ import (
 type StartStreamRequest struct {
 	ChannelID      string `json:"channel_id"`
 	InitialContent string `json:"initial_content,omitempty"`
+	Speak          bool   `json:"speak,omitempty"` // Speak completed sentences in voice as they stream in
 }
 
 // StartStreamResponse represents the response when a stream starts
@@ -36,6 +37,7 @@ type StreamSession struct {
 	LastSentChunks []string // Content of each message last sent
 	LastEdit       time.Time
 	Done           bool
+	Speech         *speechStream // Non-nil when the stream is also spoken in voice
 }
 
 type StreamManager struct {
@@ -229,8 +231,7 @@ func StartStreamHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Register with StreamManager immediately to ensure it's tracked
-	streamManager.mu.Lock()
-	streamManager.streams[msg.ID] = &StreamSession{
+	session := &StreamSession{
 		ChannelID:      req.ChannelID,
 		MessageID:      msg.ID,
 		MessageIDs:     []string{msg.ID},
@@ -239,6 +240,12 @@ func StartStreamHandler(w http.ResponseWriter, r *http.Request) {
 		LastEdit:       time.Now(),
 		Done:           false,
 	}
+	if req.Speak {
+		// The initial content is a placeholder status, so speech starts from the first update
+		session.Speech = newSpeechStream(resolveGuildID(guildForChannel(req.ChannelID)), msg.ID)
+	}
+	streamManager.mu.Lock()
+	streamManager.streams[msg.ID] = session
 	streamManager.mu.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -270,6 +277,9 @@ func UpdateStreamHandler(w http.ResponseWriter, r *http.Request) {
 	if session, ok := streamManager.streams[req.MessageID]; ok {
 		if !session.Done {
 			session.CurrentContent = req.Content
+			if session.Speech != nil {
+				session.Speech.feed(req.Content, false)
+			}
 		}
 	}
 	streamManager.mu.Unlock()
@@ -302,6 +312,9 @@ func CompleteStreamHandler(w http.ResponseWriter, r *http.Request) {
 		if req.Content != "" {
 			session.CurrentContent = req.Content
 		}
+		if session.Speech != nil && !session.Done {
+			session.Speech.feed(session.CurrentContent, true)
+		}
 		session.Done = true
 		finalMessageID = session.MessageID // Return the ID of the first message in the chain
 	} else {
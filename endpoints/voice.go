@@ -2,17 +2,77 @@ package endpoints
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/utils"
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	errNotInVoice         = errors.New("not in a voice channel in this guild")
+	errNoSessionRecording = errors.New("no session recording is running")
 )
 
+var (
+	joinVoice  func(guildID, channelID string) (*discordgo.VoiceConnection, error)
+	leaveVoice func(guildID string) error
+)
+
+// SetVoiceControls registers the core functions that join/move and leave voice channels
+func SetVoiceControls(join func(guildID, channelID string) (*discordgo.VoiceConnection, error), leave func(guildID string) error) {
+	joinVoice = join
+	leaveVoice = leave
+}
+
+// guildIDFromRequest reads the target guild from the guild_id query parameter or X-Guild-ID header
+func guildIDFromRequest(r *http.Request) string {
+	if guildID := r.URL.Query().Get("guild_id"); guildID != "" {
+		return guildID
+	}
+	return r.Header.Get("X-Guild-ID")
+}
+
+// resolveGuildID falls back to the only active voice session when no guild is given.
+// It returns "" if the guild is ambiguous.
+func resolveGuildID(guildID string) string {
+	if guildID != "" {
+		return guildID
+	}
+	if sessions := audio.Sessions(); len(sessions) == 1 {
+		return sessions[0].GuildID
+	}
+	return ""
+}
+
+// guildForChannel returns the guild a channel belongs to, or ""
+func guildForChannel(channelID string) string {
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+
+	if dg == nil || channelID == "" {
+		return ""
+	}
+	if channel, err := dg.State.Channel(channelID); err == nil {
+		return channel.GuildID
+	}
+	if channel, err := dg.Channel(channelID); err == nil {
+		return channel.GuildID
+	}
+	return ""
+}
+
 type VoiceStateRequest struct {
-	Mute   bool   `json:"mute"`
-	Deaf   bool   `json:"deaf"`
-	Reason string `json:"reason"`
+	GuildID string `json:"guild_id"`
+	Mute    bool   `json:"mute"`
+	Deaf    bool   `json:"deaf"`
+	Reason  string `json:"reason"`
 }
 
-// VoiceStateHandler updates the bot's voice state (mute/deaf) in the current guild
+// VoiceStateHandler updates the bot's voice state (mute/deaf) in a guild
 func VoiceStateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -23,29 +83,32 @@ func VoiceStateHandler(w http.ResponseWriter, r *http.Request) {
 	dg := discordSession
 	sessionMutex.RUnlock()
 
-	vc := GetActiveVoiceConnection()
-
 	if dg == nil {
 		http.Error(w, "Discord session not initialized", http.StatusServiceUnavailable)
 		return
 	}
 
+	var req VoiceStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	guildID, channelID := resolveGuildID(req.GuildID), ""
+	if session := audio.GetSession(guildID); session != nil {
+		channelID = session.ChannelID()
+	}
+
 	// We can only update voice state if we are connected to a voice channel
-	if vc == nil {
+	if channelID == "" {
 		// Log warning but return OK to avoid breaking callers who expect success if bot is just offline
 		log.Printf("Warning: Voice state update requested but no active voice connection.")
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	var req VoiceStateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
 	// ChannelVoiceJoin handles state updates (mute/deaf) if already in channel
-	_, err := dg.ChannelVoiceJoin(vc.GuildID, vc.ChannelID, req.Mute, req.Deaf)
+	_, err := dg.ChannelVoiceJoin(guildID, channelID, req.Mute, req.Deaf)
 	if err != nil {
 		log.Printf("Error updating voice state (Mute: %v, Deaf: %v): %v", req.Mute, req.Deaf, err)
 		http.Error(w, "Failed to update voice state", http.StatusInternalServerError)
@@ -59,3 +122,112 @@ func VoiceStateHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s: Mute=%v, Deaf=%v", logMsg, req.Mute, req.Deaf)
 	w.WriteHeader(http.StatusOK)
 }
+
+// VoiceChannelRequest is the body of the join, move and leave endpoints
+type VoiceChannelRequest struct {
+	GuildID string `json:"guild_id"`
+	Channel string `json:"channel"` // Voice channel ID, mention or name
+}
+
+// VoiceJoinHandler joins a voice channel in a guild Dexter is not yet in voice in (POST /voice/join)
+func VoiceJoinHandler(w http.ResponseWriter, r *http.Request) {
+	handleVoiceChannelChange(w, r, false)
+}
+
+// VoiceMoveHandler moves Dexter to another voice channel in the same guild (POST /voice/move)
+func VoiceMoveHandler(w http.ResponseWriter, r *http.Request) {
+	handleVoiceChannelChange(w, r, true)
+}
+
+func handleVoiceChannelChange(w http.ResponseWriter, r *http.Request, move bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionMutex.RLock()
+	dg := discordSession
+	sessionMutex.RUnlock()
+
+	if dg == nil || joinVoice == nil {
+		http.Error(w, "Discord session not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req VoiceChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Channel == "" {
+		http.Error(w, "channel is required", http.StatusBadRequest)
+		return
+	}
+
+	channel, err := utils.ResolveVoiceChannel(dg, req.GuildID, req.Channel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var current string
+	if session := audio.GetSession(channel.GuildID); session != nil {
+		current = session.ChannelID()
+	}
+	if move && current == "" {
+		http.Error(w, "Not in a voice channel in this guild; use /voice/join", http.StatusConflict)
+		return
+	}
+	if !move && current != "" && current != channel.ID {
+		http.Error(w, "Already in a voice channel in this guild; use /voice/move", http.StatusConflict)
+		return
+	}
+
+	vc, err := joinVoice(channel.GuildID, channel.ID)
+	if err != nil {
+		log.Printf("Error joining voice channel %s: %v", channel.ID, err)
+		http.Error(w, "Failed to join voice channel", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"guild_id":     vc.GuildID,
+		"channel_id":   vc.ChannelID,
+		"channel_name": channel.Name,
+	})
+}
+
+// VoiceLeaveHandler disconnects Dexter from voice in a guild (POST /voice/leave)
+func VoiceLeaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if leaveVoice == nil {
+		http.Error(w, "Discord session not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req VoiceChannelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GuildID == "" {
+		req.GuildID = guildIDFromRequest(r)
+	}
+
+	guildID := resolveGuildID(req.GuildID)
+	if guildID == "" {
+		http.Error(w, "guild_id is required", http.StatusBadRequest)
+		return
+	}
+	if err := leaveVoice(guildID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -47,7 +47,10 @@ func main() {
 			fmt.Println("Usage:")
 			fmt.Println("  dex-discord-service              Start the discord service")
 			fmt.Println("  dex-discord-service version      Display version information")
+			fmt.Println("  dex-discord-service vad <file>   Run voice activity detection on a WAV file")
 			os.Exit(0)
+		case "vad":
+			os.Exit(runVADCommand(os.Args[2:]))
 		}
 	}
 
@@ -123,6 +126,81 @@ func main() {
 	// Initialize Stream Manager
 	endpoints.InitStreamManager()
 
+	// Initialize Voice Playback Queue
+	endpoints.InitPlaybackQueue()
+
+	// Apply voice activity detection settings (service-wide and per guild)
+	vadGuilds := make(map[string]audio.VADConfig)
+	for guildID, settings := range discordOpts.VoiceActivity.Guilds {
+		vadGuilds[guildID] = audio.VADConfig(settings)
+	}
+	audio.ConfigureVAD(audio.VADConfig(discordOpts.VoiceActivity.VADSettings), vadGuilds)
+	audio.ConfigureEcho(audio.EchoConfig(discordOpts.EchoCancellation))
+	streamingSTT = discordOpts.StreamingSTT
+	if err := audio.ConfigureCapture(audio.CaptureConfig(discordOpts.Capture)); err != nil {
+		log.Printf("Invalid capture settings, using defaults: %v", err)
+	}
+	if err := audio.ConfigureListening(audio.ListeningConfig(discordOpts.Listening)); err != nil {
+		log.Printf("Invalid listening settings, using defaults: %v", err)
+	}
+	utils.SetListeningMode(string(audio.GetListeningMode()))
+	audio.ConfigureTranscriptFilter(audio.TranscriptFilterConfig(discordOpts.TranscriptFilter))
+	endpoints.ConfigureCaptions(discordOpts.Captions)
+	endpoints.ConfigureReader(endpoints.ReaderConfig(discordOpts.Reader))
+	// Session recordings are kept for retention_days (default 30; negative keeps them forever)
+	retentionDays := discordOpts.SessionRecording.RetentionDays
+	if retentionDays == 0 {
+		retentionDays = 30
+	}
+	audio.ConfigureSessionRecordings(discordOpts.SessionRecording.Dir, time.Duration(retentionDays)*24*time.Hour)
+	// Transient audio is capped at max_mb (default 512) and max_age_minutes (default 60); negative disables a quota
+	mediaMaxMB := discordOpts.MediaStore.MaxMB
+	if mediaMaxMB == 0 {
+		mediaMaxMB = 512
+	}
+	mediaMaxAge := discordOpts.MediaStore.MaxAgeMinutes
+	if mediaMaxAge == 0 {
+		mediaMaxAge = 60
+	}
+	audio.ConfigureMediaStore(discordOpts.MediaStore.Dir, int64(max(mediaMaxMB, 0))<<20, time.Duration(max(mediaMaxAge, 0))*time.Minute)
+	audio.ConfigureSoundboard(discordOpts.SoundboardDir)
+	utils.AddMetricsSource(func() map[string]interface{} {
+		mixer := audio.GetMixerTotals()
+		return map[string]interface{}{
+			"mixer_underruns":   mixer.Underruns,
+			"mixer_overruns":    mixer.Overruns,
+			"mixer_late_frames": mixer.LateFrames,
+			"mixer_resyncs":     mixer.Resyncs,
+		}
+	})
+	utils.AddMetricsSource(func() map[string]interface{} {
+		byUser := audio.GetPacketLoss()
+		var lost, concealed int64
+		for _, stats := range byUser {
+			lost += stats.Lost
+			concealed += stats.Concealed
+		}
+		return map[string]interface{}{
+			"voice_packets_lost":      lost,
+			"voice_packets_concealed": concealed,
+			"voice_packet_loss":       byUser,
+		}
+	})
+	go func() {
+		// Decode the soundboard up front so the first play is instant
+		clips, err := audio.RefreshSoundboard()
+		if err != nil {
+			log.Printf("Soundboard: %v", err)
+			return
+		}
+		log.Printf("Soundboard: %d clip(s) loaded from %s", len(clips), audio.SoundboardDir())
+	}()
+	voicePresence = discordOpts.VoicePresence
+	announceRecording = discordOpts.AnnounceRecording
+	if voicePresence.FollowUser == "master" {
+		voicePresence.FollowUser = discordOpts.MasterUser
+	}
+
 	// Start the core event logic in a goroutine
 	go func() {
 		log.Println("Core Logic: Starting...")
@@ -195,15 +273,55 @@ func main() {
 	// /voice/state endpoint is protected by auth middleware
 	mux.HandleFunc("/voice/state", middleware.ServiceAuthMiddleware(endpoints.VoiceStateHandler))
 
+	// /voice/join, /voice/move and /voice/leave endpoints are protected by auth middleware
+	mux.HandleFunc("/voice/join", middleware.ServiceAuthMiddleware(endpoints.VoiceJoinHandler))
+	mux.HandleFunc("/voice/move", middleware.ServiceAuthMiddleware(endpoints.VoiceMoveHandler))
+	mux.HandleFunc("/voice/leave", middleware.ServiceAuthMiddleware(endpoints.VoiceLeaveHandler))
+
+	// /voice/recording/ endpoints are protected by auth middleware (start/stop multi-track session recordings)
+	mux.HandleFunc("/voice/recording/", middleware.ServiceAuthMiddleware(endpoints.SessionRecordingHandler))
+
+	// /voice/stats endpoint is protected by auth middleware (talk time, overlaps and interruptions)
+	mux.HandleFunc("/voice/stats", middleware.ServiceAuthMiddleware(endpoints.VoiceStatsHandler))
+
+	// /voice/ssrc endpoint is protected by auth middleware (SSRC mappings and active recordings, for debugging)
+	mux.HandleFunc("/voice/ssrc", middleware.ServiceAuthMiddleware(endpoints.VoiceSSRCHandler))
+
+	// /voice/captions/ endpoint is protected by auth middleware (where a voice channel's live captions are posted)
+	mux.HandleFunc("/voice/captions/", middleware.ServiceAuthMiddleware(endpoints.CaptionsHandler))
+
+	// /voice/consent/ endpoint is protected by auth middleware (per-user recording opt-out)
+	mux.HandleFunc("/voice/consent/", middleware.ServiceAuthMiddleware(endpoints.VoiceConsentHandler))
+
+	// /recordings endpoints are protected by auth middleware (list, manifest and download of session recordings)
+	mux.HandleFunc("/recordings", middleware.ServiceAuthMiddleware(endpoints.RecordingsHandler))
+	mux.HandleFunc("/recordings/", middleware.ServiceAuthMiddleware(endpoints.RecordingsHandler))
+
 	// /audio endpoint is public (for fetching recordings)
 	mux.HandleFunc("/audio/", endpoints.AudioHandler)
 
-	// /audio/play endpoint is protected by auth middleware (for streaming TTS)
+	// /audio/play endpoint is protected by auth middleware (queues TTS audio, returns a playback ID)
 	mux.HandleFunc("/audio/play", middleware.ServiceAuthMiddleware(endpoints.PlayAudioHandler))
 
+	// /audio/playback/ endpoint is protected by auth middleware (status of queued voice clips)
+	mux.HandleFunc("/audio/playback/", middleware.ServiceAuthMiddleware(endpoints.PlaybackStatusHandler))
+
 	// /audio/play_music endpoint is protected by auth middleware (for playing YouTube links)
 	mux.HandleFunc("/audio/play_music", middleware.ServiceAuthMiddleware(endpoints.PlayMusicHandler))
 
+	// /audio/volume endpoint is protected by auth middleware (per-channel gain & ducking)
+	mux.HandleFunc("/audio/volume", middleware.ServiceAuthMiddleware(endpoints.VolumeHandler))
+
+	// /audio/queue endpoint is protected by auth middleware (now playing & upcoming tracks)
+	mux.HandleFunc("/audio/queue", middleware.ServiceAuthMiddleware(endpoints.MusicQueueHandler))
+
+	// /audio/music/ endpoints are protected by auth middleware (skip, pause, resume, stop, seek, loop, shuffle)
+	mux.HandleFunc("/audio/music/", middleware.ServiceAuthMiddleware(endpoints.MusicControlHandler))
+
+	// /audio/sfx endpoints are protected by auth middleware (list and play soundboard clips)
+	mux.HandleFunc("/audio/sfx", middleware.ServiceAuthMiddleware(endpoints.SoundboardHandler))
+	mux.HandleFunc("/audio/sfx/", middleware.ServiceAuthMiddleware(endpoints.SoundboardHandler))
+
 	// Determine Binding Address
 	bindAddr := network.GetBestBindingAddress()
 	addr := fmt.Sprintf("%s:%d", bindAddr, port)
@@ -246,3 +364,31 @@ func main() {
 
 	log.Println("Service exited cleanly")
 }
+
+// runVADCommand prints the utterances the recorder would capture from a WAV file, using the
+// default VAD settings. Used to tune thresholds offline against recorded fixtures.
+func runVADCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: dex-discord-service vad <file.wav>")
+		return 1
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", args[0], err)
+		return 1
+	}
+
+	pcm, err := audio.DecodeWAV(data)
+	if err != nil {
+		fmt.Printf("Error decoding %s: %v\n", args[0], err)
+		return 1
+	}
+
+	segments := audio.DetectSpeech(pcm, audio.DefaultVADConfig())
+	for i, seg := range segments {
+		fmt.Printf("%d: %.2fs - %.2fs\n", i+1, float64(seg.StartMs)/1000, float64(seg.EndMs)/1000)
+	}
+	fmt.Printf("%d utterance(s) in %.2fs of audio\n", len(segments), float64(len(pcm)/audio.Channels)/audio.SampleRate)
+	return 0
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/EasterCompany/dex-discord-service/audio"
+	"github.com/EasterCompany/dex-discord-service/config"
+	"github.com/EasterCompany/dex-discord-service/endpoints"
+	"github.com/EasterCompany/dex-discord-service/utils"
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultAutoJoinMinHumans is how many people must gather in an allowlisted channel before Dexter joins
+const defaultAutoJoinMinHumans = 2
+
+var voicePresence config.VoicePresenceOptions
+
+var (
+	aloneTimersMu sync.Mutex
+	aloneTimers   = make(map[string]*time.Timer) // guildID -> pending leave
+)
+
+// applyVoicePresence runs the follow-me, auto-join and leave-when-alone policies after a user's voice state changes.
+func applyVoicePresence(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	guildID := v.GuildID
+	current := ""
+	if session := audio.GetSession(guildID); session != nil {
+		current = session.ChannelID()
+	}
+
+	switch {
+	case v.ChannelID == "" || v.ChannelID == current:
+		// Left voice or no move needed
+
+	case voicePresence.FollowUser != "" && v.UserID == voicePresence.FollowUser:
+		details := fmt.Sprintf("Following %s into %s", utils.GetUserDisplayName(s, redisClient, guildID, v.UserID), voiceChannelName(s, v.ChannelID))
+		log.Printf("Voice Presence: %s", details)
+		if _, err := joinOrMoveToVoiceChannel(s, guildID, v.ChannelID, utils.VoiceMoveFollow, details); err != nil {
+			log.Printf("Voice Presence: Failed to follow into %s: %v", v.ChannelID, err)
+		}
+		return
+
+	case shouldAutoJoin(s, guildID, v.ChannelID, current):
+		details := fmt.Sprintf("%d people gathered in %s", countHumansInChannel(s, guildID, v.ChannelID), voiceChannelName(s, v.ChannelID))
+		log.Printf("Voice Presence: %s", details)
+		if _, err := joinOrMoveToVoiceChannel(s, guildID, v.ChannelID, utils.VoiceMoveAutoJoin, details); err != nil {
+			log.Printf("Voice Presence: Failed to auto-join %s: %v", v.ChannelID, err)
+		}
+		return
+	}
+
+	checkAlone(s, guildID)
+}
+
+// shouldAutoJoin reports whether Dexter should go to an allowlisted channel. It never walks away from
+// people it is already with, and following a user takes precedence.
+func shouldAutoJoin(s *discordgo.Session, guildID, channelID, current string) bool {
+	allowed := false
+	for _, id := range voicePresence.AutoJoinChannels {
+		if id == channelID {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	if current != "" && countHumansInChannel(s, guildID, current) > 0 {
+		return false
+	}
+	if voicePresence.FollowUser != "" {
+		if vs, err := s.State.VoiceState(guildID, voicePresence.FollowUser); err == nil && vs.ChannelID != "" {
+			return false
+		}
+	}
+
+	minHumans := voicePresence.AutoJoinMinHumans
+	if minHumans <= 0 {
+		minHumans = defaultAutoJoinMinHumans
+	}
+	return countHumansInChannel(s, guildID, channelID) >= minHumans
+}
+
+// checkAlone starts the leave timer when Dexter is alone in a guild's voice channel and cancels it once someone is back.
+func checkAlone(s *discordgo.Session, guildID string) {
+	if voicePresence.LeaveAfterAloneSeconds <= 0 {
+		return
+	}
+
+	session := audio.GetSession(guildID)
+	channelID := ""
+	if session != nil {
+		channelID = session.ChannelID()
+	}
+	if channelID == "" || countHumansInChannel(s, guildID, channelID) > 0 {
+		cancelAloneTimer(guildID)
+		return
+	}
+
+	aloneTimersMu.Lock()
+	defer aloneTimersMu.Unlock()
+	if _, pending := aloneTimers[guildID]; pending {
+		return
+	}
+
+	wait := time.Duration(voicePresence.LeaveAfterAloneSeconds) * time.Second
+	log.Printf("Voice Presence: Alone in %s, leaving in %s unless someone joins", channelID, wait)
+	aloneTimers[guildID] = time.AfterFunc(wait, func() {
+		aloneTimersMu.Lock()
+		delete(aloneTimers, guildID)
+		aloneTimersMu.Unlock()
+
+		// Re-check: someone may have joined or Dexter may have moved in the meantime
+		session := audio.GetSession(guildID)
+		if session == nil || session.ChannelID() != channelID || countHumansInChannel(s, guildID, channelID) > 0 {
+			return
+		}
+		details := fmt.Sprintf("Alone in %s for %s", voiceChannelName(s, channelID), wait)
+		log.Printf("Voice Presence: %s", details)
+		if err := leaveVoiceChannel(s, guildID, utils.VoiceMoveAlone, details); err != nil {
+			log.Printf("Voice Presence: Failed to leave %s: %v", channelID, err)
+		}
+	})
+}
+
+// cancelAloneTimer stops a pending leave-when-alone timer for a guild.
+func cancelAloneTimer(guildID string) {
+	aloneTimersMu.Lock()
+	defer aloneTimersMu.Unlock()
+	if timer, ok := aloneTimers[guildID]; ok {
+		timer.Stop()
+		delete(aloneTimers, guildID)
+	}
+}
+
+// voiceChannelName returns a channel's name for log messages and event details.
+func voiceChannelName(s *discordgo.Session, channelID string) string {
+	if channel, err := s.State.Channel(channelID); err == nil {
+		return channel.Name
+	}
+	return channelID
+}
+
+// recordingAnnounceCooldown stops repeat announcements to someone hopping in and out of a channel
+const recordingAnnounceCooldown = time.Hour
+
+var (
+	announcedMu sync.Mutex
+	announcedAt = make(map[string]time.Time) // userID -> last announcement
+)
+
+// announceRecordingTo tells a person who joined Dexter's channel that voice is recorded and how to opt out.
+func announceRecordingTo(s *discordgo.Session, guildID, userID, channelID string) {
+	session := audio.GetSession(guildID)
+	if !announceRecording || session == nil || session.ChannelID() != channelID || isBotUser(s, guildID, userID) || audio.IsOptedOut(userID) {
+		return
+	}
+
+	announcedMu.Lock()
+	if last, ok := announcedAt[userID]; ok && time.Since(last) < recordingAnnounceCooldown {
+		announcedMu.Unlock()
+		return
+	}
+	announcedAt[userID] = time.Now()
+	announcedMu.Unlock()
+
+	name := utils.GetUserDisplayName(s, redisClient, guildID, userID)
+	text := fmt.Sprintf("Hi %s. Just so you know, I record and transcribe voice in this channel. Type slash opt out if you'd rather I didn't.", name)
+	filePath, audioData, err := endpoints.SynthesizeSpeech(text)
+	if err != nil {
+		log.Printf("Failed to generate recording announcement: %v", err)
+		return
+	}
+	endpoints.EnqueuePlayback(guildID, "announcement", "recording_notice", text, filePath, audioData)
+}
@@ -0,0 +1,43 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// VoiceConsent records whether a user lets Dexter record and transcribe their voice.
+// It is kept under its own key so profile updates cannot overwrite it.
+type VoiceConsent struct {
+	UserID    string `json:"user_id"`
+	OptedOut  bool   `json:"opted_out"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"` // The user themselves, or "api"
+}
+
+func (s *Store) GetVoiceConsent(ctx context.Context, userID string) (*VoiceConsent, error) {
+	key := "user:voice_consent:" + userID
+	data, err := s.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return &VoiceConsent{UserID: userID}, nil // Not set: recording allowed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c VoiceConsent
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *Store) SaveVoiceConsent(ctx context.Context, c *VoiceConsent) error {
+	key := "user:voice_consent:" + c.UserID
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.Redis.Set(ctx, key, data, 0).Err() // No expiration
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SendEvent posts an event to the event service, retrying up to three times.
+func SendEvent(eventData interface{}) error {
+	eventJSON, err := json.Marshal(eventData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	// Log event type for observability
+	var typeFinder struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(eventJSON, &typeFinder)
+	log.Printf("Discord Service: [EVENT] Sending %s (%d bytes)...", typeFinder.Type, len(eventJSON))
+
+	request := map[string]interface{}{"service": "dex-discord-service", "event": json.RawMessage(eventJSON)}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post(eventServiceURL+"/events", "application/json", bytes.NewBuffer(body))
+		if err == nil {
+			defer func() {
+				if err := resp.Body.Close(); err != nil {
+					log.Printf("Error closing response body: %v", err)
+				}
+			}()
+			if resp.StatusCode < 300 {
+				IncrementEventsSent()
+				log.Printf("Discord Service: [SUCCESS] Event %s emitted", typeFinder.Type)
+				return nil
+			}
+
+			// Read response body for error details
+			respBody, _ := io.ReadAll(resp.Body)
+			log.Printf("Discord Service: [ERROR] Failed to send event (Attempt %d/3): Status %d, Body: %s", i+1, resp.StatusCode, string(respBody))
+		} else {
+			log.Printf("Discord Service: [ERROR] Failed to send event (Attempt %d/3): %v", i+1, err)
+		}
+		time.Sleep(time.Duration(i+1) * 2 * time.Second)
+	}
+	return fmt.Errorf("failed to send event after multiple attempts")
+}
@@ -15,9 +15,25 @@ const (
 	EventTypeMessagingUserSpeakingStarted EventType = "messaging.user.speaking.started"
 	EventTypeMessagingUserSpeakingStopped EventType = "messaging.user.speaking.stopped"
 	EventTypeMessagingUserTranscribed     EventType = "messaging.user.transcribed"
+	EventTypeMessagingUserTranscribing    EventType = "messaging.user.transcribing"
 	EventTypeMessagingUserJoinedServer    EventType = "messaging.user.joined_server"
 	EventTypeMessagingBotVoiceResponse    EventType = "messaging.bot.voice_response"
+	EventTypeMessagingBotJoinedVoice      EventType = "messaging.bot.joined_voice"
+	EventTypeMessagingBotLeftVoice        EventType = "messaging.bot.left_voice"
+
+	// Channel-wide session recordings
+	EventTypeMessagingBotRecordingStarted EventType = "messaging.bot.recording.started"
+	EventTypeMessagingBotRecordingStopped EventType = "messaging.bot.recording.stopped"
 	EventTypeMessagingWebhookMessage      EventType = "messaging.webhook.message"
+	EventTypeMessagingBotMusicStarted     EventType = "messaging.bot.music.started"
+	EventTypeMessagingBotMusicEnded       EventType = "messaging.bot.music.ended"
+
+	// Voice playback lifecycle: messaging.bot.playback.{queued,playing,finished,interrupted,failed}
+	EventTypeMessagingBotPlaybackQueued      EventType = "messaging.bot.playback.queued"
+	EventTypeMessagingBotPlaybackPlaying     EventType = "messaging.bot.playback.playing"
+	EventTypeMessagingBotPlaybackFinished    EventType = "messaging.bot.playback.finished"
+	EventTypeMessagingBotPlaybackInterrupted EventType = "messaging.bot.playback.interrupted"
+	EventTypeMessagingBotPlaybackFailed      EventType = "messaging.bot.playback.failed"
 
 	// System Events
 	EventTypeSystemStatusChange EventType = "system.status.change"
@@ -64,6 +80,32 @@ type UserVoiceStateChangeEvent struct {
 	GenericMessagingEvent
 }
 
+// Reasons Dexter joined, moved or left a voice channel
+const (
+	VoiceMoveDefault  = "default_channel"
+	VoiceMoveAPI      = "api"
+	VoiceMoveCommand  = "command"
+	VoiceMoveFollow   = "follow"
+	VoiceMoveAutoJoin = "auto_join"
+	VoiceMoveAlone    = "alone"
+)
+
+// BotVoiceEvent is the payload for Dexter joining, moving or leaving a voice channel
+type BotVoiceEvent struct {
+	GenericMessagingEvent
+	Reason  string `json:"reason"`            // One of the VoiceMove* reasons
+	Details string `json:"details,omitempty"` // Human-readable explanation of the move
+}
+
+// BotRecordingEvent is the payload for a session recording starting or stopping
+type BotRecordingEvent struct {
+	GenericMessagingEvent
+	RecordingID string `json:"recording_id"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	Speakers    int    `json:"speakers,omitempty"`
+	Reason      string `json:"reason,omitempty"` // Why it stopped: requested, moved, left_voice
+}
+
 // UserServerEvent is the payload for server-level user events
 type UserServerEvent struct {
 	GenericMessagingEvent
@@ -81,12 +123,50 @@ type BotStatusUpdateEvent struct {
 // UserSpeakingEvent is for when a user starts or stops speaking
 type UserSpeakingEvent struct {
 	GenericMessagingEvent
-	SSRC uint32 `json:"ssrc"`
+	SSRC              uint32 `json:"ssrc"`
+	DurationMs        int64  `json:"duration_ms,omitempty"`        // Stopped: first word to last, pauses included
+	TalkMs            int64  `json:"talk_ms,omitempty"`            // Stopped: time actually spent talking
+	Overlapping       bool   `json:"overlapping,omitempty"`        // Started: someone else was already talking
+	InterruptedDexter bool   `json:"interrupted_dexter,omitempty"` // Started: Dexter was speaking
 }
 
 // UserTranscribedEvent is for when a user's speech is transcribed
 type UserTranscribedEvent struct {
+	GenericMessagingEvent
+	Transcription string  `json:"transcription"`
+	Content       string  `json:"content"`
+	UtteranceID   string  `json:"utterance_id,omitempty"` // Long speech is transcribed in segments sharing this ID
+	Segment       int     `json:"segment"`                // Position of this segment in the utterance, from 0
+	FinalSegment  bool    `json:"final_segment"`          // No more segments of this utterance follow
+	Language      string  `json:"language,omitempty"`     // Language detected by the STT service
+	Probability   float64 `json:"probability,omitempty"`  // STT confidence, 0-1
+}
+
+// UserTranscribingEvent carries a partial transcript while a user is still speaking (streaming STT)
+type UserTranscribingEvent struct {
 	GenericMessagingEvent
 	Transcription string `json:"transcription"`
-	Content       string `json:"content"`
+	Language      string `json:"language,omitempty"`
+}
+
+// BotMusicEvent is for when a music track starts or ends playing
+type BotMusicEvent struct {
+	GenericMessagingEvent
+	TrackID     string  `json:"track_id"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	Duration    float64 `json:"duration,omitempty"`
+	RequestedBy string  `json:"requested_by,omitempty"`
+	Reason      string  `json:"reason,omitempty"` // Only for ended: finished, skipped, stopped, error
+}
+
+// BotPlaybackEvent is for state changes of a queued voice clip
+type BotPlaybackEvent struct {
+	GenericMessagingEvent
+	PlaybackID string `json:"playback_id"`
+	State      string `json:"state"`
+	Origin     string `json:"origin"` // api, stream, greeting
+	Tag        string `json:"tag,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"sync"
 	"sync/atomic"
 
 	sharedUtils "github.com/EasterCompany/dex-go-utils/utils"
@@ -12,6 +13,21 @@ var (
 	messagesSent      int64
 	eventsSent        int64
 	discordReconnects int64
+
+	mediaFiles      int64
+	mediaBytes      int64
+	mediaReferenced int64
+	mediaPruned     int64
+
+	listeningMode         atomic.Value // string
+	transcriptsSuppressed int64
+	transcriptionsSkipped int64
+
+	droppedMu          sync.Mutex
+	transcriptsDropped = make(map[string]int64) // reason -> count
+
+	sourcesMu     sync.Mutex
+	metricSources []func() map[string]interface{}
 )
 
 // IncrementMessagesReceived atomically increments the messages received counter
@@ -34,16 +50,82 @@ func IncrementReconnects() {
 	atomic.AddInt64(&discordReconnects, 1)
 }
 
+// SetMediaUsage records the media store's usage after a janitor pass; pruned accumulates
+func SetMediaUsage(files int, bytes int64, referenced, pruned int) {
+	atomic.StoreInt64(&mediaFiles, int64(files))
+	atomic.StoreInt64(&mediaBytes, bytes)
+	atomic.StoreInt64(&mediaReferenced, int64(referenced))
+	atomic.AddInt64(&mediaPruned, int64(pruned))
+}
+
+// SetListeningMode records the active listening mode (always, wake_word or push_to_talk)
+func SetListeningMode(mode string) {
+	listeningMode.Store(mode)
+}
+
+// IncrementTranscriptsSuppressed atomically increments the count of transcripts withheld by the listening mode
+func IncrementTranscriptsSuppressed() {
+	atomic.AddInt64(&transcriptsSuppressed, 1)
+}
+
+// IncrementTranscriptionsSkipped atomically increments the count of utterances never sent to STT
+func IncrementTranscriptionsSkipped() {
+	atomic.AddInt64(&transcriptionsSkipped, 1)
+}
+
+// IncrementTranscriptsDropped counts a transcript the filter rejected, by reason
+func IncrementTranscriptsDropped(reason string) {
+	droppedMu.Lock()
+	defer droppedMu.Unlock()
+	transcriptsDropped[reason]++
+}
+
+// AddMetricsSource adds metrics kept elsewhere (such as the audio pipeline's counters) to GetMetrics
+func AddMetricsSource(source func() map[string]interface{}) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	metricSources = append(metricSources, source)
+}
+
 // GetMetrics returns the current metrics as a map
 func GetMetrics() map[string]interface{} {
 	sysMetrics := sharedUtils.GetMetrics()
+	mode, _ := listeningMode.Load().(string)
+
+	droppedMu.Lock()
+	dropped := make(map[string]int64, len(transcriptsDropped))
+	var droppedTotal int64
+	for reason, n := range transcriptsDropped {
+		dropped[reason] = n
+		droppedTotal += n
+	}
+	droppedMu.Unlock()
+
+	metrics := map[string]interface{}{
+		"messages_received":             atomic.LoadInt64(&messagesReceived),
+		"messages_sent":                 atomic.LoadInt64(&messagesSent),
+		"events_sent":                   atomic.LoadInt64(&eventsSent),
+		"discord_reconnects":            atomic.LoadInt64(&discordReconnects),
+		"media_files":                   atomic.LoadInt64(&mediaFiles),
+		"media_bytes":                   atomic.LoadInt64(&mediaBytes),
+		"media_referenced":              atomic.LoadInt64(&mediaReferenced),
+		"media_pruned":                  atomic.LoadInt64(&mediaPruned),
+		"listening_mode":                mode,
+		"transcripts_suppressed":        atomic.LoadInt64(&transcriptsSuppressed),
+		"transcriptions_skipped":        atomic.LoadInt64(&transcriptionsSkipped),
+		"transcripts_dropped":           droppedTotal,
+		"transcripts_dropped_by_reason": dropped,
+		"cpu":                           sysMetrics.CPU,
+		"memory":                        sysMetrics.Memory,
+	}
 
-	return map[string]interface{}{
-		"messages_received":  atomic.LoadInt64(&messagesReceived),
-		"messages_sent":      atomic.LoadInt64(&messagesSent),
-		"events_sent":        atomic.LoadInt64(&eventsSent),
-		"discord_reconnects": atomic.LoadInt64(&discordReconnects),
-		"cpu":                sysMetrics.CPU,
-		"memory":             sysMetrics.Memory,
+	sourcesMu.Lock()
+	sources := metricSources
+	sourcesMu.Unlock()
+	for _, source := range sources {
+		for name, value := range source() {
+			metrics[name] = value
+		}
 	}
+	return metrics
 }
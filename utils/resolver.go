@@ -2,8 +2,10 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/EasterCompany/dex-discord-service/config"
+	"github.com/bwmarrin/discordgo"
 )
 
 // ResolveService finds a service in the service map by its ID
@@ -44,3 +46,64 @@ func ChunkString(s string, chunkSize int) []string {
 	}
 	return chunks
 }
+
+// ResolveVoiceChannel finds a voice channel by ID, mention or name. Names are matched case-insensitively
+// within guildID, or across every guild the bot is in when guildID is empty.
+func ResolveVoiceChannel(s *discordgo.Session, guildID, channel string) (*discordgo.Channel, error) {
+	channel = strings.TrimSpace(channel)
+	channel = strings.TrimSuffix(strings.TrimPrefix(channel, "<#"), ">")
+	channel = strings.TrimPrefix(channel, "#")
+	if channel == "" {
+		return nil, fmt.Errorf("no channel given")
+	}
+
+	isVoice := func(c *discordgo.Channel) bool {
+		return c.Type == discordgo.ChannelTypeGuildVoice || c.Type == discordgo.ChannelTypeGuildStageVoice
+	}
+
+	// By ID
+	c, err := s.State.Channel(channel)
+	if err != nil {
+		c, err = s.Channel(channel)
+	}
+	if err == nil && c != nil {
+		if !isVoice(c) {
+			return nil, fmt.Errorf("channel %s is not a voice channel", channel)
+		}
+		if guildID != "" && c.GuildID != guildID {
+			return nil, fmt.Errorf("channel %s is not in guild %s", channel, guildID)
+		}
+		return c, nil
+	}
+
+	// By name
+	guildIDs := []string{guildID}
+	if guildID == "" {
+		guildIDs = nil
+		for _, g := range s.State.Guilds {
+			guildIDs = append(guildIDs, g.ID)
+		}
+	}
+
+	var matches []*discordgo.Channel
+	for _, id := range guildIDs {
+		channels, err := s.GuildChannels(id)
+		if err != nil {
+			continue
+		}
+		for _, c := range channels {
+			if isVoice(c) && strings.EqualFold(c.Name, channel) {
+				matches = append(matches, c)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("voice channel %q not found", channel)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("voice channel name %q is ambiguous; use the channel ID or give a guild", channel)
+	}
+}